@@ -1,17 +1,36 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	errs "errors"
 	"github.com/NVTer/rest-api-example/internal/handler"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/exchange"
 	"github.com/NVTer/rest-api-example/internal/middleware"
+	"github.com/NVTer/rest-api-example/internal/openapi"
+	"github.com/NVTer/rest-api-example/internal/policy"
+	"github.com/NVTer/rest-api-example/internal/problem"
 	"github.com/NVTer/rest-api-example/internal/repository"
+	"github.com/NVTer/rest-api-example/internal/repository/postgres"
 	"github.com/NVTer/rest-api-example/internal/service"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
-type Handler interface { // nolint: deadcode
+type Handler interface {
 	GetPositions(w http.ResponseWriter, r *http.Request)
 	GetEmployees(w http.ResponseWriter, r *http.Request)
 	GetPosition(w http.ResponseWriter, r *http.Request)
@@ -22,6 +41,17 @@ type Handler interface { // nolint: deadcode
 	DeleteEmployee(w http.ResponseWriter, r *http.Request)
 	UpdatePosition(w http.ResponseWriter, r *http.Request)
 	UpdateEmployee(w http.ResponseWriter, r *http.Request)
+	ReplacePosition(w http.ResponseWriter, r *http.Request)
+	ReplaceEmployee(w http.ResponseWriter, r *http.Request)
+	PatchPosition(w http.ResponseWriter, r *http.Request)
+	PatchEmployee(w http.ResponseWriter, r *http.Request)
+	Search(w http.ResponseWriter, r *http.Request)
+	GetTrash(w http.ResponseWriter, r *http.Request)
+	GetAudit(w http.ResponseWriter, r *http.Request)
+	RestorePosition(w http.ResponseWriter, r *http.Request)
+	RestoreEmployee(w http.ResponseWriter, r *http.Request)
+	GetSalaryHistory(w http.ResponseWriter, r *http.Request)
+	ScheduleSalary(w http.ResponseWriter, r *http.Request)
 }
 
 const (
@@ -31,33 +61,299 @@ const (
 	pathEmployee   = "/employee"
 	pathPositionID = "/position/{id:\\S+}"
 	pathEmployeeID = "/employee/{id:\\S+}"
+	pathSearch     = "/search"
+	pathTrash      = "/trash"
+	pathAudit      = "/audit"
+	// Restore and salary paths come before the ID paths, whose IDs would
+	// match them.
+	pathPositionRestore = "/position/{id:[^/]+}/restore"
+	pathEmployeeRestore = "/employee/{id:[^/]+}/restore"
+	pathSalaryHistory   = "/position/{id:[^/]+}/salary-history"
+	pathAuth            = "/auth"
+	pathSpec            = "/openapi.json"
+	pathDocs            = "/docs"
+	pathDocsAssets      = "/docs/assets/"
 )
 
+const defaultCompactInterval = 5 * time.Minute
+
+// shutdownTimeout bounds how long requests in flight may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// Records stay in the trash for defaultTrashRetention and are looked for
+// every defaultPurgeInterval.
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+	defaultPurgeInterval  = time.Hour
+)
+
+// Title and version of the API in its OpenAPI document.
+const (
+	apiTitle   = "EmployeeAPI"
+	apiVersion = "1.0.0"
+)
+
+// newRepository picks the storage backend of the records and of the audit
+// trail from the environment: POSTGRES_DSN selects PostgreSQL, DATA_DIR an
+// embedded file-backed database and otherwise everything is kept in memory.
+// The returned function releases the backend on shutdown.
+func newRepository() (service.Repository, service.AuditRepository, func() error) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		return newDataBaseRepository()
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := postgres.Migrate(db); err != nil {
+		logrus.Fatal(err)
+	}
+	return postgres.NewRepo(db), postgres.NewAuditRepo(db), db.Close
+}
+
+func newDataBaseRepository() (service.Repository, service.AuditRepository, func() error) {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		return repository.NewRepo(repository.NewDataBase()), repository.NewAuditLog(), func() error { return nil }
+	}
+	data, err := repository.OpenDataBase(dir, durationEnv("COMPACT_INTERVAL", defaultCompactInterval))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	audit, err := repository.OpenAuditLog(dir)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	closeAll := func() error {
+		err := data.Close()
+		if aerr := audit.Close(); err == nil {
+			err = aerr
+		}
+		return err
+	}
+	return repository.NewRepo(data), audit, closeAll
+}
+
+// durationEnv parses the environment variable name as a time.Duration and
+// returns fallback when it is not set.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return d
+}
+
+// startPurge purges the records that have been in the trash for longer than
+// TRASH_RETENTION every PURGE_INTERVAL until ctx is done.
+func startPurge(ctx context.Context, s *service.Serv) {
+	retention := durationEnv("TRASH_RETENTION", defaultTrashRetention)
+	interval := durationEnv("PURGE_INTERVAL", defaultPurgeInterval)
+	go s.PurgeLoop(ctx, interval, retention)
+}
+
+// newUsers loads the accounts from USERS_FILE, a JSON array of objects with
+// login, bcrypt password_hash and roles. ADMIN_PASSWORD adds or replaces the
+// account ADMIN_LOGIN, which defaults to admin and holds the admin role.
+func newUsers() *auth.Users {
+	users := auth.NewUsers()
+	if path := os.Getenv("USERS_FILE"); path != "" {
+		var err error
+		users, err = auth.LoadUsers(path)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		login := os.Getenv("ADMIN_LOGIN")
+		if login == "" {
+			login = "admin"
+		}
+		if err := users.Add(login, password, auth.RoleAdmin); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	return users
+}
+
+// newTokens signs tokens with RS256 when JWT_PRIVATE_KEY names a PEM file and
+// with HS256 and JWT_SECRET otherwise. Without either a random secret is
+// used, so tokens do not survive a restart. TOKEN_TTL overrides the token
+// lifetime.
+func newTokens() *auth.Tokens {
+	ttl := durationEnv("TOKEN_TTL", auth.DefaultTokenTTL)
+	if path := os.Getenv("JWT_PRIVATE_KEY"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		return auth.NewRS256(key, ttl)
+	}
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		logrus.Warn("JWT_SECRET is not set, tokens are signed with a random secret")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	return auth.NewHS256(secret, ttl)
+}
+
+// newRates loads the exchange rates from EXCHANGE_RATES_FILE, a JSON object
+// such as {"base": "USD", "rates": {"EUR": "0.92"}}. Without it salaries can
+// only be shown in their own currency.
+func newRates() exchange.Rates {
+	path := os.Getenv("EXCHANGE_RATES_FILE")
+	if path == "" {
+		return exchange.NewStatic(internal.DefaultCurrency, nil)
+	}
+	rates, err := exchange.Load(path)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return rates
+}
+
+// newSpec generates the OpenAPI document from the routes newRouter registers
+// and the operations the handler package describes them with.
+func newSpec(log logrus.FieldLogger, h Handler, authHandler http.HandlerFunc) (*openapi3.T, error) {
+	passThrough := func(next http.Handler) http.Handler { return next }
+	return openapi.Generate(newRouter(log, h, authHandler, nil, passThrough), apiTitle, apiVersion, handler.Operations())
+}
+
+// newSpecValidator returns the middleware enforcing doc. OPENAPI_DEBUG=true
+// also checks every response and logs mismatches.
+func newSpecValidator(log logrus.FieldLogger, doc *openapi3.T) func(next http.Handler) http.Handler {
+	var debug bool
+	if value := os.Getenv("OPENAPI_DEBUG"); value != "" {
+		var err error
+		debug, err = strconv.ParseBool(value)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+	validator, err := middleware.OpenAPIMiddleware(log, doc, debug)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	return validator
+}
+
+// serveSpec adds GET /openapi.json with doc and GET /docs browsing it to r,
+// together with the files the docs page loads. None needs a token.
+func serveSpec(r *mux.Router, doc *openapi3.T) error {
+	spec, err := openapi.Handler(doc)
+	if err != nil {
+		return err
+	}
+	r.Handle(pathSpec, spec).Methods("GET")
+	r.Handle(pathDocs, openapi.DocsHandler(doc, pathSpec, pathDocsAssets)).Methods("GET")
+	r.PathPrefix(pathDocsAssets).Handler(http.StripPrefix(pathDocsAssets, openapi.AssetsHandler())).Methods("GET")
+	return nil
+}
+
+// newRouter registers the routes of the API. Every request but POST /auth
+// needs a bearer token, and every request is checked by validator before a
+// handler sees it.
+func newRouter(
+	log logrus.FieldLogger,
+	h Handler,
+	authHandler http.HandlerFunc,
+	tokens middleware.TokenValidator,
+	validator func(next http.Handler) http.Handler,
+) *mux.Router {
+	r := mux.NewRouter()
+	r.Handle(pathAuth, validator(authHandler)).Methods("POST").Name(handler.RouteAuth)
+	api := r.NewRoute().Subrouter()
+	api.Use(middleware.AuthMiddleware(log, tokens), validator)
+	api.HandleFunc(pathPositionRestore, h.RestorePosition).Methods("POST").Name(handler.RouteRestorePosition)
+	api.HandleFunc(pathEmployeeRestore, h.RestoreEmployee).Methods("POST").Name(handler.RouteRestoreEmployee)
+	api.HandleFunc(pathSalaryHistory, h.GetSalaryHistory).Methods("GET").Name(handler.RouteGetSalaryHistory)
+	api.HandleFunc(pathSalaryHistory, h.ScheduleSalary).Methods("POST").Name(handler.RouteScheduleSalary)
+	api.HandleFunc(pathPositions, h.GetPositions).Methods("GET").Name(handler.RouteGetPositions)
+	api.HandleFunc(pathEmployees, h.GetEmployees).Methods("GET").Name(handler.RouteGetEmployees)
+	api.HandleFunc(pathPositionID, h.GetPosition).Methods("GET").Name(handler.RouteGetPosition)
+	api.HandleFunc(pathEmployeeID, h.GetEmployee).Methods("GET").Name(handler.RouteGetEmployee)
+	api.HandleFunc(pathSearch, h.Search).Methods("GET").Name(handler.RouteSearch)
+	api.HandleFunc(pathTrash, h.GetTrash).Methods("GET").Name(handler.RouteGetTrash)
+	api.HandleFunc(pathAudit, h.GetAudit).Methods("GET").Name(handler.RouteGetAudit)
+	api.HandleFunc(pathPositionID, h.DeletePosition).Methods("DELETE").Name(handler.RouteDeletePosition)
+	api.HandleFunc(pathEmployeeID, h.DeleteEmployee).Methods("DELETE").Name(handler.RouteDeleteEmployee)
+	api.HandleFunc(pathPosition, h.UpdatePosition).Methods("PUT").Name(handler.RouteUpdatePosition)
+	api.HandleFunc(pathEmployee, h.UpdateEmployee).Methods("PUT").Name(handler.RouteUpdateEmployee)
+	api.HandleFunc(pathPositionID, h.ReplacePosition).Methods("PUT").Name(handler.RouteReplacePosition)
+	api.HandleFunc(pathEmployeeID, h.ReplaceEmployee).Methods("PUT").Name(handler.RouteReplaceEmployee)
+	api.HandleFunc(pathPositionID, h.PatchPosition).Methods("PATCH").Name(handler.RoutePatchPosition)
+	api.HandleFunc(pathEmployeeID, h.PatchEmployee).Methods("PATCH").Name(handler.RoutePatchEmployee)
+	api.HandleFunc(pathPosition, h.CreatePosition).Methods("POST").Name(handler.RouteCreatePosition)
+	api.HandleFunc(pathEmployee, h.CreateEmployee).Methods("POST").Name(handler.RouteCreateEmployee)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusNotFound, errors.NotFound())
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusMethodNotAllowed, nil)
+	})
+	r.Use(middleware.IDMiddleware(log), middleware.TimeLogMiddleware(log), middleware.AccessLogMiddleware(log))
+	return r
+}
+
+// Run serves the API until SIGINT or SIGTERM, then stops taking requests,
+// waits up to shutdownTimeout for those in flight, stops the background
+// jobs and closes the repository, which compacts a file-backed database one
+// last time.
 func Run() {
 	logrus.SetFormatter(&logrus.JSONFormatter{})
-	r := mux.NewRouter()
-	myData := repository.NewDataBase()
-	myRepo := repository.NewRepo(myData)
-	myServ := service.NewServ(myRepo)
-	myH := handler.NewHandler(myServ)
-	pathLimit := "{limit:\\S+}"
-	pathOffset := "{offset:\\S+}"
-	r.HandleFunc(pathPositions, myH.GetPositions).Queries("limit", pathLimit, "offset", pathOffset).Methods("GET")
-	r.HandleFunc(pathEmployees, myH.GetEmployees).Queries("limit", pathLimit, "offset", pathOffset).Methods("GET")
-	r.HandleFunc(pathPositionID, myH.GetPosition).Methods("GET")
-	r.HandleFunc(pathEmployeeID, myH.GetEmployee).Methods("GET")
-	r.HandleFunc(pathPositionID, myH.DeletePosition).Methods("DELETE")
-	r.HandleFunc(pathEmployeeID, myH.DeleteEmployee).Methods("DELETE")
-	r.HandleFunc(pathPosition, myH.UpdatePosition).Methods("PUT")
-	r.HandleFunc(pathEmployee, myH.UpdateEmployee).Methods("PUT")
-	r.HandleFunc(pathPosition, myH.CreatePosition).Methods("POST")
-	r.HandleFunc(pathEmployee, myH.CreateEmployee).Methods("POST")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	myRepo, myAudit, closeRepo := newRepository()
+	defer func() {
+		if err := closeRepo(); err != nil {
+			logrus.WithError(err).Error("close repository")
+		}
+	}()
+	myServ := service.NewServ(myRepo, myAudit)
+	startPurge(ctx, myServ)
+	myH := handler.NewHandler(policy.New(myServ), newRates())
+	tokens := newTokens()
 	log := logrus.New()
-	r.Use(middleware.IDMiddleware(log), middleware.TimeLogMiddleware(log), middleware.AccessLogMiddleware(log))
-	err := http.ListenAndServe("localhost:8080", r)
+	authH := handler.NewAuthHandler(newUsers(), tokens)
+	doc, err := newSpec(log, myH, authH.Auth)
 	if err != nil {
 		log.Fatal(err)
 	}
+	r := newRouter(log, myH, authH.Auth, tokens, newSpecValidator(log, doc))
+	if err := serveSpec(r, doc); err != nil {
+		log.Fatal(err)
+	}
+	if err := serve(ctx, &http.Server{Addr: "localhost:8080", Handler: r}); err != nil {
+		log.Error(err)
+	}
+}
+
+// serve runs server until ctx is done and then shuts it down gracefully.
+func serve(ctx context.Context, server *http.Server) error {
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		done <- server.Shutdown(shutdown)
+	}()
+	if err := server.ListenAndServe(); !errs.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
 }
 
 func main() {
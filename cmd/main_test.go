@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal/handler"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// pathPattern matches the regular expression of a mux path variable.
+var pathPattern = regexp.MustCompile(`\{(\w+):[^}]*\}`) //nolint:gochecknoglobals
+
+func newTestSpec(t *testing.T) (*openapi3.T, *mux.Router) {
+	h := handler.NewHandler(nil, nil)
+	authH := handler.NewAuthHandler(nil, nil)
+	doc, err := newSpec(logrus.New(), h, authH.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passThrough := func(next http.Handler) http.Handler { return next }
+	return doc, newRouter(logrus.New(), h, authH.Auth, nil, passThrough)
+}
+
+func TestRoutesInSpec(t *testing.T) {
+	doc, r := newTestSpec(t)
+	routes := 0
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := pathPattern.ReplaceAllString(template, "{$1}")
+		item := doc.Paths.Find(path)
+		if !assert.NotNil(t, item, "%s is not in the spec", path) {
+			return nil
+		}
+		for _, method := range methods {
+			assert.NotNil(t, item.GetOperation(method), "%s %s is not in the spec", method, path)
+			routes++
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 22, routes)
+	assert.Empty(t, doc.Paths["/auth"].Post.Security, "POST /auth needs no token")
+	assert.Nil(t, doc.Paths["/positions"].Get.Security, "GET /positions uses the global bearer token")
+}
+
+func TestServeSpec(t *testing.T) {
+	doc, r := newTestSpec(t)
+	if err := serveSpec(r, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", pathSpec, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	served, err := openapi3.NewLoader().LoadFromData(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, apiTitle, served.Info.Title)
+	assert.Len(t, served.Paths, len(doc.Paths))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", pathDocs, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "swagger-ui")
+	assert.Contains(t, w.Body.String(), `openapi.json`)
+	assert.NotContains(t, w.Body.String(), "https://", "the page loads nothing from elsewhere")
+
+	for _, asset := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", pathDocsAssets+asset, nil))
+		assert.Equal(t, http.StatusOK, w.Code, asset)
+		assert.Contains(t, w.Body.String(), "swagger-ui", asset)
+	}
+}
@@ -3,9 +3,15 @@ module github.com/NVTer/rest-api-example
 go 1.16
 
 require (
+	github.com/fergusstrange/embedded-postgres v1.27.0
+	github.com/getkin/kin-openapi v0.94.0
+	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.8.0
+	github.com/lib/pq v1.10.9
 	github.com/shopspring/decimal v1.2.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.7.0
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	golang.org/x/text v0.3.7
 )
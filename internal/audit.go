@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of records the audit trail follows.
+const (
+	EntityPosition = "position"
+	EntityEmployee = "employee"
+)
+
+// Mutations the audit trail records.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	// AuditScheduleSalary adds a salary record to a position. The entry
+	// carries the record; the salary changes when it takes effect.
+	AuditScheduleSalary = "schedule_salary"
+	// AuditPurge removes a record from the trash for good.
+	AuditPurge = "purge"
+)
+
+// AuditEntry records one mutation of a position or an employee. Entries are
+// only ever added; ID and Time are set by the audit repository, and ID grows
+// with every entry, so the newest entry has the highest ID.
+type AuditEntry struct {
+	ID            int64         `json:"id"`
+	Entity        string        `json:"entity" doc:"position or employee"`
+	EntityID      uuid.UUID     `json:"entity_id"`
+	Action        string        `json:"action" doc:"create, update, delete, restore, schedule_salary or purge"`
+	Actor         string        `json:"actor" doc:"login of the user who made the change"`
+	CorrelationID string        `json:"correlation_id"`
+	Time          time.Time     `json:"time"`
+	Changes       []FieldChange `json:"changes"`
+}
+
+// Change is a mutation of one record, as a repository hands it to the
+// Auditor. Before is nil for a record that did not exist and After for one
+// that no longer does.
+type Change struct {
+	Entity string
+	Action string
+	ID     uuid.UUID
+	Before interface{}
+	After  interface{}
+}
+
+// Auditor adds the changes of a mutation to the audit trail.
+type Auditor func(ctx context.Context, changes ...Change) error
+
+type auditorKey struct{}
+
+// WithAuditor returns a context whose mutations are audited by a.
+func WithAuditor(ctx context.Context, a Auditor) context.Context {
+	return context.WithValue(ctx, auditorKey{}, a)
+}
+
+// Audit hands changes to the Auditor of ctx, if it has one. Repositories call
+// it inside the transaction of the mutation, with the records as the
+// transaction saw them, and roll the mutation back if it fails.
+func Audit(ctx context.Context, changes ...Change) error {
+	a, ok := ctx.Value(auditorKey{}).(Auditor)
+	if !ok || len(changes) == 0 {
+		return nil
+	}
+	return a(ctx, changes...)
+}
+
+// FieldChange is the value of a field before and after a mutation, as the
+// record carries it in JSON. Before is null for a create or a restore and
+// After for a delete or a purge.
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter narrows down the audit trail. The zero value matches every
+// entry.
+type AuditFilter struct {
+	Entity   string
+	EntityID uuid.UUID
+	Actor    string
+	// From and To bound the time of the entries: From is inclusive, To
+	// exclusive. A zero time leaves that end open.
+	From time.Time
+	To   time.Time
+}
+
+// Match reports whether e passes the filter.
+func (f AuditFilter) Match(e AuditEntry) bool {
+	switch {
+	case f.Entity != "" && e.Entity != f.Entity:
+		return false
+	case f.EntityID != uuid.Nil && e.EntityID != f.EntityID:
+		return false
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case !f.From.IsZero() && e.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// untrackedFields are the fields the server keeps on every write; a diff
+// leaves them out. The ID is in the entry itself.
+var untrackedFields = map[string]bool{ //nolint:gochecknoglobals
+	"id":         true,
+	"ID":         true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+// Diff returns the fields whose JSON differs between before and after in the
+// order of their names. Either may be nil, which is a record that did not
+// exist; every field then changes from or to null.
+func Diff(before, after interface{}) ([]FieldChange, error) {
+	b, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(a)+len(b))
+	for name := range b {
+		names = append(names, name)
+	}
+	for name := range a {
+		if _, ok := b[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := make([]FieldChange, 0, len(names))
+	for _, name := range names {
+		if untrackedFields[name] || bytes.Equal(b[name], a[name]) {
+			continue
+		}
+		change := FieldChange{Field: name}
+		if err := jsonValue(b[name], &change.Before); err != nil {
+			return nil, err
+		}
+		if err := jsonValue(a[name], &change.After); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// jsonValue decodes raw into v, leaving v nil when raw is missing.
+func jsonValue(raw json.RawMessage, v *interface{}) error {
+	if raw == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
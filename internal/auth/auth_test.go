@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUsers(t *testing.T) {
+	users := NewUsers()
+	require.NoError(t, users.Add("admin", "secret"))
+	assert.Equal(t, errors.BadRequest(), users.Add("", "secret"))
+	assert.Equal(t, errors.BadRequest(), users.Add("root", "secret", "owner"))
+
+	user, err := users.Authenticate("admin", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.Login)
+	assert.NotEqual(t, "secret", user.PasswordHash)
+	_, err = users.Authenticate("admin", "wrong")
+	assert.Equal(t, errors.Unauthorized(), err)
+	_, err = users.Authenticate("nobody", "secret")
+	assert.Equal(t, errors.Unauthorized(), err)
+	_, err = users.Authenticate("nobody", "dummy password")
+	assert.Equal(t, errors.Unauthorized(), err, "the dummy hash lets nobody in")
+
+	cost, err := bcrypt.Cost([]byte(dummyHash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.DefaultCost, cost, "unknown logins cost as much as wrong passwords")
+}
+
+func TestLoadUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	raw, err := json.Marshal([]User{{Login: "hr", PasswordHash: string(hash), Roles: []string{RoleHREditor}}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "users.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+
+	users, err := LoadUsers(path)
+	require.NoError(t, err)
+	user, err := users.Authenticate("hr", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{RoleHREditor}, user.Roles)
+
+	require.NoError(t, os.WriteFile(path, []byte(`[{"login": "hr"}]`), 0o600))
+	_, err = LoadUsers(path)
+	assert.Equal(t, errors.BadRequest(), err)
+	raw = []byte(`[{"login": "hr", "password_hash": "` + string(hash) + `", "roles": ["owner"]}]`)
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	_, err = LoadUsers(path)
+	assert.Equal(t, errors.BadRequest(), err)
+}
+
+func TestTokens(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	for name, tokens := range map[string]*Tokens{
+		"HS256": NewHS256([]byte("secret"), time.Minute),
+		"RS256": NewRS256(key, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			token, ttl, err := tokens.Issue(User{Login: "admin", Roles: []string{RoleAdmin}})
+			require.NoError(t, err)
+			assert.Equal(t, time.Minute, ttl)
+			claims, err := tokens.Validate(token)
+			require.NoError(t, err)
+			assert.Equal(t, "admin", claims.Subject)
+			assert.Equal(t, []string{RoleAdmin}, claims.Roles)
+
+			_, err = tokens.Validate(token + "x")
+			assert.Equal(t, errors.Unauthorized(), err)
+			_, err = tokens.Validate("")
+			assert.Equal(t, errors.Unauthorized(), err)
+
+			expired := *tokens
+			expired.now = func() time.Time { return time.Now().Add(-time.Hour) }
+			token, _, err = expired.Issue(User{Login: "admin"})
+			require.NoError(t, err)
+			_, err = tokens.Validate(token)
+			assert.Equal(t, errors.Unauthorized(), err)
+		})
+	}
+}
+
+func TestTokensRejectOtherAlgorithms(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other := NewHS256([]byte("other"), time.Minute)
+	token, _, err := other.Issue(User{Login: "admin"})
+	require.NoError(t, err)
+	_, err = NewHS256([]byte("secret"), time.Minute).Validate(token)
+	assert.Equal(t, errors.Unauthorized(), err)
+	_, err = NewRS256(key, time.Minute).Validate(token)
+	assert.Equal(t, errors.Unauthorized(), err)
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.RegisteredClaims{Subject: "admin"}).
+		SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = NewHS256([]byte("secret"), time.Minute).Validate(none)
+	assert.Equal(t, errors.Unauthorized(), err)
+}
+
+func TestCan(t *testing.T) {
+	assert.True(t, Can([]string{RoleViewer}, PermListRecords))
+	assert.False(t, Can([]string{RoleViewer}, PermReadRecords))
+	assert.True(t, Can([]string{RoleViewer, RoleHREditor}, PermWriteEmployees))
+	assert.False(t, Can([]string{RoleHREditor}, PermWriteCompensation))
+	assert.True(t, Can([]string{RoleAdmin}, PermDeletePositions))
+	assert.False(t, Can(nil, PermListRecords))
+	assert.False(t, Can([]string{"owner"}, PermListRecords))
+}
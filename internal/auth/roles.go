@@ -0,0 +1,62 @@
+package auth
+
+// Roles a user can hold.
+const (
+	RoleViewer   = "viewer"
+	RoleHREditor = "hr-editor"
+	RoleAdmin    = "admin"
+)
+
+// Permissions the policy layer checks before calling the service.
+// PermReadCompensation is mostly checked when a response is shaped instead.
+const (
+	PermListRecords       = "records:list"
+	PermReadRecords       = "records:read"
+	PermWriteEmployees    = "employees:write"
+	PermDeleteEmployees   = "employees:delete"
+	PermWritePositions    = "positions:write"
+	PermDeletePositions   = "positions:delete"
+	PermReadCompensation  = "compensation:read"
+	PermWriteCompensation = "compensation:write"
+	PermReadAudit         = "audit:read"
+)
+
+// rolePermissions lists what each role may do. Admins may do everything.
+var rolePermissions = map[string][]string{ // nolint: gochecknoglobals
+	RoleViewer: {PermListRecords},
+	RoleHREditor: {
+		PermListRecords,
+		PermReadRecords,
+		PermWriteEmployees,
+		PermReadCompensation,
+	},
+	RoleAdmin: {
+		PermListRecords,
+		PermReadRecords,
+		PermWriteEmployees,
+		PermDeleteEmployees,
+		PermWritePositions,
+		PermDeletePositions,
+		PermReadCompensation,
+		PermWriteCompensation,
+		PermReadAudit,
+	},
+}
+
+// IsRole reports whether role is one of the known roles.
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Can reports whether any of roles grants permission.
+func Can(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
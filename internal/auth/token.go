@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DefaultTokenTTL is how long an access token stays valid.
+const DefaultTokenTTL = time.Hour
+
+// Claims are the JWT claims of an access token. The subject is the login.
+type Claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Tokens issues and validates signed access tokens.
+type Tokens struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewHS256 returns Tokens that sign and verify with the shared secret.
+func NewHS256(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret, ttl: ttl, now: time.Now}
+}
+
+// NewRS256 returns Tokens that sign with key and verify with its public half.
+func NewRS256(key *rsa.PrivateKey, ttl time.Duration) *Tokens {
+	return &Tokens{method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a token for user together with its lifetime.
+func (t *Tokens) Issue(user User) (string, time.Duration, error) {
+	now := t.now()
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Login,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.ttl)),
+		},
+		Roles: user.Roles,
+	}
+	token, err := jwt.NewWithClaims(t.method, claims).SignedString(t.signKey)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, t.ttl, nil
+}
+
+// Validate checks the signature, algorithm and expiry of token and returns
+// its claims. Tokens signed with any other algorithm than the configured one
+// are rejected, so an RS256 public key can never be used as an HS256 secret.
+func (t *Tokens) Validate(token string) (Claims, error) {
+	var claims Claims
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{t.method.Alg()}))
+	_, err := parser.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return t.verifyKey, nil
+	})
+	if err != nil || claims.Subject == "" || claims.ExpiresAt == nil {
+		return Claims{}, errors.Unauthorized()
+	}
+	return claims, nil
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared with the password of an unknown login, so that it
+// takes as long to reject as a wrong password. It uses bcrypt.DefaultCost,
+// the cost Add hashes with.
+const dummyHash = "$2a$10$ydrjOVPmrAjF7BkaDD0greeTP6qyHfF.Cg04wfrlAC9CqEayGSKCy"
+
+// User is an account that can obtain access tokens. Only the bcrypt hash of
+// the password is kept.
+type User struct {
+	Login        string   `json:"login"`
+	PasswordHash string   `json:"password_hash"`
+	Roles        []string `json:"roles"`
+}
+
+// Users stores the accounts in memory.
+type Users struct {
+	mu    sync.RWMutex
+	users map[string]User
+}
+
+func NewUsers() *Users {
+	return &Users{users: map[string]User{}}
+}
+
+// LoadUsers reads a JSON array of users, as written by User, from path.
+func LoadUsers(path string) (*Users, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var list []User
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, err
+	}
+	u := NewUsers()
+	for _, user := range list {
+		if user.Login == "" || user.PasswordHash == "" || !validRoles(user.Roles) {
+			return nil, errors.BadRequest()
+		}
+		u.users[user.Login] = user
+	}
+	return u, nil
+}
+
+// Add stores login with the hash of password and the given roles, replacing
+// any previous account with the same login.
+func (u *Users) Add(login, password string, roles ...string) error {
+	if login == "" || password == "" || !validRoles(roles) {
+		return errors.BadRequest()
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.users[login] = User{Login: login, PasswordHash: string(hash), Roles: roles}
+	return nil
+}
+
+// Authenticate returns the user if password matches the stored hash. An
+// unknown login and a wrong password give the same error.
+func (u *Users) Authenticate(login, password string) (User, error) {
+	u.mu.RLock()
+	user, ok := u.users[login]
+	u.mu.RUnlock()
+	hash := user.PasswordHash
+	if !ok {
+		hash = dummyHash
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || !ok {
+		return User{}, errors.Unauthorized()
+	}
+	return user, nil
+}
+
+func validRoles(roles []string) bool {
+	for _, role := range roles {
+		if !IsRole(role) {
+			return false
+		}
+	}
+	return true
+}
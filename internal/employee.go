@@ -1,10 +1,21 @@
 package internal
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Employee struct {
-	ID         uuid.UUID `json:"ID"`
-	FirstName  string    `json:"first_name"`
-	LasName    string    `json:"las_name"`
-	PositionID uuid.UUID `json:"position_id"`
+	ID         uuid.UUID `json:"ID" validate:"update:required"`
+	FirstName  string    `json:"first_name" validate:"required,max=50"`
+	LasName    string    `json:"las_name" validate:"required,max=50"`
+	PositionID uuid.UUID `json:"position_id" validate:"required"`
+	// Version works like Position.Version.
+	Version int `json:"version" doc:"set by the server and ignored in requests; the ETag header carries it for If-Match"`
+	// CreatedAt and UpdatedAt work like those of Position.
+	CreatedAt time.Time `json:"created_at" doc:"set by the server and ignored in requests"`
+	UpdatedAt time.Time `json:"updated_at" doc:"set by the server and ignored in requests; the Last-Modified header carries it"`
+	// DeletedAt works like that of Position.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" doc:"set by the server when the employee is moved to the trash"`
 }
@@ -1,28 +1,154 @@
 package errors
 
+import (
+	errs "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// nolint: gochecknoglobals
 var (
-	badRequest          = newError("bad request")            // nolint: gochecknoglobals
-	notFound            = newError("not found")              // nolint: gochecknoglobals
-	positionIsExists    = newError("position is exists")     // nolint: gochecknoglobals
-	employeeIsExists    = newError("employee is exists")     // nolint: gochecknoglobals
-	internalServerError = newError("internal server error")  // nolint: gochecknoglobals
-	positionIsNotExists = newError("position is not exists") // nolint: gochecknoglobals
-	logError            = newError("log error")              // nolint: gochecknoglobals
-	parseError          = newError("parse error")            // nolint: gochecknoglobals
+	badRequest          = newError("bad_request", http.StatusBadRequest, "bad request")
+	notFound            = newError("not_found", http.StatusNotFound, "not found")
+	positionIsExists    = newError("position_exists", http.StatusConflict, "position is exists")
+	employeeIsExists    = newError("employee_exists", http.StatusConflict, "employee is exists")
+	internalServerError = newError("internal_error", http.StatusInternalServerError, "internal server error")
+	positionIsNotExists = newError("position_not_exists", http.StatusBadRequest, "position is not exists")
+	logError            = newError("log_error", http.StatusInternalServerError, "log error")
+	parseError          = newError("parse_error", http.StatusBadRequest, "parse error")
+	positionIsUsed      = newError("position_used", http.StatusConflict, "position is used")
+	unauthorized        = newError("unauthorized", http.StatusUnauthorized, "unauthorized")
+	forbidden           = newError("forbidden", http.StatusForbidden, "forbidden")
+	invalid             = newError("validation_failed", http.StatusUnprocessableEntity, "validation failed")
+	unsupportedMedia    = newError("unsupported_media_type", http.StatusUnsupportedMediaType, "unsupported media type")
+	patchConflict       = newError("patch_conflict", http.StatusConflict, "patch cannot be applied")
+	preconditionFailed  = newError("precondition_failed", http.StatusPreconditionFailed, "precondition failed")
 )
 
+// PermissionError tells which permission the caller lacked. It matches
+// Forbidden() with errors.Is.
+type PermissionError struct {
+	Permission string
+	Roles      []string
+}
+
+func (e *PermissionError) Error() string {
+	return "forbidden: missing permission " + e.Permission
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == forbidden
+}
+
+func (e *PermissionError) Details() map[string]interface{} {
+	roles := e.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return map[string]interface{}{"permission": e.Permission, "roles": roles}
+}
+
+// FieldError is a rule a single field of a request body broke.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field error of a request body. It matches
+// Invalid() with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 1 {
+		return "validation failed: " + e.Fields[0].Field + " " + e.Fields[0].Message
+	}
+	return fmt.Sprintf("validation failed: %d fields are invalid", len(e.Fields))
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == invalid
+}
+
+func (e *ValidationError) Details() map[string]interface{} {
+	return map[string]interface{}{"errors": e.Fields}
+}
+
+// Errors is a known failure with a stable machine-readable code and the HTTP
+// status it is reported with.
 type Errors struct {
+	code        string
+	status      int
 	description string
 }
 
-func newError(desc string) *Errors {
-	return &Errors{description: desc}
+func newError(code string, status int, desc string) *Errors {
+	return &Errors{code: code, status: status, description: desc}
 }
 
 func (m Errors) Error() string {
 	return m.description
 }
 
+func (m Errors) Code() string {
+	return m.code
+}
+
+func (m Errors) Status() int {
+	return m.status
+}
+
+// detailedError adds details to an error and unwraps to it.
+type detailedError struct {
+	err     error
+	details map[string]interface{}
+}
+
+func (e *detailedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.err
+}
+
+func (e *detailedError) Details() map[string]interface{} {
+	return e.details
+}
+
+// WithDetails attaches details to err. The result still matches err with
+// errors.Is.
+func WithDetails(err error, details map[string]interface{}) error {
+	return &detailedError{err: err, details: details}
+}
+
+// Details returns the details attached to err or to any error it wraps.
+func Details(err error) map[string]interface{} {
+	var d interface{ Details() map[string]interface{} }
+	if errs.As(err, &d) {
+		return d.Details()
+	}
+	return nil
+}
+
+// Lookup returns the known error err is or wraps.
+func Lookup(err error) (*Errors, bool) {
+	var e *Errors
+	if errs.As(err, &e) {
+		return e, true
+	}
+	for _, known := range []*Errors{forbidden, invalid} {
+		if errs.Is(err, known) {
+			return known, true
+		}
+	}
+	return nil, false
+}
+
 func BadRequest() error {
 	return badRequest
 }
@@ -54,3 +180,37 @@ func LogError() error {
 func ParseError() error {
 	return parseError
 }
+
+func PositionIsUsed() error {
+	return positionIsUsed
+}
+
+// PositionIsUsedBy is PositionIsUsed naming the employees that hold the
+// position.
+func PositionIsUsedBy(employees []uuid.UUID) error {
+	return WithDetails(positionIsUsed, map[string]interface{}{"employees": employees})
+}
+
+func Unauthorized() error {
+	return unauthorized
+}
+
+func Forbidden() error {
+	return forbidden
+}
+
+func Invalid() error {
+	return invalid
+}
+
+func UnsupportedMediaType() error {
+	return unsupportedMedia
+}
+
+func PatchConflict() error {
+	return patchConflict
+}
+
+func PreconditionFailed() error {
+	return preconditionFailed
+}
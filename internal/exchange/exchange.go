@@ -0,0 +1,101 @@
+// Package exchange converts money between currencies at the rates of a
+// pluggable provider.
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/shopspring/decimal"
+)
+
+// ratePrecision is the number of decimal places of a cross rate, enough to
+// keep its error far below the minor unit of any salary.
+const ratePrecision = 20
+
+// ErrNoRate is returned, wrapped, for a pair of currencies that has no rate.
+var ErrNoRate = errors.New("no exchange rate")
+
+// Rates provides exchange rates.
+type Rates interface {
+	// Rate returns how many units of to one unit of from is worth, or an
+	// error wrapping ErrNoRate if the provider does not know.
+	Rate(ctx context.Context, from, to string) (decimal.Decimal, error)
+}
+
+// Convert returns m in the currency to. The amount is multiplied by the rate
+// exactly and rounded once to the minor units of to, half away from zero,
+// which is the rounding the EU prescribes for conversions to the euro. Money
+// already in to is returned as is.
+func Convert(ctx context.Context, rates Rates, m internal.Money, to string) (internal.Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	rate, err := rates.Rate(ctx, m.Currency, to)
+	if err != nil {
+		return internal.Money{}, err
+	}
+	return internal.NewMoney(m.Amount.Mul(rate), to).Round(), nil
+}
+
+// Static holds fixed rates against a base currency.
+type Static struct {
+	base  string
+	rates map[string]decimal.Decimal
+}
+
+// NewStatic returns the rates that make one unit of base worth rates[c]
+// units of c. Base is worth one unit of itself.
+func NewStatic(base string, rates map[string]decimal.Decimal) *Static {
+	s := &Static{base: base, rates: map[string]decimal.Decimal{base: decimal.New(1, 0)}}
+	for currency, rate := range rates {
+		s.rates[currency] = rate
+	}
+	return s
+}
+
+// Rate returns the cross rate of from and to over the base currency.
+func (s *Static) Rate(_ context.Context, from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.New(1, 0), nil
+	}
+	fromRate, ok := s.rates[from]
+	toRate, found := s.rates[to]
+	if !ok || !found {
+		return decimal.Decimal{}, fmt.Errorf("%w from %s to %s", ErrNoRate, from, to)
+	}
+	return toRate.DivRound(fromRate, ratePrecision), nil
+}
+
+// file is the JSON a rates file holds, e.g.
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "JPY": 149.5}}
+type file struct {
+	Base  string                     `json:"base"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+// Load reads static rates from the JSON file at path.
+func Load(path string) (*Static, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("read exchange rates %s: %w", path, err)
+	}
+	if !internal.IsCurrencyCode(f.Base) {
+		return nil, fmt.Errorf("read exchange rates %s: base %q is not a currency code", path, f.Base)
+	}
+	for currency, rate := range f.Rates {
+		if !internal.IsCurrencyCode(currency) || !rate.IsPositive() {
+			return nil, fmt.Errorf("read exchange rates %s: bad rate %s for %q", path, rate, currency)
+		}
+	}
+	return NewStatic(f.Base, f.Rates), nil
+}
@@ -0,0 +1,80 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func money(amount, currency string) internal.Money {
+	return internal.NewMoney(decimal.RequireFromString(amount), currency)
+}
+
+func TestConvert(t *testing.T) {
+	rates := NewStatic("EUR", map[string]decimal.Decimal{
+		"USD": decimal.RequireFromString("1.0870"),
+		"JPY": decimal.RequireFromString("162.35"),
+		"KWD": decimal.RequireFromString("0.3341"),
+		"GBP": decimal.RequireFromString("0.8556"),
+		// XTS is the ISO 4217 code reserved for testing.
+		"XTS": decimal.RequireFromString("1.25"),
+	})
+	ctx := context.Background()
+	testTable := []struct {
+		from     internal.Money
+		to       string
+		expected internal.Money
+	}{
+		{from: money("1000", "EUR"), to: "USD", expected: money("1087", "USD")},
+		{from: money("1087", "USD"), to: "EUR", expected: money("1000", "EUR")},
+		{from: money("1000.50", "EUR"), to: "JPY", expected: money("162431", "JPY")},
+		{from: money("100", "USD"), to: "GBP", expected: money("78.71", "GBP")},
+		{from: money("1000", "EUR"), to: "KWD", expected: money("334.1", "KWD")},
+		{from: money("0.05", "EUR"), to: "USD", expected: money("0.05", "USD")},
+		// 0.1 EUR is 0.125 XTS: half a minor unit rounds away from zero.
+		{from: money("0.1", "EUR"), to: "XTS", expected: money("0.13", "XTS")},
+		{from: money("12.345", "KWD"), to: "KWD", expected: money("12.345", "KWD")},
+	}
+	for _, testCase := range testTable {
+		converted, err := Convert(ctx, rates, testCase.from, testCase.to)
+		require.NoError(t, err, testCase.from.String())
+		assert.True(t, testCase.expected.Equal(converted), "%s to %s: %s", testCase.from, testCase.to, converted)
+	}
+	_, err := Convert(ctx, rates, money("10", "EUR"), "CHF")
+	assert.True(t, errors.Is(err, ErrNoRate))
+	_, err = Convert(ctx, rates, money("10", "CHF"), "EUR")
+	assert.True(t, errors.Is(err, ErrNoRate))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		path := filepath.Join(dir, "rates.json")
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+		return path
+	}
+	rates, err := Load(write(`{"base":"USD","rates":{"EUR":"0.92","JPY":149.5}}`))
+	require.NoError(t, err)
+	rate, err := rates.Rate(context.Background(), "EUR", "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, "162.5", rate.Round(1).String())
+
+	for _, body := range []string{
+		`{"base":"usd","rates":{}}`,
+		`{"base":"USD","rates":{"EUR":0}}`,
+		`{"base":"USD","rates":{"EURO":1}}`,
+		`{"base":"USD","rates":[]}`,
+	} {
+		_, err := Load(write(body))
+		assert.Error(t, err, body)
+	}
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Sortable fields of the list endpoints.
+const (
+	SortID         = "id"
+	SortName       = "name"
+	SortSalary     = "salary"
+	SortFirstName  = "first_name"
+	SortLasName    = "las_name"
+	SortPositionID = "position_id"
+)
+
+// SortField is one key of a multi-field sort. Records that compare equal on
+// every key are ordered by ID so that pages stay stable.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// PositionFilter narrows down a position list. The zero value matches every
+// position outside the trash and keeps the default order by ID.
+type PositionFilter struct {
+	NameContains string
+	// SalaryMin and SalaryMax bound the salary in SalaryCurrency, in which
+	// sorting by salary compares salaries too.
+	SalaryMin decimal.NullDecimal
+	SalaryMax decimal.NullDecimal
+	// SalaryCurrency is the currency salaries are compared in. A salary in
+	// another currency is converted at the rate SalaryRate returns for it and
+	// rounded like exchange.Convert does. Filtering or sorting by salary
+	// needs both; see WithRates.
+	SalaryCurrency string
+	SalaryRate     func(from string) (decimal.Decimal, error)
+	// Rates holds the rate of each currency salaries are compared from, as
+	// set by WithRates.
+	Rates map[string]decimal.Decimal
+	Sort  []SortField
+	// IncludeDeleted also matches the positions in the trash.
+	IncludeDeleted bool
+}
+
+// EmployeeFilter narrows down an employee list. The zero value matches every
+// employee outside the trash and keeps the default order by ID.
+type EmployeeFilter struct {
+	PositionID      uuid.UUID
+	FirstNamePrefix string
+	LasNamePrefix   string
+	Sort            []SortField
+	// IncludeDeleted also matches the employees in the trash.
+	IncludeDeleted bool
+}
+
+// Match reports whether p passes the filter. Name matching ignores case.
+func (f PositionFilter) Match(p Position) bool {
+	if p.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	if f.SalaryMin.Valid && f.Salary(p).LessThan(f.SalaryMin.Decimal) {
+		return false
+	}
+	if f.SalaryMax.Valid && f.Salary(p).GreaterThan(f.SalaryMax.Decimal) {
+		return false
+	}
+	return true
+}
+
+// ComparesSalaries reports whether the filter filters or sorts by salary.
+func (f PositionFilter) ComparesSalaries() bool {
+	if f.SalaryMin.Valid || f.SalaryMax.Valid {
+		return true
+	}
+	for _, s := range f.Sort {
+		if s.Field == SortSalary {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRates returns the filter with the Rates of currencies, the currencies
+// of the salaries it is going to compare, looked up with SalaryRate. The
+// errors of SalaryRate are returned as they are.
+func (f PositionFilter) WithRates(currencies []string) (PositionFilter, error) {
+	if !f.ComparesSalaries() {
+		return f, nil
+	}
+	f.Rates = make(map[string]decimal.Decimal, len(currencies))
+	for _, currency := range currencies {
+		if currency == f.SalaryCurrency {
+			continue
+		}
+		rate, err := f.SalaryRate(currency)
+		if err != nil {
+			return f, err
+		}
+		f.Rates[currency] = rate
+	}
+	return f, nil
+}
+
+// Salary returns the salary of p in SalaryCurrency, which the filter has to
+// have the rate for.
+func (f PositionFilter) Salary(p Position) decimal.Decimal {
+	if p.Salary.Currency == f.SalaryCurrency {
+		return p.Salary.Amount
+	}
+	return NewMoney(p.Salary.Amount.Mul(f.Rates[p.Salary.Currency]), f.SalaryCurrency).Round().Amount
+}
+
+// Match reports whether e passes the filter. Name matching ignores case.
+func (f EmployeeFilter) Match(e Employee) bool {
+	if e.DeletedAt != nil && !f.IncludeDeleted {
+		return false
+	}
+	if f.PositionID != uuid.Nil && e.PositionID != f.PositionID {
+		return false
+	}
+	if !hasPrefixFold(e.FirstName, f.FirstNamePrefix) || !hasPrefixFold(e.LasName, f.LasNamePrefix) {
+		return false
+	}
+	return true
+}
+
+// Less orders a before b by the sort keys of the filter.
+func (f PositionFilter) Less(a, b Position) bool {
+	for _, s := range f.Sort {
+		var c int
+		switch s.Field {
+		case SortName:
+			c = strings.Compare(a.Name, b.Name)
+		case SortSalary:
+			c = f.Salary(a).Cmp(f.Salary(b))
+		case SortID:
+			c = strings.Compare(a.ID.String(), b.ID.String())
+		}
+		if c != 0 {
+			return (c < 0) != s.Desc
+		}
+	}
+	return a.ID.String() < b.ID.String()
+}
+
+// Less orders a before b by the sort keys of the filter.
+func (f EmployeeFilter) Less(a, b Employee) bool {
+	for _, s := range f.Sort {
+		var c int
+		switch s.Field {
+		case SortFirstName:
+			c = strings.Compare(a.FirstName, b.FirstName)
+		case SortLasName:
+			c = strings.Compare(a.LasName, b.LasName)
+		case SortPositionID:
+			c = strings.Compare(a.PositionID.String(), b.PositionID.String())
+		case SortID:
+			c = strings.Compare(a.ID.String(), b.ID.String())
+		}
+		if c != 0 {
+			return (c < 0) != s.Desc
+		}
+	}
+	return a.ID.String() < b.ID.String()
+}
+
+// IsZero reports whether the filter neither filters nor sorts, leaving aside
+// whether it includes the trash.
+func (f PositionFilter) IsZero() bool {
+	return f.NameContains == "" && !f.SalaryMin.Valid && !f.SalaryMax.Valid && len(f.Sort) == 0
+}
+
+// IsZero reports whether the filter neither filters nor sorts, leaving aside
+// whether it includes the trash.
+func (f EmployeeFilter) IsZero() bool {
+	return f.PositionID == uuid.Nil && f.FirstNamePrefix == "" && f.LasNamePrefix == "" && len(f.Sort) == 0
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// GetAudit serves GET /audit with a page of the audit trail, newest first.
+// next_cursor leads to older entries.
+func (h *Hand) GetAudit(w http.ResponseWriter, r *http.Request) {
+	f, err := auditFilter(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	entries, next, err := h.service.GetAudit(r.Context(), f, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, page{Data: entries, NextCursor: next})
+}
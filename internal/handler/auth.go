@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+// Authenticator checks the credentials of a user.
+type Authenticator interface {
+	Authenticate(login, password string) (auth.User, error)
+}
+
+// TokenIssuer signs access tokens for a user.
+type TokenIssuer interface {
+	Issue(user auth.User) (string, time.Duration, error)
+}
+
+// AuthHand serves POST /auth, which exchanges a login and password for a
+// bearer token.
+type AuthHand struct {
+	users  Authenticator
+	tokens TokenIssuer
+}
+
+func NewAuthHandler(users Authenticator, tokens TokenIssuer) *AuthHand {
+	return &AuthHand{users: users, tokens: tokens}
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func (h *AuthHand) Auth(w http.ResponseWriter, r *http.Request) {
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		writeError(w, r, parseError(err))
+		return
+	}
+	if c.Login == "" || c.Password == "" {
+		writeError(w, r, errors.BadRequest())
+		return
+	}
+	user, err := h.users.Authenticate(c.Login, c.Password)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	token, ttl, err := h.tokens.Issue(user)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, r, http.StatusOK, tokenResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int(ttl.Seconds())})
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	errs "errors"
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/exchange"
+)
+
+// queryCurrency returns the currency query parameter, the currency to show
+// salaries in, or "" to show them as stored.
+func queryCurrency(r *http.Request) (string, error) {
+	currency := r.URL.Query().Get("currency")
+	if currency != "" && !internal.IsCurrencyCode(currency) {
+		return "", queryError("currency", "must be an ISO 4217 currency code")
+	}
+	return currency, nil
+}
+
+// convertSalaries converts the salaries of positions to the currency the
+// request asks for, if any. Callers who may not read salaries are not shown
+// any, so theirs are left alone.
+func (h *Hand) convertSalaries(r *http.Request, positions []internal.Position) error {
+	currency, err := queryCurrency(r)
+	if err != nil || currency == "" || !canReadSalary(r) {
+		return err
+	}
+	for i := range positions {
+		salary, err := exchange.Convert(r.Context(), h.rates, positions[i].Salary, currency)
+		if errs.Is(err, exchange.ErrNoRate) {
+			return queryError("currency", err.Error())
+		}
+		if err != nil {
+			return err
+		}
+		positions[i].Salary = salary
+	}
+	return nil
+}
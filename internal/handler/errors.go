@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	errs "errors"
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/problem"
+)
+
+// statusFor maps err to the HTTP status every handler reports it with. Known
+// errors carry their own status, a request that ran out of time or was
+// abandoned is a 504 and anything else is an internal error.
+func statusFor(err error) int {
+	if e, ok := errors.Lookup(err); ok {
+		return e.Status()
+	}
+	if errs.Is(err, context.DeadlineExceeded) || errs.Is(err, context.Canceled) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError replies to r with err as problem details.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	problem.Write(w, r, statusFor(err), err)
+}
+
+// writeJSON replies to r with status and v encoded as JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeBody(w, status, body)
+}
+
+// writeBody replies with status and body, which is JSON.
+func writeBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// parseError describes a request body that could not be decoded, keeping the
+// decoder message as a detail.
+func parseError(err error) error {
+	return errors.WithDetails(errors.ParseError(), map[string]interface{}{"reason": err.Error()})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+// etag is the strong entity tag of a record with version. A representation
+// other than the record as stored, such as one with the salary converted or
+// left out, adds what sets it apart, so that caches and If-None-Match tell
+// them apart; ifMatch still reads the version.
+func etag(version int, variant ...string) string {
+	return strconv.Quote(strings.Join(append([]string{strconv.Itoa(version)}, variant...), "-"))
+}
+
+// setValidators tags the reply with the version of the record it carries and
+// dates it with when the record was last updated.
+func setValidators(w http.ResponseWriter, version int, modified time.Time) {
+	w.Header().Set("ETag", etag(version))
+	setLastModified(w, modified)
+}
+
+// setLastModified dates the reply unless modified is unknown.
+func setLastModified(w http.ResponseWriter, modified time.Time) {
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// ifMatch returns the version the If-Match header of r makes an update
+// conditional on, or 0 for none when the header is missing or "*". Every
+// representation of a version matches it. A tag
+// that cannot be one of ours, such as a weak tag, can never match and is
+// PreconditionFailed; so is a list of several tags, which the repositories
+// cannot check at once.
+func ifMatch(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	tag, err := strconv.Unquote(header)
+	if err != nil || !strings.HasPrefix(header, `"`) {
+		return 0, preconditionFailed("If-Match must be a single entity tag")
+	}
+	version, err := strconv.Atoi(strings.SplitN(tag, "-", 2)[0])
+	if err != nil || version <= 0 {
+		return 0, preconditionFailed("If-Match matches no version")
+	}
+	return version, nil
+}
+
+// checkVersion fails with PreconditionFailed if r has an If-Match header that
+// does not match version.
+func checkVersion(r *http.Request, version int) error {
+	want, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+	if want != 0 && want != version {
+		return errors.PreconditionFailed()
+	}
+	return nil
+}
+
+func preconditionFailed(reason string) error {
+	return errors.WithDetails(errors.PreconditionFailed(), map[string]interface{}{"reason": reason})
+}
+
+// notModified tags the reply to r with the entity tag and the time the record
+// or list was last modified, either of which may be unknown, and reports
+// whether r is a conditional GET that the client's copy still answers. In
+// that case it has replied 304 Not Modified. What the caller may see depends
+// on their token, so the reply varies with Authorization.
+func notModified(w http.ResponseWriter, r *http.Request, tag string, modified time.Time) bool {
+	w.Header().Add("Vary", "Authorization")
+	if tag != "" {
+		w.Header().Set("ETag", tag)
+	}
+	setLastModified(w, modified)
+	if !fresh(r, tag, modified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// fresh evaluates the preconditions of a GET like RFC 7232 does:
+// If-None-Match, compared weakly, takes precedence over If-Modified-Since,
+// which only has second precision.
+func fresh(r *http.Request, tag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, candidate := range strings.Split(header, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || (tag != "" && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/")) {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// writeFresh replies to the GET r with v, a list, encoded as JSON. The entity
+// tag is a hash of the body, so that it changes with every record listed and
+// with what the caller may see of them; modified is when the listed
+// collection last changed.
+func writeFresh(w http.ResponseWriter, r *http.Request, v interface{}, modified time.Time) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	sum := sha256.Sum256(body)
+	if notModified(w, r, fmt.Sprintf(`"%x"`, sum[:16]), modified) {
+		return
+	}
+	writeBody(w, http.StatusOK, body)
+}
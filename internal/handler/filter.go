@@ -0,0 +1,182 @@
+package handler
+
+import (
+	errs "errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/exchange"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// positionFilter reads name_contains, salary_min, salary_max, sort and
+// include_deleted from the query. Salaries are compared in the currency the
+// request shows them in, DefaultCurrency if it shows them as stored.
+func (h *Hand) positionFilter(r *http.Request) (internal.PositionFilter, error) {
+	q := r.URL.Query()
+	f := internal.PositionFilter{NameContains: q.Get("name_contains"), Sort: querySort(r)}
+	var err error
+	if f.SalaryMin, err = queryDecimal(r, "salary_min"); err != nil {
+		return f, err
+	}
+	if f.SalaryMax, err = queryDecimal(r, "salary_max"); err != nil {
+		return f, err
+	}
+	if f.IncludeDeleted, err = includeDeleted(r); err != nil {
+		return f, err
+	}
+	if !f.ComparesSalaries() {
+		return f, nil
+	}
+	if f.SalaryCurrency, err = queryCurrency(r); err != nil {
+		return f, err
+	}
+	if f.SalaryCurrency == "" {
+		f.SalaryCurrency = internal.DefaultCurrency
+	}
+	f.SalaryRate = func(from string) (decimal.Decimal, error) {
+		rate, err := h.rates.Rate(r.Context(), from, f.SalaryCurrency)
+		if errs.Is(err, exchange.ErrNoRate) {
+			return rate, queryError("currency", err.Error())
+		}
+		return rate, err
+	}
+	return f, nil
+}
+
+// employeeFilter reads position_id, first_name_prefix, las_name_prefix, sort
+// and include_deleted from the query.
+func employeeFilter(r *http.Request) (internal.EmployeeFilter, error) {
+	q := r.URL.Query()
+	f := internal.EmployeeFilter{
+		FirstNamePrefix: q.Get("first_name_prefix"),
+		LasNamePrefix:   q.Get("las_name_prefix"),
+		Sort:            querySort(r),
+	}
+	if value := q.Get("position_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return f, errors.BadRequest()
+		}
+		f.PositionID = id
+	}
+	var err error
+	if f.IncludeDeleted, err = includeDeleted(r); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// auditFilter reads entity, entity_id, actor and the RFC 3339 times from and
+// to from the query.
+func auditFilter(r *http.Request) (internal.AuditFilter, error) {
+	q := r.URL.Query()
+	f := internal.AuditFilter{Entity: q.Get("entity"), Actor: q.Get("actor")}
+	if value := q.Get("entity_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return f, queryError("entity_id", err.Error())
+		}
+		f.EntityID = id
+	}
+	var err error
+	if f.From, err = queryTime(r, "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = queryTime(r, "to"); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// queryTime parses the query parameter name as an RFC 3339 time, returning
+// the zero time when it is absent.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, queryError(name, "must be an RFC 3339 time")
+	}
+	return t, nil
+}
+
+// includeDeleted reads include_deleted, which lets a list show records in
+// the trash too.
+func includeDeleted(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("include_deleted")
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, queryError("include_deleted", "must be true or false")
+	}
+	return include, nil
+}
+
+// positionDeletion reads employees, one of restrict, cascade and reassign,
+// and reassign_to, the position to reassign to, from the query.
+func positionDeletion(r *http.Request) (internal.PositionDeletion, error) {
+	q := r.URL.Query()
+	d := internal.PositionDeletion{Mode: q.Get("employees")}
+	switch d.Mode {
+	case "", internal.DeleteRestrict, internal.DeleteCascade, internal.DeleteReassign:
+	default:
+		return d, queryError("employees", "must be restrict, cascade or reassign")
+	}
+	value := q.Get("reassign_to")
+	if d.Mode != internal.DeleteReassign {
+		if value != "" {
+			return d, queryError("reassign_to", "only applies to employees=reassign")
+		}
+		return d, nil
+	}
+	if value == "" {
+		return d, queryError("reassign_to", "is required to reassign")
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return d, queryError("reassign_to", err.Error())
+	}
+	d.ReassignTo = id
+	return d, nil
+}
+
+// querySort parses sort=field1,-field2 where a leading minus sorts that
+// field in descending order. Unknown fields are left for the service to
+// reject.
+func querySort(r *http.Request) []internal.SortField {
+	value := r.URL.Query().Get("sort")
+	if value == "" {
+		return nil
+	}
+	var sort []internal.SortField
+	for _, field := range strings.Split(value, ",") {
+		s := internal.SortField{Field: strings.TrimSpace(field)}
+		if strings.HasPrefix(s.Field, "-") {
+			s.Field, s.Desc = s.Field[1:], true
+		}
+		sort = append(sort, s)
+	}
+	return sort
+}
+
+func queryDecimal(r *http.Request, name string) (decimal.NullDecimal, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return decimal.NullDecimal{}, nil
+	}
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return decimal.NullDecimal{}, errors.BadRequest()
+	}
+	return decimal.NullDecimal{Decimal: d, Valid: true}, nil
+}
@@ -1,304 +1,360 @@
 package handler
 
 import (
-	"encoding/json"
-	errs "errors"
 	"net/http"
-	"strconv"
 
 	"github.com/NVTer/rest-api-example/internal"
 	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/exchange"
+	"github.com/NVTer/rest-api-example/internal/validate"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/shopspring/decimal"
 )
 
 type Hand struct {
 	service Service
+	rates   exchange.Rates
 }
 
-func NewHandler(service Service) *Hand {
-	return &Hand{service: service}
+// NewHandler returns a Hand serving service. Salaries asked for in another
+// currency are converted at rates.
+func NewHandler(service Service, rates exchange.Rates) *Hand {
+	return &Hand{service: service, rates: rates}
 }
 
 func (h *Hand) GetPositions(w http.ResponseWriter, r *http.Request) {
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if _, ok := r.URL.Query()["cursor"]; ok {
+		h.getPositionsPage(w, r)
+		return
+	}
+	f, err := h.positionFilter(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := queryInt(r, "limit", defaultPageLimit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	positions, err := h.service.GetPositions(r.Context(), limit, offset)
+	offset, err := queryInt(r, "offset", defaultPageOffset)
 	if err != nil {
-		if errs.Is(err, errors.NotFound()) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		if errs.Is(err, errors.BadRequest()) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(positions)
+	// The change time is read first so that a change racing the listing
+	// dates the reply too early rather than too late.
+	modified, err := h.service.PositionsChanged(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	positions, total, err := h.service.GetPositions(r.Context(), f, limit, offset)
+	if err == nil {
+		err = h.convertSalaries(r, positions)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeFresh(w, r, newListResponse(r, shapePositions(r, positions), len(positions), total, limit, offset), modified)
 }
 
 func (h *Hand) GetEmployees(w http.ResponseWriter, r *http.Request) {
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if _, ok := r.URL.Query()["cursor"]; ok {
+		h.getEmployeesPage(w, r)
+		return
+	}
+	f, err := employeeFilter(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := queryInt(r, "limit", defaultPageLimit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	employees, err := h.service.GetEmployees(r.Context(), limit, offset)
+	offset, err := queryInt(r, "offset", defaultPageOffset)
 	if err != nil {
-		if errs.Is(err, errors.NotFound()) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		if errs.Is(err, errors.BadRequest()) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(employees)
+	modified, err := h.service.EmployeesChanged(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	employees, total, err := h.service.GetEmployees(r.Context(), f, limit, offset)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeFresh(w, r, newListResponse(r, employees, len(employees), total, limit, offset), modified)
 }
 
-func (h *Hand) GetPosition(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	if len(vars) == 0 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+func (h *Hand) getPositionsPage(w http.ResponseWriter, r *http.Request) {
+	f, err := h.positionFilter(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	p, err := h.service.GetPosition(r.Context(), vars["id"])
+	limit, err := queryInt(r, "limit", defaultPageLimit)
 	if err != nil {
-		if errs.Is(err, errors.NotFound()) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(p)
+	modified, err := h.service.PositionsChanged(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	positions, next, err := h.service.GetPositionsPage(r.Context(), f, r.URL.Query().Get("cursor"), limit)
+	if err == nil {
+		err = h.convertSalaries(r, positions)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeFresh(w, r, page{Data: shapePositions(r, positions), NextCursor: next}, modified)
 }
 
-func (h *Hand) GetEmployee(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	if len(vars) == 0 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+func (h *Hand) getEmployeesPage(w http.ResponseWriter, r *http.Request) {
+	f, err := employeeFilter(r)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	e, err := h.service.GetEmployee(r.Context(), vars["id"])
+	limit, err := queryInt(r, "limit", defaultPageLimit)
 	if err != nil {
-		if errs.Is(err, errors.NotFound()) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(e)
+	modified, err := h.service.EmployeesChanged(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	employees, next, err := h.service.GetEmployeesPage(r.Context(), f, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeFresh(w, r, page{Data: employees, NextCursor: next}, modified)
 }
 
-func (h *Hand) CreatePosition(w http.ResponseWriter, r *http.Request) {
-	var p internal.Position
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if p.Salary == decimal.Zero || p.Name == "" {
-		http.Error(w, errors.BadRequest().Error(), http.StatusBadRequest)
+// Search serves GET /search?q=... with the matching employees and positions,
+// best first.
+func (h *Hand) Search(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", defaultPageLimit)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	id, err := h.service.CreatePosition(r.Context(), &p)
+	results, err := h.service.Search(r.Context(), r.URL.Query().Get("q"), limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	resp := map[string]string{
-		"id": id,
+	writeJSON(w, r, http.StatusOK, page{Data: shapeSearchResults(r, results)})
+}
+
+func (h *Hand) GetPosition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if len(vars) == 0 {
+		writeError(w, r, errors.BadRequest())
+		return
 	}
-	jsonBytes, err := json.Marshal(resp)
+	p, err := h.service.GetPosition(r.Context(), vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(201)
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	positions := []internal.Position{p}
+	if err := h.convertSalaries(r, positions); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p = positions[0]
+	if notModified(w, r, etag(p.Version, positionVariant(r)...), p.UpdatedAt) {
+		return
 	}
+	writeJSON(w, r, http.StatusOK, shapePosition(r, p))
 }
 
-func (h *Hand) CreateEmployee(w http.ResponseWriter, r *http.Request) {
-	var e internal.Employee
-	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
-		http.Error(w, errors.ParseError().Error(), http.StatusInternalServerError)
+func (h *Hand) GetEmployee(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if len(vars) == 0 {
+		writeError(w, r, errors.BadRequest())
 		return
 	}
-	if e.LasName == "" || e.FirstName == "" || e.PositionID == uuid.Nil {
-		http.Error(w, errors.BadRequest().Error(), http.StatusBadRequest)
+	e, err := h.service.GetEmployee(r.Context(), vars["id"])
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	id, err := h.service.CreateEmployee(r.Context(), &e)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if notModified(w, r, etag(e.Version), e.UpdatedAt) {
 		return
 	}
-	resp := map[string]string{
-		"id": id,
+	writeJSON(w, r, http.StatusOK, e)
+}
+
+func (h *Hand) CreatePosition(w http.ResponseWriter, r *http.Request) {
+	var p internal.Position
+	if err := validate.Decode(r.Body, &p, validate.Create); err != nil {
+		writeError(w, r, err)
+		return
 	}
-	jsonBytes, err := json.Marshal(resp)
+	id, err := h.service.CreatePosition(r.Context(), &p)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, map[string]string{"id": id})
+}
+
+func (h *Hand) CreateEmployee(w http.ResponseWriter, r *http.Request) {
+	var e internal.Employee
+	if err := validate.Decode(r.Body, &e, validate.Create); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	w.WriteHeader(201)
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	id, err := h.service.CreateEmployee(r.Context(), &e)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	writeJSON(w, r, http.StatusCreated, map[string]string{"id": id})
 }
 
+// UpdatePosition serves PUT /position, which names the position by the ID in
+// the body. Like ReplacePosition it honours If-Match.
 func (h *Hand) UpdatePosition(w http.ResponseWriter, r *http.Request) {
 	var p internal.Position
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := validate.Decode(r.Body, &p, validate.Update); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	err := h.service.UpdatePosition(r.Context(), &p)
-	if err != nil {
-		if errs.Is(err, errors.BadRequest()) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusNotFound)
+	h.updatePosition(w, r, p)
+}
+
+// UpdateEmployee serves PUT /employee like UpdatePosition.
+func (h *Hand) UpdateEmployee(w http.ResponseWriter, r *http.Request) {
+	var e internal.Employee
+	if err := validate.Decode(r.Body, &e, validate.Update); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(p)
+	h.updateEmployee(w, r, e)
+}
+
+// ReplacePosition serves PUT /position/{id}. The body may leave the ID out,
+// but must not name another position. With an If-Match header the position
+// is only replaced if its ETag still matches, otherwise the reply is 412.
+func (h *Hand) ReplacePosition(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	var p internal.Position
+	err = validate.Decode(r.Body, &p, validate.Create)
+	if err = matchID(err, "id", p.ID, id); err != nil {
+		writeError(w, r, err)
+		return
 	}
+	p.ID = id
+	h.updatePosition(w, r, p)
 }
 
-func (h *Hand) UpdateEmployee(w http.ResponseWriter, r *http.Request) {
+// ReplaceEmployee serves PUT /employee/{id} like ReplacePosition.
+func (h *Hand) ReplaceEmployee(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 	var e internal.Employee
-	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	err = validate.Decode(r.Body, &e, validate.Create)
+	if err = matchID(err, "ID", e.ID, id); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	err := h.service.UpdateEmployee(r.Context(), &e)
+	e.ID = id
+	h.updateEmployee(w, r, e)
+}
+
+// updatePosition stores p on the condition of the If-Match header of r; the
+// version in the body is the server's to set and is not trusted.
+func (h *Hand) updatePosition(w http.ResponseWriter, r *http.Request, p internal.Position) {
+	version, err := ifMatch(r)
 	if err != nil {
-		if errs.Is(err, errors.BadRequest()) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if errs.Is(err, errors.PositionIsNotExists()) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+	p.Version = version
+	if err := h.service.UpdatePosition(r.Context(), &p); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(e)
+	setValidators(w, p.Version, p.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, shapePosition(r, p))
+}
+
+func (h *Hand) updateEmployee(w http.ResponseWriter, r *http.Request, e internal.Employee) {
+	version, err := ifMatch(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+	e.Version = version
+	if err := h.service.UpdateEmployee(r.Context(), &e); err != nil {
+		writeError(w, r, err)
+		return
 	}
+	setValidators(w, e.Version, e.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, e)
 }
 
 func (h *Hand) DeletePosition(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if len(vars) == 0 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeError(w, r, errors.BadRequest())
 		return
 	}
-	err := h.service.DeletePosition(r.Context(), vars["id"])
+	d, err := positionDeletion(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(internal.Position{})
+	err = h.service.DeletePosition(r.Context(), vars["id"], d)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
-	}
+	writeJSON(w, r, http.StatusOK, shapePosition(r, internal.Position{}))
 }
 
 func (h *Hand) DeleteEmployee(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	if len(vars) == 0 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeError(w, r, errors.BadRequest())
 		return
 	}
 	err := h.service.DeleteEmployee(r.Context(), vars["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(internal.Employee{})
+	writeJSON(w, r, http.StatusOK, internal.Employee{})
+}
+
+// pathID parses the {id} variable of the route path.
+func pathID(r *http.Request) (uuid.UUID, error) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	_, er := w.Write(jsonBytes)
-	if er != nil {
-		http.Error(w, er.Error(), http.StatusInternalServerError)
+		return uuid.Nil, errors.BadRequest()
 	}
+	return id, nil
 }
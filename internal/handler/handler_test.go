@@ -9,11 +9,18 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
 	errs "github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/exchange"
+	"github.com/NVTer/rest-api-example/internal/middleware"
+	"github.com/NVTer/rest-api-example/internal/problem"
 	"github.com/NVTer/rest-api-example/internal/repository"
 	"github.com/NVTer/rest-api-example/internal/service"
 	"github.com/google/uuid"
@@ -28,13 +35,18 @@ var (
 	handler     *Hand                  //nolint:gochecknoglobals
 	positionIDs []string               //nolint:gochecknoglobals
 	employeeIDs []string               //nolint:gochecknoglobals
+	// rates are the exchange rates the handler converts salaries at.
+	rates = exchange.NewStatic("USD", map[string]decimal.Decimal{ //nolint:gochecknoglobals
+		"EUR": decimal.RequireFromString("0.92"),
+		"JPY": decimal.RequireFromString("149.5"),
+	})
 )
 
 func initTest() {
 	data = repository.NewDataBase()
 	repos = repository.NewRepo(data)
-	serv = service.NewServ(repos)
-	handler = NewHandler(serv)
+	serv = service.NewServ(repos, repository.NewAuditLog())
+	handler = NewHandler(serv, rates)
 	positionIDs = make([]string, 0)
 	employeeIDs = make([]string, 0)
 }
@@ -51,6 +63,16 @@ func createEmpID() uuid.UUID {
 	return id
 }
 
+// untrashedEmployees leaves out the employees in the trash.
+func untrashedEmployees(m map[string]internal.Employee) map[string]internal.Employee {
+	for id, e := range m {
+		if e.DeletedAt != nil {
+			delete(m, id)
+		}
+	}
+	return m
+}
+
 func createTestContext(r *http.Request) *http.Request {
 	ctx := r.Context()
 	id := uuid.New()
@@ -58,7 +80,32 @@ func createTestContext(r *http.Request) *http.Request {
 	ctx = context.WithValue(ctx, "correlation_id", id.String()) //nolint:staticcheck
 	//revive:enable
 	r = r.WithContext(ctx)
-	return r
+	return withRoles(r, auth.RoleAdmin)
+}
+
+// withRoles stores roles in the request context the way the auth middleware
+// does.
+func withRoles(r *http.Request, roles ...string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), middleware.UserRoles, roles)) //nolint:staticcheck
+}
+
+// problemText is how responseText shows a problem details body: everything
+// but the per-request correlation ID and instance.
+func problemText(status int, code, detail string) string {
+	return fmt.Sprintf("%d %s: %s", status, code, detail)
+}
+
+// timestamps matches the times the repository stamps records with.
+var timestamps = regexp.MustCompile(`,"created_at":"[^"]*","updated_at":"[^"]*"`)
+
+// responseText returns body without timestamps unless it is a problem details
+// body, which it returns as problemText.
+func responseText(body []byte) string {
+	var p problem.Problem
+	if err := json.Unmarshal(body, &p); err != nil || p.Code == "" {
+		return timestamps.ReplaceAllString(string(body), "")
+	}
+	return problemText(p.Status, p.Code, p.Detail)
 }
 
 type responseMap struct {
@@ -67,8 +114,8 @@ type responseMap struct {
 
 func TestHand_CreateEmployeeOK(t *testing.T) {
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	id, err := uuid.Parse(positionIDs[0])
 	if err != nil {
 		t.Fatalf("Error: %v ", err)
@@ -120,8 +167,8 @@ func TestHand_CreateEmployeeOK(t *testing.T) {
 
 func TestHand_CreateEmployee(t *testing.T) { //nolint:funlen
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	id, err := uuid.Parse(positionIDs[0])
 	if err != nil {
 		t.Fatalf("Error: %v ", err)
@@ -150,7 +197,7 @@ func TestHand_CreateEmployee(t *testing.T) { //nolint:funlen
 		{
 			URL:      "http://localhost:8080/employee",
 			method:   "POST",
-			expected: 500,
+			expected: 400,
 			read:     strings.NewReader("s"),
 			body:     errs.ParseError().Error() + "\n",
 		},
@@ -164,9 +211,9 @@ func TestHand_CreateEmployee(t *testing.T) { //nolint:funlen
 		{
 			URL:      "http://localhost:8080/employee",
 			method:   "POST",
-			expected: 400,
+			expected: 422,
 			read:     strings.NewReader(string(jsonSecondEmployee)),
-			body:     errs.BadRequest().Error() + "\n",
+			body:     errs.Invalid().Error() + "\n",
 		},
 	}
 	for _, testCase := range testTable {
@@ -186,7 +233,7 @@ func TestHand_CreateEmployee(t *testing.T) { //nolint:funlen
 
 func TestHand_CreatePositionOK(t *testing.T) {
 	initTest()
-	firstPosition := internal.Position{Salary: decimal.New(500, 0), Name: "worker"}
+	firstPosition := internal.Position{Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
 	jsonFirstPosition, _ := json.Marshal(firstPosition)
 	reader := strings.NewReader(string(jsonFirstPosition))
 	testTable := []struct {
@@ -230,7 +277,7 @@ func TestHand_CreatePositionOK(t *testing.T) {
 
 func TestHand_CreatePosition(t *testing.T) { //nolint:funlen
 	initTest()
-	firstPosition := internal.Position{Salary: decimal.New(500, 0), Name: "worker"}
+	firstPosition := internal.Position{Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
 	fakePosition := internal.Employee{ID: createEmpID(), FirstName: "V", LasName: "T", PositionID: uuid.New()}
 	jsonFirstPosition, _ := json.Marshal(firstPosition)
 	jsonFakePosition, _ := json.Marshal(fakePosition)
@@ -244,7 +291,7 @@ func TestHand_CreatePosition(t *testing.T) { //nolint:funlen
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "POST",
-			expected: 500,
+			expected: 400,
 			read:     strings.NewReader("s"),
 		},
 		{
@@ -256,13 +303,13 @@ func TestHand_CreatePosition(t *testing.T) { //nolint:funlen
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "POST",
-			expected: 400,
+			expected: 422,
 			read:     strings.NewReader(string(jsonFakePosition)),
 		},
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "POST",
-			expected: 400,
+			expected: 409,
 			read:     strings.NewReader(string(jsonFirstPosition)),
 		},
 	}
@@ -284,10 +331,10 @@ func TestHand_CreatePosition(t *testing.T) { //nolint:funlen
 func TestHand_DeleteEmployeeVarsZero(t *testing.T) {
 	initTest()
 	posID := createPosID()
-	position := internal.Position{ID: posID, Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&position)
+	position := internal.Position{ID: posID, Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
 	employee := internal.Employee{ID: createEmpID(), FirstName: "Vik", LasName: "Vok", PositionID: posID}
-	repos.AddEmployee(&employee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -322,10 +369,10 @@ func TestHand_DeleteEmployeeVarsZero(t *testing.T) {
 func TestHand_DeleteEmployee(t *testing.T) {
 	initTest()
 	posID := createPosID()
-	position := internal.Position{ID: posID, Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&position)
+	position := internal.Position{ID: posID, Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
 	employee := internal.Employee{ID: createEmpID(), FirstName: "Vik", LasName: "Vok", PositionID: posID}
-	repos.AddEmployee(&employee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -347,7 +394,7 @@ func TestHand_DeleteEmployee(t *testing.T) {
 			method:     "DELETE",
 			employeeID: uuid.New().String(),
 			expected:   404,
-			resp:       "not found\n",
+			resp:       problemText(404, "not_found", "not found"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -372,8 +419,8 @@ func TestHand_DeleteEmployee(t *testing.T) {
 
 func TestHand_DeletePositionVarsZero(t *testing.T) { //nolint: funlen
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -387,7 +434,7 @@ func TestHand_DeletePositionVarsZero(t *testing.T) { //nolint: funlen
 			method:     "DELETE",
 			positionID: positionIDs[0],
 			expected:   400,
-			resp:       "bad request\n",
+			resp:       problemText(400, "bad_request", "bad request"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -407,8 +454,8 @@ func TestHand_DeletePositionVarsZero(t *testing.T) { //nolint: funlen
 }
 func TestHand_DeletePosition(t *testing.T) {
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -421,14 +468,14 @@ func TestHand_DeletePosition(t *testing.T) {
 			method:     "DELETE",
 			positionID: positionIDs[0],
 			expected:   200,
-			resp:       "{\"id\":\"00000000-0000-0000-0000-000000000000\",\"name\":\"\",\"salary\":\"0\"}",
+			resp:       "{\"id\":\"00000000-0000-0000-0000-000000000000\",\"name\":\"\",\"salary\":{\"amount\":\"0\",\"currency\":\"\"}}",
 		},
 		{
 			URL:        "http://localhost:8080/position/" + uuid.New().String(),
 			method:     "DELETE",
 			positionID: uuid.New().String(),
 			expected:   404,
-			resp:       "not found\n",
+			resp:       problemText(404, "not_found", "not found"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -450,13 +497,105 @@ func TestHand_DeletePosition(t *testing.T) {
 	}
 }
 
+func TestHand_DeletePositionEmployees(t *testing.T) { //nolint:funlen
+	initTest()
+	worker := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &worker))
+	lead := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(900, 0), "USD"), Name: "lead"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &lead))
+	employee := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "Vik", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
+	testTable := []struct {
+		name     string
+		id       string
+		query    string
+		expected int
+		resp     string
+		details  map[string]interface{}
+	}{
+		{
+			name:     "restrict by default",
+			id:       worker.ID.String(),
+			expected: 409,
+			resp:     problemText(409, "position_used", "position is used"),
+			details:  map[string]interface{}{"employees": []interface{}{employee.ID.String()}},
+		},
+		{
+			name:     "unknown mode",
+			id:       worker.ID.String(),
+			query:    "?employees=orphan",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+			details: map[string]interface{}{
+				"parameter": "employees", "reason": "must be restrict, cascade or reassign",
+			},
+		},
+		{
+			name:     "reassign without a target",
+			id:       worker.ID.String(),
+			query:    "?employees=reassign",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+			details:  map[string]interface{}{"parameter": "reassign_to", "reason": "is required to reassign"},
+		},
+		{
+			name:     "target without reassign",
+			id:       worker.ID.String(),
+			query:    "?employees=cascade&reassign_to=" + lead.ID.String(),
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+			details:  map[string]interface{}{"parameter": "reassign_to", "reason": "only applies to employees=reassign"},
+		},
+		{
+			name:     "unknown target",
+			id:       worker.ID.String(),
+			query:    "?employees=reassign&reassign_to=" + uuid.New().String(),
+			expected: 400,
+			resp:     problemText(400, "position_not_exists", "position is not exists"),
+		},
+		{
+			name:     "reassign",
+			id:       worker.ID.String(),
+			query:    "?employees=reassign&reassign_to=" + lead.ID.String(),
+			expected: 200,
+			resp:     `{"id":"00000000-0000-0000-0000-000000000000","name":"","salary":{"amount":"0","currency":""},"version":0}`,
+		},
+		{
+			name:     "cascade",
+			id:       lead.ID.String(),
+			query:    "?employees=cascade",
+			expected: 200,
+			resp:     `{"id":"00000000-0000-0000-0000-000000000000","name":"","salary":{"amount":"0","currency":""},"version":0}`,
+		},
+	}
+	for _, testCase := range testTable {
+		r := httptest.NewRequest("DELETE", "/position/"+testCase.id+testCase.query, nil)
+		r = createTestContext(mux.SetURLVars(r, map[string]string{"id": testCase.id}))
+		w := httptest.NewRecorder()
+		handler.DeletePosition(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.name)
+		if testCase.details != nil {
+			var p problem.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, testCase.details, p.Details, testCase.name)
+		}
+		if testCase.name == "reassign" {
+			moved, err := repos.GetEmployeeByID(context.Background(), employee.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, lead.ID, moved.PositionID)
+		}
+	}
+	assert.Empty(t, untrashedEmployees(data.GetEmployees()), "the cascade deleted the reassigned employee")
+}
+
 func TestHand_GetEmployeeVarsZero(t *testing.T) {
 	initTest()
 	posID := createPosID()
-	position := internal.Position{ID: posID, Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&position)
+	position := internal.Position{ID: posID, Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
 	employee := internal.Employee{ID: createEmpID(), FirstName: "Vik", LasName: "Vok", PositionID: posID}
-	repos.AddEmployee(&employee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -490,10 +629,10 @@ func TestHand_GetEmployeeVarsZero(t *testing.T) {
 func TestHand_GetEmployee(t *testing.T) {
 	initTest()
 	posID := createPosID()
-	position := internal.Position{ID: posID, Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&position)
+	position := internal.Position{ID: posID, Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
 	employee := internal.Employee{ID: createEmpID(), FirstName: "Vik", LasName: "Vok", PositionID: posID}
-	repos.AddEmployee(&employee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -541,8 +680,8 @@ func TestHand_GetEmployee(t *testing.T) {
 
 func TestHand_GetPositionVarsZero(t *testing.T) {
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -555,7 +694,7 @@ func TestHand_GetPositionVarsZero(t *testing.T) {
 			method:     "GET",
 			positionID: positionIDs[0],
 			expected:   400,
-			resp:       "bad request\n",
+			resp:       problemText(400, "bad_request", "bad request"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -573,15 +712,14 @@ func TestHand_GetPositionVarsZero(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		bodyString := string(bodyBytes)
-		assert.Equal(t, testCase.resp, bodyString)
+		assert.Equal(t, testCase.resp, responseText(bodyBytes))
 	}
 }
 
 func TestHand_GetPosition(t *testing.T) {
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	testTable := []struct {
 		URL        string
 		method     string
@@ -594,21 +732,21 @@ func TestHand_GetPosition(t *testing.T) {
 			method:     "GET",
 			positionID: positionIDs[0],
 			expected:   200,
-			resp:       "{\"id\":\"" + positionIDs[0] + "\",\"name\":\"worker\",\"salary\":\"500\"}",
+			resp:       "{\"id\":\"" + positionIDs[0] + "\",\"name\":\"worker\",\"salary\":{\"amount\":\"500\",\"currency\":\"USD\"},\"version\":1}",
 		},
 		{
 			URL:        "http://localhost:8080/position/" + uuid.New().String(),
 			method:     "Get",
 			positionID: uuid.New().String(),
 			expected:   404,
-			resp:       "not found\n",
+			resp:       problemText(404, "not_found", "not found"),
 		},
 		{
 			URL:        "http://localhost:8080/position/" + "12",
 			method:     "Get",
 			positionID: "12",
 			expected:   400,
-			resp:       "bad request\n",
+			resp:       problemText(400, "bad_request", "bad request"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -629,7 +767,7 @@ func TestHand_GetPosition(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		assert.Equal(t, testCase.resp, string(s))
+		assert.Equal(t, testCase.resp, responseText(s))
 	}
 }
 
@@ -645,31 +783,39 @@ func TestHand_GetEmployees(t *testing.T) { //nolint:funlen
 			URL:      "http://localhost:8080/employees?limit=1&offset=1",
 			method:   "GET",
 			expected: 200,
-			resp:     "[]",
+			resp: "{\"paging\":{\"skip\":0,\"limit\":1,\"count\":0,\"total\":0,\"has_more\":false}," +
+				"\"links\":{\"self\":\"/employees?limit=1\\u0026offset=1\"},\"data\":[]}",
+		},
+		{
+			URL:      "http://localhost:8080/employees",
+			method:   "GET",
+			expected: 200,
+			resp: "{\"paging\":{\"skip\":0,\"limit\":10,\"count\":0,\"total\":0,\"has_more\":false}," +
+				"\"links\":{\"self\":\"/employees?limit=10\\u0026offset=1\"},\"data\":[]}",
 		},
 		{
 			URL:      "http://localhost:8080/employees?limit=asd&offset=1",
 			method:   "GET",
-			expected: 500,
-			resp:     "strconv.Atoi: parsing \"asd\": invalid syntax\n",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 		{
 			URL:      "http://localhost:8080/employees?limit=1&offset=asd",
 			method:   "GET",
-			expected: 500,
-			resp:     "strconv.Atoi: parsing \"asd\": invalid syntax\n",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 		{
 			URL:      "http://localhost:8080/employees?limit=1&offset=3",
 			method:   "GET",
 			expected: 404,
-			resp:     "not found\n",
+			resp:     problemText(404, "not_found", "not found"),
 		},
 		{
 			URL:      "http://localhost:8080/employees?limit=110&offset=3",
 			method:   "GET",
 			expected: 400,
-			resp:     "bad request\n",
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 	}
 
@@ -688,7 +834,7 @@ func TestHand_GetEmployees(t *testing.T) { //nolint:funlen
 		if err != nil {
 			t.Error(err)
 		}
-		assert.Equal(t, testCase.resp, string(s))
+		assert.Equal(t, testCase.resp, responseText(s))
 	}
 }
 
@@ -704,25 +850,33 @@ func TestHand_GetPositions(t *testing.T) {
 			URL:      "http://localhost:8080/positions?limit=1&offset=1",
 			method:   "GET",
 			expected: 200,
-			resp:     "[]",
+			resp: "{\"paging\":{\"skip\":0,\"limit\":1,\"count\":0,\"total\":0,\"has_more\":false}," +
+				"\"links\":{\"self\":\"/positions?limit=1\\u0026offset=1\"},\"data\":[]}",
+		},
+		{
+			URL:      "http://localhost:8080/positions",
+			method:   "GET",
+			expected: 200,
+			resp: "{\"paging\":{\"skip\":0,\"limit\":10,\"count\":0,\"total\":0,\"has_more\":false}," +
+				"\"links\":{\"self\":\"/positions?limit=10\\u0026offset=1\"},\"data\":[]}",
 		},
 		{
 			URL:      "http://localhost:8080/positions?limit=asd&offset=1",
 			method:   "GET",
-			expected: 500,
-			resp:     "strconv.Atoi: parsing \"asd\": invalid syntax\n",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 		{
 			URL:      "http://localhost:8080/positions?limit=1&offset=asd",
 			method:   "GET",
-			expected: 500,
-			resp:     "strconv.Atoi: parsing \"asd\": invalid syntax\n",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 		{
 			URL:      "http://localhost:8080/positions?limit=110&offset=3",
 			method:   "GET",
 			expected: 400,
-			resp:     "bad request\n",
+			resp:     problemText(400, "bad_request", "bad request"),
 		},
 	}
 
@@ -741,21 +895,21 @@ func TestHand_GetPositions(t *testing.T) {
 		if err != nil {
 			t.Error(err)
 		}
-		assert.Equal(t, testCase.resp, string(s))
+		assert.Equal(t, testCase.resp, responseText(s))
 	}
 }
 
 func TestHand_UpdateEmployee(t *testing.T) { //nolint: funlen
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	id, err := uuid.Parse(positionIDs[0])
 	if err != nil {
 		t.Fatalf("Error: %v ", err)
 	}
 	firstEmployee := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "Vik", PositionID: id}
 	firstEmployeeID := firstEmployee.ID
-	repos.AddEmployee(&firstEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmployee))
 	secondEmployee := internal.Employee{ID: firstEmployeeID, FirstName: "Victor", LasName: "Vik", PositionID: id}
 	thirdEmployee := internal.Employee{ID: createEmpID(), FirstName: "Fox", LasName: "Fok", PositionID: uuid.New()}
 	fourthEmployee := internal.Employee{ID: uuid.Nil, FirstName: "", LasName: "Fok", PositionID: uuid.New()}
@@ -790,35 +944,35 @@ func TestHand_UpdateEmployee(t *testing.T) { //nolint: funlen
 			expected: 200,
 			read:     reader,
 			resp: "{\"ID\":\"" + employeeIDs[0] + "\",\"first_name\":\"Victor\",\"las_name\":\"Vik\"," +
-				"\"position_id\":\"" + positionIDs[0] + "\"}", //nolint:lll
+				"\"position_id\":\"" + positionIDs[0] + "\",\"version\":2}", //nolint:lll
 		},
 		{
 			URL:      "http://localhost:8080/employee",
 			method:   "PUT",
-			expected: 500,
+			expected: 400,
 			read:     strings.NewReader("s"),
-			resp:     "invalid character 's' looking for beginning of value\n",
+			resp:     problemText(400, "parse_error", "parse error"),
 		},
 		{
 			URL:      "http://localhost:8080/employee",
 			method:   "PUT",
 			expected: 404,
 			read:     strings.NewReader(string(jsonThirdEmployee)),
-			resp:     "not found\n",
+			resp:     problemText(404, "not_found", "not found"),
 		},
 		{
 			URL:      "localhost:8080/employee",
 			method:   "PUT",
-			expected: 400,
+			expected: 422,
 			read:     strings.NewReader(string(jsonFourthEmployee)),
-			resp:     "bad request\n",
+			resp:     problemText(422, "validation_failed", "validation failed: 2 fields are invalid"),
 		},
 		{
 			URL:      "http://localhost:8080/employee",
 			method:   "PUT",
 			expected: 400,
 			read:     strings.NewReader(string(jsonFifthEmployee)),
-			resp:     "position is not exists\n",
+			resp:     problemText(400, "position_not_exists", "position is not exists"),
 		},
 	}
 	for _, testCase := range testTable {
@@ -837,18 +991,18 @@ func TestHand_UpdateEmployee(t *testing.T) { //nolint: funlen
 		if err != nil {
 			t.Error(err)
 		}
-		assert.Equal(t, testCase.resp, string(s))
+		assert.Equal(t, testCase.resp, responseText(s))
 	}
 }
 
 func TestHand_UpdatePosition(t *testing.T) { //nolint:funlen
 	initTest()
-	firstPosition := internal.Position{ID: createPosID(), Salary: decimal.New(500, 0), Name: "worker"}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	firstID := firstPosition.ID
-	secondPosition := internal.Position{ID: firstID, Salary: decimal.New(1000, 0), Name: "worker"}
-	fakePosition := internal.Employee{ID: uuid.Nil, FirstName: "V", LasName: "T", PositionID: uuid.Nil}
-	fakeSecondPosition := internal.Employee{ID: createEmpID(), FirstName: "V", LasName: "T", PositionID: uuid.Nil}
+	secondPosition := internal.Position{ID: firstID, Salary: internal.NewMoney(decimal.New(1000, 0), "USD"), Name: "worker"}
+	fakePosition := internal.Position{ID: uuid.Nil, Salary: internal.NewMoney(decimal.New(1000, 0), "USD"), Name: "worker"}
+	fakeSecondPosition := internal.Position{ID: uuid.New(), Salary: internal.NewMoney(decimal.New(1000, 0), "USD"), Name: "worker"}
 	jsonSecondPosition, _ := json.Marshal(secondPosition)
 	jsonFakePosition, _ := json.Marshal(fakePosition)
 	jsonFakeSecondPosition, _ := json.Marshal(fakeSecondPosition)
@@ -863,30 +1017,30 @@ func TestHand_UpdatePosition(t *testing.T) { //nolint:funlen
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "PUT",
-			expected: 500,
+			expected: 400,
 			read:     strings.NewReader("s"),
-			resp:     "invalid character 's' looking for beginning of value\n",
+			resp:     problemText(400, "parse_error", "parse error"),
 		},
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "PUT",
-			expected: 400,
+			expected: 422,
 			read:     reader,
-			resp:     "bad request\n",
+			resp:     problemText(422, "validation_failed", "validation failed: id is required"),
 		},
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "PUT",
 			expected: 404,
 			read:     strings.NewReader(string(jsonFakeSecondPosition)),
-			resp:     "not found\n",
+			resp:     problemText(404, "not_found", "not found"),
 		},
 		{
 			URL:      "http://localhost:8080/position",
 			method:   "PUT",
 			expected: 200,
 			read:     strings.NewReader(string(jsonSecondPosition)),
-			resp:     "{\"id\":\"" + positionIDs[0] + "\",\"name\":\"worker\",\"salary\":\"1000\"}",
+			resp:     "{\"id\":\"" + positionIDs[0] + "\",\"name\":\"worker\",\"salary\":{\"amount\":\"1000\",\"currency\":\"USD\"},\"version\":2}",
 		},
 	}
 	for _, testCase := range testTable {
@@ -905,6 +1059,1323 @@ func TestHand_UpdatePosition(t *testing.T) { //nolint:funlen
 		if err != nil {
 			t.Error(err)
 		}
-		assert.Equal(t, testCase.resp, string(s))
+		assert.Equal(t, testCase.resp, responseText(s))
+	}
+}
+
+func TestHand_GetPositionsCursor(t *testing.T) {
+	initTest()
+	for i := 0; i < 3; i++ {
+		p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(int64(500+i), 0), "USD"), Name: "worker"}
+		if err := repos.AddPosition(context.Background(), &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	url := "http://localhost:8080/positions?cursor=&limit=2"
+	ids := make([]string, 0)
+	for url != "" {
+		r, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.GetPositions(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		var body struct {
+			Data       []internal.Position `json:"data"`
+			NextCursor string              `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range body.Data {
+			ids = append(ids, p.ID.String())
+		}
+		url = ""
+		if body.NextCursor != "" {
+			url = "http://localhost:8080/positions?limit=2&cursor=" + body.NextCursor
+		}
+	}
+	assert.Len(t, ids, 3)
+	assert.True(t, sort.StringsAreSorted(ids))
+}
+
+func TestHand_GetEmployeesCursor(t *testing.T) {
+	initTest()
+	testTable := []struct {
+		URL      string
+		expected int
+		resp     string
+	}{
+		{
+			URL:      "http://localhost:8080/employees?cursor=",
+			expected: 200,
+			resp:     "{\"data\":[]}",
+		},
+		{
+			URL:      "http://localhost:8080/employees?cursor=&limit=asd",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+		},
+		{
+			URL:      "http://localhost:8080/employees?cursor=***",
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+		},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("GET", testCase.URL, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.GetEmployees(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, testCase.expected, result.StatusCode)
+		s, err := ioutil.ReadAll(result.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		assert.Equal(t, testCase.resp, responseText(s))
+	}
+}
+
+func TestHand_GetPositionsEnvelope(t *testing.T) {
+	initTest()
+	for i := 0; i < 5; i++ {
+		p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(int64(500+i), 0), "USD"), Name: "worker"}
+		if err := repos.AddPosition(context.Background(), &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTable := []struct {
+		URL      string
+		expected listResponse
+		count    int
+	}{
+		{
+			URL: "http://localhost:8080/positions?limit=2",
+			expected: listResponse{
+				Paging: paging{Skip: 0, Limit: 2, Count: 2, Total: 5, HasMore: true},
+				Links:  links{Self: "/positions?limit=2&offset=1", Next: "/positions?limit=2&offset=2"},
+			},
+			count: 2,
+		},
+		{
+			URL: "http://localhost:8080/positions?offset=2&limit=2",
+			expected: listResponse{
+				Paging: paging{Skip: 2, Limit: 2, Count: 2, Total: 5, HasMore: true},
+				Links: links{
+					Self: "/positions?limit=2&offset=2",
+					Next: "/positions?limit=2&offset=3",
+					Prev: "/positions?limit=2&offset=1",
+				},
+			},
+			count: 2,
+		},
+		{
+			URL: "http://localhost:8080/positions?offset=3&limit=2",
+			expected: listResponse{
+				Paging: paging{Skip: 4, Limit: 2, Count: 1, Total: 5, HasMore: false},
+				Links:  links{Self: "/positions?limit=2&offset=3", Prev: "/positions?limit=2&offset=2"},
+			},
+			count: 1,
+		},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("GET", testCase.URL, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.GetPositions(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		var body struct {
+			Paging paging              `json:"paging"`
+			Links  links               `json:"links"`
+			Data   []internal.Position `json:"data"`
+		}
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, testCase.expected.Paging, body.Paging)
+		assert.Equal(t, testCase.expected.Links, body.Links)
+		assert.Len(t, body.Data, testCase.count)
+	}
+}
+
+func TestHand_GetPositionsFiltered(t *testing.T) {
+	initTest()
+	for i, name := range []string{"worker", "lead", "senior worker"} {
+		p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(int64(500*(i+1)), 0), "USD"), Name: name}
+		if err := repos.AddPosition(context.Background(), &p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTable := []struct {
+		URL      string
+		expected int
+		names    []string
+	}{
+		{URL: "http://localhost:8080/positions?name_contains=WORK&sort=-salary", expected: 200,
+			names: []string{"senior worker", "worker"}},
+		{URL: "http://localhost:8080/positions?salary_min=1000&salary_max=1500&sort=name", expected: 200,
+			names: []string{"lead", "senior worker"}},
+		{URL: "http://localhost:8080/positions?salary_min=abc", expected: 400},
+		{URL: "http://localhost:8080/positions?sort=first_name", expected: 400},
+		{URL: "http://localhost:8080/positions?cursor=&sort=-id", expected: 400},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("GET", testCase.URL, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.GetPositions(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, testCase.expected, result.StatusCode)
+		if testCase.expected != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Data []internal.Position `json:"data"`
+		}
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(body.Data))
+		for _, p := range body.Data {
+			names = append(names, p.Name)
+		}
+		assert.Equal(t, testCase.names, names)
+	}
+}
+
+func TestHand_GetEmployeesFiltered(t *testing.T) {
+	initTest()
+	p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	if err := repos.AddPosition(context.Background(), &p); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Bob", "bobby", "Nick"} {
+		e := internal.Employee{ID: createEmpID(), FirstName: name, LasName: "Vik", PositionID: p.ID}
+		if err := repos.AddEmployee(context.Background(), &e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTable := []struct {
+		URL      string
+		expected int
+		count    int
+	}{
+		{URL: "http://localhost:8080/employees?first_name_prefix=bob&position_id=" + p.ID.String(), expected: 200, count: 2},
+		{URL: "http://localhost:8080/employees?position_id=" + uuid.New().String(), expected: 200, count: 0},
+		{URL: "http://localhost:8080/employees?position_id=abc", expected: 400},
+		{URL: "http://localhost:8080/employees?sort=salary", expected: 400},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("GET", testCase.URL, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.GetEmployees(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, testCase.expected, result.StatusCode)
+		if testCase.expected != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Data []internal.Employee `json:"data"`
+		}
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, body.Data, testCase.count)
+	}
+}
+
+func TestHand_Search(t *testing.T) {
+	initTest()
+	p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "Développeur"}
+	if err := repos.AddPosition(context.Background(), &p); err != nil {
+		t.Fatal(err)
+	}
+	e := internal.Employee{ID: createEmpID(), FirstName: "Dev", LasName: "Vik", PositionID: p.ID}
+	if err := repos.AddEmployee(context.Background(), &e); err != nil {
+		t.Fatal(err)
+	}
+	testTable := []struct {
+		URL      string
+		expected int
+		types    []string
+	}{
+		{URL: "http://localhost:8080/search?q=dev", expected: 200, types: []string{"employee", "position"}},
+		{URL: "http://localhost:8080/search?q=developpeur", expected: 200, types: []string{"position"}},
+		{URL: "http://localhost:8080/search?q=nobody", expected: 200, types: []string{}},
+		{URL: "http://localhost:8080/search", expected: 400},
+		{URL: "http://localhost:8080/search?q=dev&limit=asd", expected: 400},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("GET", testCase.URL, nil)
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		r = createTestContext(r)
+		w := httptest.NewRecorder()
+		handler.Search(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, testCase.expected, result.StatusCode)
+		if testCase.expected != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Data []internal.SearchResult `json:"data"`
+		}
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		types := make([]string, 0, len(body.Data))
+		for _, r := range body.Data {
+			types = append(types, r.Type)
+		}
+		assert.Equal(t, testCase.types, types)
+	}
+}
+
+func TestAuthHand_Auth(t *testing.T) {
+	users := auth.NewUsers()
+	if err := users.Add("admin", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	tokens := auth.NewHS256([]byte("secret"), time.Hour)
+	h := NewAuthHandler(users, tokens)
+	testTable := []struct {
+		body     string
+		expected int
+	}{
+		{body: `{"login": "admin", "password": "secret"}`, expected: 200},
+		{body: `{"login": "admin", "password": "wrong"}`, expected: 401},
+		{body: `{"login": "nobody", "password": "secret"}`, expected: 401},
+		{body: `{"login": "admin"}`, expected: 400},
+		{body: `{`, expected: 400},
+	}
+	for _, testCase := range testTable {
+		r, err := http.NewRequest("POST", "http://localhost:8080/auth", strings.NewReader(testCase.body))
+		if err != nil {
+			t.Fatalf("error: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.Auth(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		assert.Equal(t, testCase.expected, result.StatusCode)
+		if testCase.expected != http.StatusOK {
+			continue
+		}
+		var body tokenResponse
+		if err := json.NewDecoder(result.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "Bearer", body.TokenType)
+		assert.Equal(t, 3600, body.ExpiresIn)
+		claims, err := tokens.Validate(body.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", claims.Subject)
+	}
+}
+
+func TestStatusFor(t *testing.T) {
+	testTable := []struct {
+		err    error
+		status int
+	}{
+		{err: errs.BadRequest(), status: 400},
+		{err: errs.ParseError(), status: 400},
+		{err: parseError(fmt.Errorf("unexpected EOF")), status: 400},
+		{err: errs.PositionIsNotExists(), status: 400},
+		{err: errs.Unauthorized(), status: 401},
+		{err: &errs.PermissionError{Permission: "positions:delete"}, status: 403},
+		{err: errs.NotFound(), status: 404},
+		{err: errs.PositionIsExists(), status: 409},
+		{err: errs.EmployeeIsExists(), status: 409},
+		{err: errs.PositionIsUsed(), status: 409},
+		{err: fmt.Errorf("get position: %w", errs.NotFound()), status: 404},
+		{err: errs.StatusInternalServerError(), status: 500},
+		{err: errs.LogError(), status: 500},
+		{err: context.DeadlineExceeded, status: 504},
+		{err: context.Canceled, status: 504},
+		{err: fmt.Errorf("disk on fire"), status: 500},
+	}
+	for _, testCase := range testTable {
+		assert.Equal(t, testCase.status, statusFor(testCase.err), testCase.err.Error())
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	testTable := []struct {
+		err      error
+		expected problem.Problem
+	}{
+		{
+			err:      errs.Unauthorized(),
+			expected: problem.Problem{Status: 401, Code: "unauthorized", Detail: "unauthorized"},
+		},
+		{
+			err: &errs.PermissionError{Permission: "positions:delete", Roles: []string{"viewer"}},
+			expected: problem.Problem{
+				Status:  403,
+				Code:    "forbidden",
+				Detail:  "forbidden: missing permission positions:delete",
+				Details: map[string]interface{}{"permission": "positions:delete", "roles": []interface{}{"viewer"}},
+			},
+		},
+		{
+			err:      fmt.Errorf("disk on fire"),
+			expected: problem.Problem{Status: 500, Code: "internal_error"},
+		},
+	}
+	for _, testCase := range testTable {
+		r := createTestContext(httptest.NewRequest("DELETE", "/position/1", nil))
+		w := httptest.NewRecorder()
+		writeError(w, r, testCase.err)
+		assert.Equal(t, testCase.expected.Status, w.Code)
+		assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		var body problem.Problem
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "/position/1", body.Instance)
+		assert.Equal(t, r.Context().Value("correlation_id"), body.CorrelationID)
+		body.Type, body.Title, body.Instance, body.CorrelationID = "", "", "", ""
+		assert.Equal(t, testCase.expected, body)
+	}
+}
+
+// failingService fails every call with err.
+type failingService struct {
+	err error
+}
+
+func (s failingService) CreatePosition(context.Context, *internal.Position) (string, error) {
+	return "", s.err
+}
+
+func (s failingService) CreateEmployee(context.Context, *internal.Employee) (string, error) {
+	return "", s.err
+}
+
+func (s failingService) GetPositions(
+	context.Context, internal.PositionFilter, int, int,
+) ([]internal.Position, int, error) {
+	return nil, 0, s.err
+}
+
+func (s failingService) GetEmployees(
+	context.Context, internal.EmployeeFilter, int, int,
+) ([]internal.Employee, int, error) {
+	return nil, 0, s.err
+}
+
+func (s failingService) GetPositionsPage(
+	context.Context, internal.PositionFilter, string, int,
+) ([]internal.Position, string, error) {
+	return nil, "", s.err
+}
+
+func (s failingService) GetEmployeesPage(
+	context.Context, internal.EmployeeFilter, string, int,
+) ([]internal.Employee, string, error) {
+	return nil, "", s.err
+}
+
+func (s failingService) Search(context.Context, string, int) ([]internal.SearchResult, error) {
+	return nil, s.err
+}
+
+func (s failingService) PositionsChanged(context.Context) (time.Time, error) {
+	return time.Time{}, s.err
+}
+
+func (s failingService) EmployeesChanged(context.Context) (time.Time, error) {
+	return time.Time{}, s.err
+}
+
+func (s failingService) GetPosition(context.Context, string) (internal.Position, error) {
+	return internal.Position{}, s.err
+}
+
+func (s failingService) GetEmployee(context.Context, string) (internal.Employee, error) {
+	return internal.Employee{}, s.err
+}
+
+func (s failingService) DeletePosition(context.Context, string, internal.PositionDeletion) error {
+	return s.err
+}
+
+func (s failingService) DeleteEmployee(context.Context, string) error {
+	return s.err
+}
+
+func (s failingService) UpdatePosition(context.Context, *internal.Position) error {
+	return s.err
+}
+
+func (s failingService) UpdateEmployee(context.Context, *internal.Employee) error {
+	return s.err
+}
+
+func (s failingService) GetAudit(context.Context, internal.AuditFilter, string, int) ([]internal.AuditEntry, string, error) {
+	return nil, "", s.err
+}
+
+func (s failingService) GetTrash(context.Context) (internal.Trash, error) {
+	return internal.Trash{}, s.err
+}
+
+func (s failingService) RestorePosition(context.Context, string) (internal.Position, error) {
+	return internal.Position{}, s.err
+}
+
+func (s failingService) RestoreEmployee(context.Context, string) (internal.Employee, error) {
+	return internal.Employee{}, s.err
+}
+
+func (s failingService) GetSalaryHistory(context.Context, string) ([]internal.SalaryRecord, error) {
+	return nil, s.err
+}
+
+func (s failingService) ScheduleSalary(context.Context, string, *internal.SalaryRecord) error {
+	return s.err
+}
+
+func TestHand_ErrorStatus(t *testing.T) { //nolint:funlen
+	position := `{"name":"worker","salary":{"amount":1000,"currency":"USD"}}`
+	employee := fmt.Sprintf(`{"first_name":"a","las_name":"b","position_id":"%s"}`, uuid.New())
+	updatedPosition := fmt.Sprintf(`{"id":"%s","name":"worker","salary":{"amount":1000,"currency":"USD"}}`, uuid.New())
+	updatedEmployee := fmt.Sprintf(
+		`{"ID":"%s","first_name":"a","las_name":"b","position_id":"%s"}`, uuid.New(), uuid.New(),
+	)
+	salary := `{"amount":1000,"effective_from":"2100-01-01T00:00:00Z"}`
+	id := map[string]string{"id": uuid.New().String()}
+	endpoints := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		vars   map[string]string
+		serve  func(h *Hand) http.HandlerFunc
+	}{
+		{"CreatePosition", "POST", "/position", position, nil, func(h *Hand) http.HandlerFunc { return h.CreatePosition }},
+		{"CreateEmployee", "POST", "/employee", employee, nil, func(h *Hand) http.HandlerFunc { return h.CreateEmployee }},
+		{"GetPositions", "GET", "/positions", "", nil, func(h *Hand) http.HandlerFunc { return h.GetPositions }},
+		{"GetPositionsPage", "GET", "/positions?cursor=", "", nil, func(h *Hand) http.HandlerFunc { return h.GetPositions }},
+		{"GetEmployees", "GET", "/employees", "", nil, func(h *Hand) http.HandlerFunc { return h.GetEmployees }},
+		{"GetEmployeesPage", "GET", "/employees?cursor=", "", nil, func(h *Hand) http.HandlerFunc { return h.GetEmployees }},
+		{"Search", "GET", "/search?q=worker", "", nil, func(h *Hand) http.HandlerFunc { return h.Search }},
+		{
+			"GetPosition", "GET", "/position/1", "", map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.GetPosition },
+		},
+		{
+			"GetEmployee", "GET", "/employee/1", "", map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.GetEmployee },
+		},
+		{"UpdatePosition", "PUT", "/position", updatedPosition, nil, func(h *Hand) http.HandlerFunc { return h.UpdatePosition }},
+		{"UpdateEmployee", "PUT", "/employee", updatedEmployee, nil, func(h *Hand) http.HandlerFunc { return h.UpdateEmployee }},
+		{
+			"ReplacePosition", "PUT", "/position/1", position, id,
+			func(h *Hand) http.HandlerFunc { return h.ReplacePosition },
+		},
+		{
+			"ReplaceEmployee", "PUT", "/employee/1", employee, id,
+			func(h *Hand) http.HandlerFunc { return h.ReplaceEmployee },
+		},
+		{
+			"PatchPosition", "PATCH", "/position/1", `{"name":"boss"}`, map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.PatchPosition },
+		},
+		{
+			"PatchEmployee", "PATCH", "/employee/1", `{"las_name":"c"}`, map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.PatchEmployee },
+		},
+		{
+			"DeletePosition", "DELETE", "/position/1", "", map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.DeletePosition },
+		},
+		{
+			"DeleteEmployee", "DELETE", "/employee/1", "", map[string]string{"id": "1"},
+			func(h *Hand) http.HandlerFunc { return h.DeleteEmployee },
+		},
+		{"GetTrash", "GET", "/trash", "", nil, func(h *Hand) http.HandlerFunc { return h.GetTrash }},
+		{"GetAudit", "GET", "/audit", "", nil, func(h *Hand) http.HandlerFunc { return h.GetAudit }},
+		{
+			"RestorePosition", "POST", "/position/1/restore", "", id,
+			func(h *Hand) http.HandlerFunc { return h.RestorePosition },
+		},
+		{
+			"RestoreEmployee", "POST", "/employee/1/restore", "", id,
+			func(h *Hand) http.HandlerFunc { return h.RestoreEmployee },
+		},
+		{
+			"GetSalaryHistory", "GET", "/position/1/salary-history", "", id,
+			func(h *Hand) http.HandlerFunc { return h.GetSalaryHistory },
+		},
+		{
+			"ScheduleSalary", "POST", "/position/1/salary-history", salary, id,
+			func(h *Hand) http.HandlerFunc { return h.ScheduleSalary },
+		},
+	}
+	failures := []struct {
+		err    error
+		status int
+	}{
+		{errs.BadRequest(), 400},
+		{errs.PositionIsNotExists(), 400},
+		{errs.Unauthorized(), 401},
+		{&errs.PermissionError{Permission: "records:read"}, 403},
+		{errs.NotFound(), 404},
+		{&errs.ValidationError{Fields: []errs.FieldError{{Field: "name", Code: "required"}}}, 422},
+		{errs.PositionIsExists(), 409},
+		{errs.EmployeeIsExists(), 409},
+		{errs.PositionIsUsed(), 409},
+		{errs.PreconditionFailed(), 412},
+		{context.DeadlineExceeded, 504},
+		{fmt.Errorf("connection reset"), 500},
+	}
+	for _, e := range endpoints {
+		for _, f := range failures {
+			r := httptest.NewRequest(e.method, e.target, strings.NewReader(e.body))
+			r = createTestContext(r)
+			if e.vars != nil {
+				r = mux.SetURLVars(r, e.vars)
+			}
+			w := httptest.NewRecorder()
+			e.serve(NewHandler(failingService{err: f.err}, rates))(w, r)
+			assert.Equal(t, f.status, w.Code, "%s: %v", e.name, f.err)
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"), e.name)
+		}
+	}
+}
+
+func TestHand_ValidationErrors(t *testing.T) {
+	h := NewHandler(failingService{err: fmt.Errorf("must not be called")}, rates)
+	body := `{"name":" ","salary":{"amount":-1.005,"currency":"USD"},"colour":"red"}`
+	r := createTestContext(httptest.NewRequest("POST", "/position", strings.NewReader(body)))
+	w := httptest.NewRecorder()
+	h.CreatePosition(w, r)
+	assert.Equal(t, 422, w.Code)
+	var p problem.Problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field": "name", "code": "required", "message": "is required"},
+		map[string]interface{}{"field": "salary.amount", "code": "min", "message": "must be greater than 0"},
+		map[string]interface{}{"field": "colour", "code": "unknown", "message": "is not a known field"},
+	}, p.Details["errors"])
+}
+
+func TestHand_MalformedBody(t *testing.T) {
+	h := NewHandler(failingService{err: fmt.Errorf("must not be called")}, rates)
+	for name, serve := range map[string]http.HandlerFunc{
+		"CreatePosition": h.CreatePosition,
+		"CreateEmployee": h.CreateEmployee,
+		"UpdatePosition": h.UpdatePosition,
+		"UpdateEmployee": h.UpdateEmployee,
+	} {
+		r := createTestContext(httptest.NewRequest("POST", "/", strings.NewReader(`{"name":`)))
+		w := httptest.NewRecorder()
+		serve(w, r)
+		assert.Equal(t, 400, w.Code, name)
+		var body problem.Problem
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "parse_error", body.Code, name)
+	}
+}
+
+func TestHand_PatchPosition(t *testing.T) { //nolint:funlen
+	initTest()
+	position := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
+	id := position.ID.String()
+	testTable := []struct {
+		name        string
+		id          string
+		ifMatch     string
+		contentType string
+		body        string
+		expected    int
+		resp        string
+	}{
+		{
+			name:        "merge patch keeps the other fields",
+			contentType: "application/merge-patch+json",
+			body:        `{"salary":{"amount":750.5,"currency":"USD"}}`,
+			expected:    200,
+			resp:        `{"id":"` + id + `","name":"worker","salary":{"amount":"750.5","currency":"USD"},"version":2}`,
+		},
+		{
+			name:        "json patch",
+			contentType: "application/json-patch+json; charset=utf-8",
+			body:        `[{"op":"test","path":"/name","value":"worker"},{"op":"replace","path":"/name","value":"senior worker"}]`,
+			expected:    200,
+			resp:        `{"id":"` + id + `","name":"senior worker","salary":{"amount":"750.5","currency":"USD"},"version":3}`,
+		},
+		{
+			name:        "matching If-Match",
+			ifMatch:     `"3"`,
+			contentType: "application/merge-patch+json",
+			body:        `{"version":7}`,
+			expected:    200,
+			resp:        `{"id":"` + id + `","name":"senior worker","salary":{"amount":"750.5","currency":"USD"},"version":4}`,
+		},
+		{
+			name:        "stale If-Match",
+			ifMatch:     `"3"`,
+			contentType: "application/merge-patch+json",
+			body:        `{"name":"boss"}`,
+			expected:    412,
+			resp:        problemText(412, "precondition_failed", "precondition failed"),
+		},
+		{
+			name:        "failing test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"test","path":"/name","value":"worker"},{"op":"remove","path":"/salary"}]`,
+			expected:    409,
+			resp:        problemText(409, "patch_conflict", "patch cannot be applied"),
+		},
+		{
+			name:        "missing member",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/title","value":"boss"}]`,
+			expected:    409,
+			resp:        problemText(409, "patch_conflict", "patch cannot be applied"),
+		},
+		{
+			name:        "removing a required field",
+			contentType: "application/merge-patch+json",
+			body:        `{"name":null}`,
+			expected:    422,
+			resp:        problemText(422, "validation_failed", "validation failed: name is required"),
+		},
+		{
+			name:        "rules of create",
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"replace","path":"/salary/amount","value":0.001}]`,
+			expected:    422,
+			resp:        problemText(422, "validation_failed", "validation failed: salary must have no more decimal places than the currency has minor units"),
+		},
+		{
+			name:        "changing the id",
+			contentType: "application/merge-patch+json",
+			body:        `{"id":"` + uuid.New().String() + `"}`,
+			expected:    422,
+			resp:        problemText(422, "validation_failed", "validation failed: id cannot be changed"),
+		},
+		{
+			name:        "malformed patch",
+			contentType: "application/json-patch+json",
+			body:        `{"op":"remove"}`,
+			expected:    400,
+			resp:        problemText(400, "parse_error", "parse error"),
+		},
+		{
+			name:        "plain json",
+			contentType: "application/json",
+			body:        `{"name":"boss"}`,
+			expected:    415,
+			resp:        problemText(415, "unsupported_media_type", "unsupported media type"),
+		},
+		{
+			name:        "unknown position",
+			id:          uuid.New().String(),
+			contentType: "application/merge-patch+json",
+			body:        `{"name":"boss"}`,
+			expected:    404,
+			resp:        problemText(404, "not_found", "not found"),
+		},
+	}
+	for _, testCase := range testTable {
+		target := id
+		if testCase.id != "" {
+			target = testCase.id
+		}
+		r := httptest.NewRequest("PATCH", "/position/"+target, strings.NewReader(testCase.body))
+		r.Header.Set("Content-Type", testCase.contentType)
+		if testCase.ifMatch != "" {
+			r.Header.Set("If-Match", testCase.ifMatch)
+		}
+		r = mux.SetURLVars(createTestContext(r), map[string]string{"id": target})
+		w := httptest.NewRecorder()
+		handler.PatchPosition(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		if w.Code == http.StatusOK {
+			var p internal.Position
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+			assert.Equal(t, fmt.Sprintf(`"%d"`, p.Version), w.Header().Get("ETag"), testCase.name)
+		}
+		assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.name)
+	}
+	stored, err := repos.GetPositionByID(context.Background(), position.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "senior worker", stored.Name)
+	assert.True(t, decimal.RequireFromString("750.5").Equal(stored.Salary.Amount))
+}
+
+func TestHand_PatchEmployee(t *testing.T) {
+	initTest()
+	position := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
+	employee := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "Vik", PositionID: position.ID}
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
+	id := employee.ID.String()
+	for _, testCase := range []struct {
+		contentType string
+		body        string
+		expected    int
+		resp        string
+	}{
+		{
+			contentType: "application/merge-patch+json",
+			body:        `{"las_name":"Vikings"}`,
+			expected:    200,
+			resp: fmt.Sprintf(
+				`{"ID":"%s","first_name":"Bob","las_name":"Vikings","position_id":"%s","version":2}`, id, position.ID,
+			),
+		},
+		{
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"copy","from":"/first_name","path":"/las_name"}]`,
+			expected:    200,
+			resp: fmt.Sprintf(
+				`{"ID":"%s","first_name":"Bob","las_name":"Bob","position_id":"%s","version":3}`, id, position.ID,
+			),
+		},
+		{
+			contentType: "application/json-patch+json",
+			body:        `[{"op":"remove","path":"/ID"}]`,
+			expected:    422,
+			resp:        problemText(422, "validation_failed", "validation failed: ID cannot be changed"),
+		},
+	} {
+		r := httptest.NewRequest("PATCH", "/employee/"+id, strings.NewReader(testCase.body))
+		r.Header.Set("Content-Type", testCase.contentType)
+		r = mux.SetURLVars(createTestContext(r), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		handler.PatchEmployee(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.body)
+		assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.body)
+	}
+}
+
+func TestHand_ReplacePosition(t *testing.T) { //nolint:funlen
+	initTest()
+	position := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
+	id := position.ID.String()
+	testTable := []struct {
+		name     string
+		id       string
+		ifMatch  string
+		body     string
+		expected int
+		etag     string
+		resp     string
+	}{
+		{
+			name:     "without an ID in the body",
+			body:     `{"name":"lead","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 200,
+			etag:     `"2"`,
+			resp:     `{"id":"` + id + `","name":"lead","salary":{"amount":"700","currency":"USD"},"version":2}`,
+		},
+		{
+			name:     "matching If-Match and ID",
+			ifMatch:  `"2"`,
+			body:     `{"id":"` + id + `","name":"senior lead","salary":{"amount":700,"currency":"USD"},"version":9}`,
+			expected: 200,
+			etag:     `"3"`,
+			resp:     `{"id":"` + id + `","name":"senior lead","salary":{"amount":"700","currency":"USD"},"version":3}`,
+		},
+		{
+			name:     "stale If-Match",
+			ifMatch:  `"2"`,
+			body:     `{"name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 412,
+			resp:     problemText(412, "precondition_failed", "precondition failed"),
+		},
+		{
+			name:     "weak If-Match",
+			ifMatch:  `W/"3"`,
+			body:     `{"name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 412,
+			resp:     problemText(412, "precondition_failed", "precondition failed"),
+		},
+		{
+			name:     "If-Match of a converted representation",
+			ifMatch:  `"3-EUR"`,
+			body:     `{"name":"chief","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 200,
+			etag:     `"4"`,
+			resp:     `{"id":"` + id + `","name":"chief","salary":{"amount":"700","currency":"USD"},"version":4}`,
+		},
+		{
+			name:     "any version",
+			ifMatch:  "*",
+			body:     `{"name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 200,
+			etag:     `"5"`,
+			resp:     `{"id":"` + id + `","name":"boss","salary":{"amount":"700","currency":"USD"},"version":5}`,
+		},
+		{
+			name:     "another ID in the body",
+			body:     `{"id":"` + uuid.New().String() + `","name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 422,
+			resp:     problemText(422, "validation_failed", "validation failed: id does not match the path"),
+		},
+		{
+			name:     "rules of create",
+			body:     `{"name":"boss"}`,
+			expected: 422,
+			resp:     problemText(422, "validation_failed", "validation failed: salary is required"),
+		},
+		{
+			name:     "unknown position",
+			id:       uuid.New().String(),
+			body:     `{"name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 404,
+			resp:     problemText(404, "not_found", "not found"),
+		},
+		{
+			name:     "malformed id",
+			id:       "12",
+			body:     `{"name":"boss","salary":{"amount":700,"currency":"USD"}}`,
+			expected: 400,
+			resp:     problemText(400, "bad_request", "bad request"),
+		},
+	}
+	for _, testCase := range testTable {
+		target := id
+		if testCase.id != "" {
+			target = testCase.id
+		}
+		r := httptest.NewRequest("PUT", "/position/"+target, strings.NewReader(testCase.body))
+		r.Header.Set("Content-Type", "application/json")
+		if testCase.ifMatch != "" {
+			r.Header.Set("If-Match", testCase.ifMatch)
+		}
+		r = mux.SetURLVars(createTestContext(r), map[string]string{"id": target})
+		w := httptest.NewRecorder()
+		handler.ReplacePosition(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		assert.Equal(t, testCase.etag, w.Header().Get("ETag"), testCase.name)
+		assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.name)
+	}
+}
+
+func TestHand_ReplaceEmployee(t *testing.T) {
+	initTest()
+	position := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
+	employee := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "Vik", PositionID: position.ID}
+	assert.NoError(t, repos.AddEmployee(context.Background(), &employee))
+	id := employee.ID.String()
+	body := fmt.Sprintf(`{"first_name":"Bob","las_name":"Vikings","position_id":"%s"}`, position.ID)
+	for _, testCase := range []struct {
+		ifMatch  string
+		expected int
+		resp     string
+	}{
+		{
+			ifMatch:  `"1"`,
+			expected: 200,
+			resp: fmt.Sprintf(
+				`{"ID":"%s","first_name":"Bob","las_name":"Vikings","position_id":"%s","version":2}`, id, position.ID,
+			),
+		},
+		{
+			ifMatch:  `"1"`,
+			expected: 412,
+			resp:     problemText(412, "precondition_failed", "precondition failed"),
+		},
+		{
+			ifMatch:  `"1", "2"`,
+			expected: 412,
+			resp:     problemText(412, "precondition_failed", "precondition failed"),
+		},
+	} {
+		r := httptest.NewRequest("PUT", "/employee/"+id, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("If-Match", testCase.ifMatch)
+		r = mux.SetURLVars(createTestContext(r), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		handler.ReplaceEmployee(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.ifMatch)
+		assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.ifMatch)
+	}
+
+	r := httptest.NewRequest("GET", "/employee/"+id, nil)
+	r = mux.SetURLVars(createTestContext(r), map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	handler.GetEmployee(w, r)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+}
+
+func TestHand_ConditionalGet(t *testing.T) { //nolint:funlen
+	initTest()
+	position := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	assert.NoError(t, repos.AddPosition(context.Background(), &position))
+	id := position.ID.String()
+	get := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		r = mux.SetURLVars(createTestContext(r), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		if target == "/positions" {
+			handler.GetPositions(w, r)
+		} else {
+			handler.GetPosition(w, r)
+		}
+		return w
+	}
+
+	for _, target := range []string{"/position/" + id, "/positions"} {
+		first := get(target, nil)
+		assert.Equal(t, 200, first.Code, target)
+		tag, modified := first.Header().Get("ETag"), first.Header().Get("Last-Modified")
+		assert.NotEmpty(t, tag, target)
+		assert.NotEmpty(t, modified, target)
+
+		for _, testCase := range []struct {
+			name     string
+			headers  map[string]string
+			expected int
+		}{
+			{name: "current tag", headers: map[string]string{"If-None-Match": tag}, expected: 304},
+			{name: "weak current tag", headers: map[string]string{"If-None-Match": `"0", W/` + tag}, expected: 304},
+			{name: "any tag", headers: map[string]string{"If-None-Match": "*"}, expected: 304},
+			{name: "other tag", headers: map[string]string{"If-None-Match": `"0"`}, expected: 200},
+			{name: "not modified since", headers: map[string]string{"If-Modified-Since": modified}, expected: 304},
+			{
+				name:     "modified since",
+				headers:  map[string]string{"If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"},
+				expected: 200,
+			},
+			{
+				name:     "tag takes precedence",
+				headers:  map[string]string{"If-None-Match": `"0"`, "If-Modified-Since": modified},
+				expected: 200,
+			},
+		} {
+			w := get(target, testCase.headers)
+			assert.Equal(t, testCase.expected, w.Code, target+": "+testCase.name)
+			assert.Equal(t, tag, w.Header().Get("ETag"), target+": "+testCase.name)
+			if testCase.expected == 304 {
+				assert.Empty(t, w.Body.String(), target+": "+testCase.name)
+			}
+		}
+	}
+
+	listTag := get("/positions", nil).Header().Get("ETag")
+	position.Name = "lead"
+	assert.NoError(t, repos.UpdatePosition(context.Background(), &position))
+	assert.Equal(t, 200, get("/position/"+id, map[string]string{"If-None-Match": `"1"`}).Code, "the record changed")
+	assert.Equal(t, 200, get("/positions", map[string]string{"If-None-Match": listTag}).Code, "the list changed")
+}
+
+func TestHand_Trash(t *testing.T) { //nolint:funlen
+	initTest()
+	p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	if err := repos.AddPosition(context.Background(), &p); err != nil {
+		t.Fatal(err)
+	}
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	if err := repos.AddEmployee(context.Background(), &e); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("DELETE", "/position/"+p.ID.String()+"?employees=cascade", nil)
+	r = createTestContext(mux.SetURLVars(r, map[string]string{"id": p.ID.String()}))
+	w := httptest.NewRecorder()
+	handler.DeletePosition(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	lists := []struct {
+		URL   string
+		code  int
+		count int
+	}{
+		{URL: "/employees", code: 200, count: 0},
+		{URL: "/employees?include_deleted=true", code: 200, count: 1},
+		{URL: "/employees?include_deleted=maybe", code: 400},
+	}
+	for _, testCase := range lists {
+		w := httptest.NewRecorder()
+		handler.GetEmployees(w, createTestContext(httptest.NewRequest("GET", testCase.URL, nil)))
+		assert.Equal(t, testCase.code, w.Code, testCase.URL)
+		if testCase.code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Data []internal.Employee `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body.Data, testCase.count, testCase.URL)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetTrash(w, createTestContext(httptest.NewRequest("GET", "/trash", nil)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var trash internal.Trash
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &trash))
+	assert.Len(t, trash.Positions, 1)
+	assert.Len(t, trash.Employees, 1)
+
+	restores := []struct {
+		name  string
+		id    string
+		serve http.HandlerFunc
+		code  int
+		resp  string
+	}{
+		{"position first", e.ID.String(), handler.RestoreEmployee, 400, problemText(400, "position_not_exists", "position is not exists")},
+		{"position", p.ID.String(), handler.RestorePosition, 200, ""},
+		{"employee", e.ID.String(), handler.RestoreEmployee, 200, ""},
+		{"twice", e.ID.String(), handler.RestoreEmployee, 404, problemText(404, "not_found", "not found")},
+		{"malformed", "abc", handler.RestoreEmployee, 400, problemText(400, "bad_request", "bad request")},
+	}
+	for _, testCase := range restores {
+		r := httptest.NewRequest("POST", "/employee/"+testCase.id+"/restore", nil)
+		r = createTestContext(mux.SetURLVars(r, map[string]string{"id": testCase.id}))
+		w := httptest.NewRecorder()
+		testCase.serve(w, r)
+		assert.Equal(t, testCase.code, w.Code, testCase.name)
+		if testCase.resp != "" {
+			assert.Equal(t, testCase.resp, responseText(w.Body.Bytes()), testCase.name)
+		} else {
+			assert.NotEmpty(t, w.Header().Get("ETag"), testCase.name)
+		}
+	}
+	restored, err := repos.GetEmployeeByID(context.Background(), e.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+}
+
+func TestHand_GetAudit(t *testing.T) {
+	initTest()
+	r := createTestContext(httptest.NewRequest("POST", "/position", nil))
+	p := internal.Position{Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	if _, err := serv.CreatePosition(r.Context(), &p); err != nil {
+		t.Fatal(err)
+	}
+	raise := internal.Position{ID: p.ID, Name: "worker", Salary: internal.NewMoney(decimal.New(700, 0), "USD")}
+	if err := serv.UpdatePosition(r.Context(), &raise); err != nil {
+		t.Fatal(err)
+	}
+	testTable := []struct {
+		URL    string
+		code   int
+		count  int
+		cursor bool
+	}{
+		{URL: "/audit", code: 200, count: 2},
+		{URL: "/audit?limit=1", code: 200, count: 1, cursor: true},
+		{URL: "/audit?entity=position&entity_id=" + p.ID.String(), code: 200, count: 2},
+		{URL: "/audit?entity=employee", code: 200, count: 0},
+		{URL: "/audit?from=2000-01-01T00:00:00Z&to=2001-01-01T00:00:00Z", code: 200, count: 0},
+		{URL: "/audit?entity_id=abc", code: 400},
+		{URL: "/audit?from=yesterday", code: 400},
+		{URL: "/audit?entity=salary", code: 400},
+	}
+	for _, testCase := range testTable {
+		w := httptest.NewRecorder()
+		handler.GetAudit(w, createTestContext(httptest.NewRequest("GET", testCase.URL, nil)))
+		assert.Equal(t, testCase.code, w.Code, testCase.URL)
+		if testCase.code != http.StatusOK {
+			continue
+		}
+		var body auditPage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Len(t, body.Data, testCase.count, testCase.URL)
+		assert.Equal(t, testCase.cursor, body.NextCursor != "", testCase.URL)
+	}
+}
+
+func TestHand_SalaryHistory(t *testing.T) {
+	initTest()
+	p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Name: "worker"}
+	if err := repos.AddPosition(context.Background(), &p); err != nil {
+		t.Fatal(err)
+	}
+	next := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	schedules := []struct {
+		name     string
+		id       string
+		body     string
+		code     int
+		currency string
+	}{
+		{"other currency", p.ID.String(), `{"amount":700,"currency":"EUR","effective_from":"` + next + `"}`, 201, "EUR"},
+		{"scheduled", p.ID.String(), `{"amount":700,"effective_from":"` + next + `"}`, 201, "EUR"},
+		{"back to the position's currency", p.ID.String(), `{"amount":700,"currency":"USD","effective_from":"` + next + `"}`, 201, "USD"},
+		{"past", p.ID.String(), `{"amount":700,"effective_from":"2000-01-01T00:00:00Z"}`, 422, ""},
+		{"beyond minor units", p.ID.String(), `{"amount":700.5,"currency":"JPY","effective_from":"` + next + `"}`, 422, ""},
+		{"bad currency", p.ID.String(), `{"amount":700,"currency":"euro","effective_from":"` + next + `"}`, 422, ""},
+		{"no amount", p.ID.String(), `{"effective_from":"` + next + `"}`, 422, ""},
+		{"missing", uuid.New().String(), `{"amount":700,"effective_from":"` + next + `"}`, 404, ""},
+	}
+	for _, testCase := range schedules {
+		r := httptest.NewRequest("POST", "/position/"+testCase.id+"/salary-history", strings.NewReader(testCase.body))
+		r = createTestContext(mux.SetURLVars(r, map[string]string{"id": testCase.id}))
+		w := httptest.NewRecorder()
+		handler.ScheduleSalary(w, r)
+		assert.Equal(t, testCase.code, w.Code, testCase.name)
+		if testCase.code != http.StatusCreated {
+			continue
+		}
+		var record internal.SalaryRecord
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+		assert.Equal(t, p.ID, record.PositionID, testCase.name)
+		assert.Equal(t, testCase.currency, record.Currency, testCase.name)
+	}
+
+	r := httptest.NewRequest("GET", "/position/"+p.ID.String()+"/salary-history", nil)
+	r = createTestContext(mux.SetURLVars(r, map[string]string{"id": p.ID.String()}))
+	w := httptest.NewRecorder()
+	handler.GetSalaryHistory(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body salaryHistory
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	if assert.Len(t, body.Data, 2) {
+		assert.True(t, body.Data[0].Amount.Equal(decimal.New(500, 0)))
+		assert.NotNil(t, body.Data[0].EffectiveTo)
+		assert.True(t, body.Data[1].Amount.Equal(decimal.New(700, 0)))
+		assert.Nil(t, body.Data[1].EffectiveTo)
+	}
+	stored, err := repos.GetPositionByID(context.Background(), p.ID)
+	assert.NoError(t, err)
+	assert.True(t, stored.Salary.Amount.Equal(decimal.New(500, 0)))
+}
+
+func TestHand_Currency(t *testing.T) {
+	initTest()
+	p := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.RequireFromString("1234.56"), "USD"), Name: "worker"}
+	if err := repos.AddPosition(context.Background(), &p); err != nil {
+		t.Fatal(err)
+	}
+	testTable := []struct {
+		name     string
+		query    string
+		roles    []string
+		expected int
+		salary   string
+		etag     string
+	}{
+		{"as stored", "", nil, 200, `{"amount":"1234.56","currency":"USD"}`, `"1"`},
+		{"same currency", "?currency=USD", nil, 200, `{"amount":"1234.56","currency":"USD"}`, `"1-USD"`},
+		{"rounded to cents", "?currency=EUR", nil, 200, `{"amount":"1135.8","currency":"EUR"}`, `"1-EUR"`},
+		{"rounded to yen", "?currency=JPY", nil, 200, `{"amount":"184567","currency":"JPY"}`, `"1-JPY"`},
+		{"not a code", "?currency=euro", nil, 400, "", ""},
+		{"no rate", "?currency=GBP", nil, 400, "", ""},
+		{"salary hidden", "?currency=GBP", []string{auth.RoleViewer}, 200, "", `"1-redacted"`},
+	}
+	for _, testCase := range testTable {
+		r := httptest.NewRequest("GET", "/position/"+p.ID.String()+testCase.query, nil)
+		r = createTestContext(mux.SetURLVars(r, map[string]string{"id": p.ID.String()}))
+		if testCase.roles != nil {
+			r = withRoles(r, testCase.roles...)
+		}
+		w := httptest.NewRecorder()
+		handler.GetPosition(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		var one map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &one), testCase.name)
+		if testCase.expected == http.StatusOK {
+			assert.Equal(t, testCase.salary, string(one["salary"]), testCase.name)
+			assert.Equal(t, testCase.etag, w.Header().Get("ETag"), testCase.name)
+			assert.Equal(t, "Authorization", w.Header().Get("Vary"), testCase.name)
+		} else {
+			assert.Contains(t, w.Body.String(), `"parameter":"currency"`, testCase.name)
+		}
+
+		r = createTestContext(httptest.NewRequest("GET", "/positions"+testCase.query, nil))
+		if testCase.roles != nil {
+			r = withRoles(r, testCase.roles...)
+		}
+		w = httptest.NewRecorder()
+		handler.GetPositions(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		var list struct {
+			Data []map[string]json.RawMessage `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list), testCase.name)
+		if testCase.expected == http.StatusOK && assert.Len(t, list.Data, 1, testCase.name) {
+			assert.Equal(t, testCase.salary, string(list.Data[0]["salary"]), testCase.name)
+		}
+	}
+	stored, err := repos.GetPositionByID(context.Background(), p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234.56 USD", stored.Salary.String(), "conversion leaves the stored salary alone")
+}
+
+func TestHand_CurrencyFilter(t *testing.T) {
+	initTest()
+	// 1000 EUR is 1086.96 USD, so lead earns more for the same amount.
+	worker := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(1000, 0), "USD"), Name: "worker"}
+	lead := internal.Position{ID: createPosID(), Salary: internal.NewMoney(decimal.New(1000, 0), "EUR"), Name: "lead"}
+	for _, p := range []*internal.Position{&worker, &lead} {
+		if err := repos.AddPosition(context.Background(), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testTable := []struct {
+		name     string
+		query    string
+		expected int
+		names    []string
+	}{
+		{"sorted in USD", "?sort=-salary", 200, []string{"lead", "worker"}},
+		{"sorted in EUR", "?sort=salary&currency=EUR", 200, []string{"worker", "lead"}},
+		{"lowest in USD", "?salary_min=1050", 200, []string{"lead"}},
+		{"highest in EUR", "?salary_max=950&currency=EUR", 200, []string{"worker"}},
+		{"cursor mode", "?salary_min=1050&cursor=", 200, []string{"lead"}},
+		{"no rate", "?sort=salary&currency=GBP", 400, nil},
+	}
+	for _, testCase := range testTable {
+		r := createTestContext(httptest.NewRequest("GET", "/positions"+testCase.query, nil))
+		w := httptest.NewRecorder()
+		handler.GetPositions(w, r)
+		assert.Equal(t, testCase.expected, w.Code, testCase.name)
+		if testCase.expected != http.StatusOK {
+			assert.Contains(t, w.Body.String(), `"parameter":"currency"`, testCase.name)
+			continue
+		}
+		var list struct {
+			Data []internal.Position `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list), testCase.name)
+		names := make([]string, 0, len(list.Data))
+		for _, p := range list.Data {
+			names = append(names, p.Name)
+		}
+		assert.Equal(t, testCase.names, names, testCase.name)
 	}
 }
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+// Defaults for the list endpoints when the query has no limit or offset.
+// offset is the number of the page, counting from one.
+const (
+	defaultPageLimit  = 10
+	defaultPageOffset = 1
+)
+
+type paging struct {
+	Skip    int  `json:"skip"`
+	Limit   int  `json:"limit"`
+	Count   int  `json:"count"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
+
+type links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+type listResponse struct {
+	Paging paging      `json:"paging"`
+	Links  links       `json:"links"`
+	Data   interface{} `json:"data"`
+}
+
+type page struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+func newListResponse(r *http.Request, data interface{}, count, total, limit, offset int) listResponse {
+	skip := limit * (offset - 1)
+	resp := listResponse{
+		Paging: paging{
+			Skip:    skip,
+			Limit:   limit,
+			Count:   count,
+			Total:   total,
+			HasMore: skip+count < total,
+		},
+		Links: links{Self: pageURL(r, limit, offset)},
+		Data:  data,
+	}
+	if resp.Paging.HasMore {
+		resp.Links.Next = pageURL(r, limit, offset+1)
+	}
+	if offset > 1 {
+		resp.Links.Prev = pageURL(r, limit, offset-1)
+	}
+	return resp
+}
+
+// pageURL returns the request path with the other query parameters kept and
+// limit and offset set to the given page.
+func pageURL(r *http.Request, limit, offset int) string {
+	q := r.URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	return r.URL.Path + "?" + q.Encode()
+}
+
+// queryInt parses the query parameter name, falling back to def when it is
+// absent or empty.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, queryError(name, err.Error())
+	}
+	return n, nil
+}
+
+// queryError is BadRequest for the query parameter name.
+func queryError(name, reason string) error {
+	return errors.WithDetails(errors.BadRequest(), map[string]interface{}{"parameter": name, "reason": reason})
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/patch"
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// PatchPosition serves PATCH /position/{id}: the merge patch or JSON Patch in
+// the body is applied to the stored position and the result has to pass the
+// same rules as a new position. The result is only stored over the version
+// the patch was applied to, so a concurrent update makes it fail with 412
+// rather than be lost; an If-Match header can name that version up front.
+func (h *Hand) PatchPosition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if len(vars) == 0 {
+		writeError(w, r, errors.BadRequest())
+		return
+	}
+	current, err := h.service.GetPosition(r.Context(), vars["id"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := checkVersion(r, current.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var p internal.Position
+	err = applyPatch(r, current, &p)
+	if err = keepID(err, "id", p.ID, current.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p.Version = current.Version
+	if err := h.service.UpdatePosition(r.Context(), &p); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setValidators(w, p.Version, p.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, shapePosition(r, p))
+}
+
+// PatchEmployee serves PATCH /employee/{id} like PatchPosition.
+func (h *Hand) PatchEmployee(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if len(vars) == 0 {
+		writeError(w, r, errors.BadRequest())
+		return
+	}
+	current, err := h.service.GetEmployee(r.Context(), vars["id"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := checkVersion(r, current.Version); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var e internal.Employee
+	err = applyPatch(r, current, &e)
+	if err = keepID(err, "ID", e.ID, current.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	e.Version = current.Version
+	if err := h.service.UpdateEmployee(r.Context(), &e); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setValidators(w, e.Version, e.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, e)
+}
+
+// applyPatch applies the patch in the body of r to current and decodes the
+// result into v with the rules of validate.Create.
+func applyPatch(r *http.Request, current, v interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	patched, err := patch.Apply(r.Header.Get("Content-Type"), doc, r.Body)
+	if err != nil {
+		return err
+	}
+	return validate.Decode(bytes.NewReader(patched), v, validate.Create)
+}
+
+// keepID adds a field error to err, the result of applyPatch, if the patch
+// changed or removed the ID.
+func keepID(err error, field string, got, want uuid.UUID) error {
+	if got == want {
+		return err
+	}
+	return addFieldError(err, errors.FieldError{Field: field, Code: "immutable", Message: "cannot be changed"})
+}
+
+// matchID adds a field error to err, the result of decoding a body, if the
+// body names an ID other than want, the one in the path.
+func matchID(err error, field string, got, want uuid.UUID) error {
+	if got == uuid.Nil || got == want {
+		return err
+	}
+	return addFieldError(err, errors.FieldError{Field: field, Code: "mismatch", Message: "does not match the path"})
+}
+
+// addFieldError adds fieldError to err unless err already reports the field.
+// Errors other than a ValidationError are returned unchanged.
+func addFieldError(err error, fieldError errors.FieldError) error {
+	field := fieldError.Field
+	if err == nil {
+		return &errors.ValidationError{Fields: []errors.FieldError{fieldError}}
+	}
+	invalid, ok := err.(*errors.ValidationError)
+	if !ok {
+		return err
+	}
+	for _, f := range invalid.Fields {
+		if f.Field == field {
+			return err
+		}
+	}
+	invalid.Fields = append(invalid.Fields, fieldError)
+	return err
+}
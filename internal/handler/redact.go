@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/middleware"
+)
+
+// redactedPosition marshals like internal.Position without the salary: the
+// outer Salary field shadows the embedded one and is always omitted, so
+// fields added to Position later still come through.
+type redactedPosition struct {
+	internal.Position
+	Salary *struct{} `json:"salary,omitempty"`
+}
+
+// redactedSearchResult marshals like internal.SearchResult with the position
+// redacted.
+type redactedSearchResult struct {
+	internal.SearchResult
+	Position *redactedPosition `json:"position,omitempty"`
+}
+
+// canReadSalary reports whether the roles stored by middleware.AuthMiddleware
+// allow reading salaries. Requests without roles see no salaries.
+func canReadSalary(r *http.Request) bool {
+	roles, _ := r.Context().Value(middleware.UserRoles).([]string)
+	return auth.Can(roles, auth.PermReadCompensation)
+}
+
+// shapePosition returns what the caller may see of p.
+func shapePosition(r *http.Request, p internal.Position) interface{} {
+	if canReadSalary(r) {
+		return p
+	}
+	return redactedPosition{Position: p}
+}
+
+// positionVariant names what sets the representation of a position r asks
+// for apart from the stored position; see etag.
+func positionVariant(r *http.Request) []string {
+	if !canReadSalary(r) {
+		return []string{"redacted"}
+	}
+	if currency, _ := queryCurrency(r); currency != "" {
+		return []string{currency}
+	}
+	return nil
+}
+
+// shapePositions returns what the caller may see of positions.
+func shapePositions(r *http.Request, positions []internal.Position) interface{} {
+	if canReadSalary(r) || positions == nil {
+		return positions
+	}
+	shaped := make([]redactedPosition, len(positions))
+	for i, p := range positions {
+		shaped[i] = redactedPosition{Position: p}
+	}
+	return shaped
+}
+
+// shapeSearchResults returns what the caller may see of results.
+func shapeSearchResults(r *http.Request, results []internal.SearchResult) interface{} {
+	if canReadSalary(r) || results == nil {
+		return results
+	}
+	shaped := make([]redactedSearchResult, len(results))
+	for i, result := range results {
+		shaped[i] = redactedSearchResult{SearchResult: result}
+		if result.Position != nil {
+			shaped[i].Position = &redactedPosition{Position: *result.Position}
+		}
+	}
+	return shaped
+}
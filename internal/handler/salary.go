@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/validate"
+)
+
+// GetSalaryHistory serves GET /position/{id}/salary-history with the salary
+// records of the position, oldest first.
+func (h *Hand) GetSalaryHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	records, err := h.service.GetSalaryHistory(r.Context(), id.String())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, page{Data: records})
+}
+
+// ScheduleSalary serves POST /position/{id}/salary-history, which schedules a
+// salary change of the position and replies with the new record.
+func (h *Hand) ScheduleSalary(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var record internal.SalaryRecord
+	if err := validate.Decode(r.Body, &record, validate.Create); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := h.service.ScheduleSalary(r.Context(), id.String(), &record); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, record)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	"github.com/NVTer/rest-api-example/internal"
 )
@@ -9,12 +10,27 @@ import (
 type Service interface {
 	CreatePosition(ctx context.Context, p *internal.Position) (string, error)
 	CreateEmployee(ctx context.Context, e *internal.Employee) (string, error)
-	GetPositions(ctx context.Context, limit, offset int) ([]internal.Position, error)
-	GetEmployees(ctx context.Context, limit, offset int) ([]internal.Employee, error)
+	GetPositions(ctx context.Context, f internal.PositionFilter, limit, offset int) ([]internal.Position, int, error)
+	GetEmployees(ctx context.Context, f internal.EmployeeFilter, limit, offset int) ([]internal.Employee, int, error)
+	GetPositionsPage(
+		ctx context.Context, f internal.PositionFilter, cursor string, limit int,
+	) ([]internal.Position, string, error)
+	GetEmployeesPage(
+		ctx context.Context, f internal.EmployeeFilter, cursor string, limit int,
+	) ([]internal.Employee, string, error)
+	Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error)
+	PositionsChanged(ctx context.Context) (time.Time, error)
+	EmployeesChanged(ctx context.Context) (time.Time, error)
 	GetPosition(ctx context.Context, id string) (internal.Position, error)
 	GetEmployee(ctx context.Context, id string) (internal.Employee, error)
-	DeletePosition(ctx context.Context, id string) error
+	DeletePosition(ctx context.Context, id string, d internal.PositionDeletion) error
 	DeleteEmployee(ctx context.Context, id string) error
 	UpdatePosition(ctx context.Context, p *internal.Position) error
 	UpdateEmployee(ctx context.Context, e *internal.Employee) error
+	GetTrash(ctx context.Context) (internal.Trash, error)
+	RestorePosition(ctx context.Context, id string) (internal.Position, error)
+	RestoreEmployee(ctx context.Context, id string) (internal.Employee, error)
+	GetAudit(ctx context.Context, f internal.AuditFilter, cursor string, limit int) ([]internal.AuditEntry, string, error)
+	GetSalaryHistory(ctx context.Context, id string) ([]internal.SalaryRecord, error)
+	ScheduleSalary(ctx context.Context, id string, r *internal.SalaryRecord) error
 }
@@ -0,0 +1,469 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/openapi"
+	"github.com/NVTer/rest-api-example/internal/patch"
+	"github.com/NVTer/rest-api-example/internal/problem"
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+)
+
+// Names of the routes, which name their operations in the OpenAPI document.
+const (
+	RouteAuth           = "auth"
+	RouteGetPositions   = "getPositions"
+	RouteGetEmployees   = "getEmployees"
+	RouteGetPosition    = "getPosition"
+	RouteGetEmployee    = "getEmployee"
+	RouteSearch         = "search"
+	RouteDeletePosition = "deletePosition"
+	RouteDeleteEmployee = "deleteEmployee"
+	RouteUpdatePosition = "updatePosition"
+	RouteUpdateEmployee = "updateEmployee"
+	RouteCreatePosition = "createPosition"
+	RouteCreateEmployee = "createEmployee"
+	RoutePatchPosition  = "patchPosition"
+	RoutePatchEmployee  = "patchEmployee"
+	// Replace routes are PUT /position/{id} and /employee/{id}.
+	RouteReplacePosition = "replacePosition"
+	RouteReplaceEmployee = "replaceEmployee"
+	// The trash holds deleted records until they are purged or restored.
+	RouteGetTrash        = "getTrash"
+	RouteRestorePosition = "restorePosition"
+	RouteRestoreEmployee = "restoreEmployee"
+	RouteGetAudit        = "getAudit"
+	// The salary history of a position is under /position/{id}/salary-history.
+	RouteGetSalaryHistory = "getSalaryHistory"
+	RouteScheduleSalary   = "scheduleSalary"
+)
+
+// The types below only describe bodies in the OpenAPI document; the handlers
+// build the same JSON from listResponse and page.
+
+type positions struct {
+	Paging paging              `json:"paging"`
+	Links  links               `json:"links"`
+	Data   []internal.Position `json:"data"`
+}
+
+type employees struct {
+	Paging paging              `json:"paging"`
+	Links  links               `json:"links"`
+	Data   []internal.Employee `json:"data"`
+}
+
+type positionsPage struct {
+	Data       []internal.Position `json:"data"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type employeesPage struct {
+	Data       []internal.Employee `json:"data"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+type auditPage struct {
+	Data       []internal.AuditEntry `json:"data"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+type salaryHistory struct {
+	Data []internal.SalaryRecord `json:"data"`
+}
+
+type searchResults struct {
+	Data []internal.SearchResult `json:"data"`
+}
+
+type created struct {
+	ID uuid.UUID `json:"id"`
+}
+
+// mergePatch is a JSON Merge Patch: the members to replace, null removing
+// one.
+type mergePatch map[string]interface{}
+
+type patchOperation struct {
+	Op    string      `json:"op" doc:"add, remove, replace, move, copy or test"`
+	Path  string      `json:"path" doc:"JSON Pointer to the member to change"`
+	From  string      `json:"from,omitempty" doc:"JSON Pointer to the member to move or copy"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// problemResponses describes the problem details replies.
+var problemResponses = map[int]string{ // nolint: gochecknoglobals
+	http.StatusBadRequest:   "Malformed body or bad parameter",
+	http.StatusUnauthorized: "Missing, invalid or expired bearer token",
+	http.StatusForbidden: "The roles of the caller do not allow this request; details carry the missing " +
+		"permission and the roles. viewer may list positions and employees; hr-editor may also read single " +
+		"records, search and create or update employees; admin may do everything, including changing " +
+		"salaries and deleting",
+	http.StatusNotFound:             "No such record or page",
+	http.StatusPreconditionFailed:   "If-Match does not name the current version; get the record again and redo the change",
+	http.StatusUnsupportedMediaType: "The body is not of a media type the operation takes",
+	http.StatusUnprocessableEntity:  "The body breaks validation rules; details.errors lists every invalid field",
+	http.StatusInternalServerError:  "Internal server error",
+}
+
+// responses adds the problem details replies with statuses to ok. A status
+// already in ok keeps its own description.
+func responses(ok map[int]openapi.Response, statuses ...int) map[int]openapi.Response {
+	for _, status := range statuses {
+		description := problemResponses[status]
+		if r, found := ok[status]; found {
+			description = r.Description
+		}
+		ok[status] = openapi.Response{Description: description, Body: problem.Problem{}, ContentType: problem.ContentType}
+	}
+	return ok
+}
+
+// Query parameters shared by several operations.
+// nolint: gochecknoglobals
+var (
+	idParameter     = openapi.Parameter{Name: "id", Schema: openapi3.NewUUIDSchema(), Required: true}
+	offsetParameter = openapi.Parameter{
+		Name:        "offset",
+		Description: "number of the page, counting from one",
+		Schema:      openapi3.NewIntegerSchema().WithMin(1).WithDefault(defaultPageOffset),
+	}
+	limitParameter = openapi.Parameter{
+		Name:        "limit",
+		Description: "max items to return",
+		Schema:      openapi3.NewIntegerSchema().WithMin(1).WithMax(100).WithDefault(defaultPageLimit),
+	}
+	cursorParameter = openapi.Parameter{
+		Name:        "cursor",
+		Description: "opaque cursor from next_cursor; an empty value starts cursor mode at the first page",
+		AllowEmpty:  true,
+	}
+	includeDeletedParameter = openapi.Parameter{
+		Name:        "include_deleted",
+		Description: "also list the records in the trash, which carry deleted_at",
+		Schema:      openapi3.NewBoolSchema().WithDefault(false),
+	}
+	currencyParameter = openapi.Parameter{
+		Name: "currency",
+		Description: "ISO 4217 code of the currency to show salaries in, converted at the configured exchange " +
+			"rates and rounded half away from zero to its minor units; a 400 names a currency without a rate. " +
+			"Writing a converted salary back changes the currency of the position",
+		Schema: openapi3.NewStringSchema().WithPattern("^[A-Z]{3}$"),
+	}
+	ifMatchParameter = openapi.Parameter{
+		Name:        "If-Match",
+		Description: "ETag of the version the change is based on; the change fails with 412 if the record has changed since",
+	}
+	ifNoneMatchParameter = openapi.Parameter{
+		Name:        "If-None-Match",
+		Description: "ETags of the copies the client holds; the reply is 304 without a body if one is current",
+	}
+	ifModifiedSinceParameter = openapi.Parameter{
+		Name:        "If-Modified-Since",
+		Description: "Last-Modified of the copy the client holds; ignored when If-None-Match is given",
+	}
+	conditionalParameters = []openapi.Parameter{ifNoneMatchParameter, ifModifiedSinceParameter}
+	recordHeaders         = map[string]string{
+		"ETag": "the version of the record, for If-Match and If-None-Match; a position shown with its salary " +
+			"converted or left out has the version followed by -<currency> or -redacted, which If-Match accepts too",
+		"Last-Modified": "when the record was last updated",
+	}
+	listHeaders = map[string]string{
+		"ETag":          "a hash of the body, for If-None-Match",
+		"Last-Modified": "when any record of the collection was last added, changed or deleted",
+	}
+)
+
+// Operations describes every route of the API, keyed by route name.
+func Operations() map[string]openapi.Operation { // nolint: funlen
+	decimalQuery := openapi3.NewStringSchema().WithFormat("decimal")
+	listDescription := "A page of the list, or a cursor page when the cursor parameter is given"
+	patchContent := openapi.Content{patch.MergePatch: mergePatch{}, patch.JSONPatch: []patchOperation{}}
+	patchConflict := "A JSON Patch operation cannot be applied, e.g. a test failed, or the result duplicates a record"
+	patchPrecondition := "If-Match does not name the current version, or the record changed while being patched"
+	notModified := func(headers map[string]string) openapi.Response {
+		return openapi.Response{Description: "The copy named by If-None-Match or If-Modified-Since is current", Headers: headers}
+	}
+	return map[string]openapi.Operation{
+		RouteAuth: {
+			Summary: "Exchange a login and password for a bearer token",
+			Public:  true,
+			Request: credentials{},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:           {Description: "The token", Body: tokenResponse{}},
+				http.StatusUnauthorized: {Description: "Unknown login or wrong password"},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusInternalServerError),
+		},
+		RouteGetPositions: {
+			Summary: "Return a page of positions",
+			Header:  conditionalParameters,
+			Query: []openapi.Parameter{
+				offsetParameter, limitParameter, cursorParameter,
+				{Name: "name_contains", Description: "case-insensitive substring of the name"},
+				{Name: "salary_min", Description: "lowest salary, inclusive, in the currency parameter or " + internal.DefaultCurrency + "; other currencies are converted to it", Schema: decimalQuery},
+				{Name: "salary_max", Description: "highest salary, inclusive, in the currency parameter or " + internal.DefaultCurrency + "; other currencies are converted to it", Schema: decimalQuery},
+				{
+					Name:        "sort",
+					Description: "comma-separated id, name, salary; a leading minus sorts descending; salary compares salaries like salary_min does",
+				},
+				includeDeletedParameter,
+				currencyParameter,
+			},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:          {Description: listDescription, Body: openapi.OneOf{positions{}, positionsPage{}}, Headers: listHeaders},
+				http.StatusNotModified: notModified(listHeaders),
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteGetEmployees: {
+			Summary: "Return a page of employees",
+			Header:  conditionalParameters,
+			Query: []openapi.Parameter{
+				offsetParameter, limitParameter, cursorParameter,
+				{Name: "position_id", Description: "only employees holding this position", Schema: openapi3.NewUUIDSchema()},
+				{Name: "first_name_prefix", Description: "case-insensitive prefix of the first name"},
+				{Name: "las_name_prefix", Description: "case-insensitive prefix of the last name"},
+				{
+					Name:        "sort",
+					Description: "comma-separated id, first_name, las_name, position_id; a leading minus sorts descending",
+				},
+				includeDeletedParameter,
+			},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:          {Description: listDescription, Body: openapi.OneOf{employees{}, employeesPage{}}, Headers: listHeaders},
+				http.StatusNotModified: notModified(listHeaders),
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteGetPosition: {
+			Summary: "Get a position",
+			Path:    []openapi.Parameter{idParameter},
+			Query:   []openapi.Parameter{currencyParameter},
+			Header:  conditionalParameters,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:          {Description: "The position", Body: internal.Position{}, Headers: recordHeaders},
+				http.StatusNotModified: notModified(recordHeaders),
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteGetEmployee: {
+			Summary: "Get an employee",
+			Path:    []openapi.Parameter{idParameter},
+			Header:  conditionalParameters,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:          {Description: "The employee", Body: internal.Employee{}, Headers: recordHeaders},
+				http.StatusNotModified: notModified(recordHeaders),
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteSearch: {
+			Summary: "Full-text search over employee names and position names",
+			Query: []openapi.Parameter{
+				{
+					Name:        "q",
+					Description: "words to look for; case and diacritics are ignored and every word also matches the words it begins",
+					Required:    true,
+				},
+				limitParameter,
+			},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "Matching records, best first", Body: searchResults{}},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError),
+		},
+		RouteDeletePosition: {
+			Summary: "Move a position to the trash",
+			Path:    []openapi.Parameter{idParameter},
+			Query: []openapi.Parameter{
+				{
+					Name: "employees",
+					Description: "what becomes of the employees holding the position: restrict refuses to delete it, " +
+						"cascade moves them to the trash too and reassign moves them to reassign_to",
+					Schema: openapi3.NewStringSchema().
+						WithEnum(internal.DeleteRestrict, internal.DeleteCascade, internal.DeleteReassign).
+						WithDefault(internal.DeleteRestrict),
+				},
+				{
+					Name:        "reassign_to",
+					Description: "the position to move the employees to; required by and only allowed with reassign",
+					Schema:      openapi3.NewUUIDSchema(),
+				},
+			},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "Deleted; the body is an empty position", Body: internal.Position{}},
+				http.StatusBadRequest: {
+					Description: "A malformed parameter, or reassign_to names no other existing position",
+				},
+				http.StatusConflict: {
+					Description: "The position is still held by employees, whose IDs details.employees lists",
+				},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusConflict, http.StatusInternalServerError),
+		},
+		RouteDeleteEmployee: {
+			Summary: "Move an employee to the trash",
+			Path:    []openapi.Parameter{idParameter},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "Deleted; the body is an empty employee", Body: internal.Employee{}},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteUpdatePosition: {
+			Summary:   "Replace the position with the ID in the body",
+			Header:    []openapi.Parameter{ifMatchParameter},
+			Request:   internal.Position{},
+			RequestOp: validate.Update,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The updated position", Body: internal.Position{}, Headers: recordHeaders},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteUpdateEmployee: {
+			Summary:   "Replace the employee with the ID in the body",
+			Header:    []openapi.Parameter{ifMatchParameter},
+			Request:   internal.Employee{},
+			RequestOp: validate.Update,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The updated employee", Body: internal.Employee{}, Headers: recordHeaders},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteReplacePosition: {
+			Summary:   "Replace a position; an ID in the body has to match the path",
+			Path:      []openapi.Parameter{idParameter},
+			Header:    []openapi.Parameter{ifMatchParameter},
+			Request:   internal.Position{},
+			RequestOp: validate.Create,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The updated position", Body: internal.Position{}, Headers: recordHeaders},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteReplaceEmployee: {
+			Summary:   "Replace an employee; an ID in the body has to match the path",
+			Path:      []openapi.Parameter{idParameter},
+			Header:    []openapi.Parameter{ifMatchParameter},
+			Request:   internal.Employee{},
+			RequestOp: validate.Create,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The updated employee", Body: internal.Employee{}, Headers: recordHeaders},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusPreconditionFailed, http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteCreatePosition: {
+			Summary:   "Create a position",
+			Request:   internal.Position{},
+			RequestOp: validate.Create,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusCreated:  {Description: "Created", Body: created{}},
+				http.StatusConflict: {Description: "A position with this name and salary already exists"},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict,
+				http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RoutePatchPosition: {
+			Summary: "Change some fields of a position; the result has to pass the rules of a new position",
+			Path:    []openapi.Parameter{idParameter},
+			Header:  []openapi.Parameter{ifMatchParameter},
+			Request: patchContent,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:                 {Description: "The patched position", Body: internal.Position{}, Headers: recordHeaders},
+				http.StatusConflict:           {Description: patchConflict},
+				http.StatusPreconditionFailed: {Description: patchPrecondition},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType,
+				http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RoutePatchEmployee: {
+			Summary: "Change some fields of an employee; the result has to pass the rules of a new employee",
+			Path:    []openapi.Parameter{idParameter},
+			Header:  []openapi.Parameter{ifMatchParameter},
+			Request: patchContent,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:                 {Description: "The patched employee", Body: internal.Employee{}, Headers: recordHeaders},
+				http.StatusConflict:           {Description: patchConflict},
+				http.StatusPreconditionFailed: {Description: patchPrecondition},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnsupportedMediaType,
+				http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteGetTrash: {
+			Summary: "Return the deleted records that have not been purged yet, the most recently deleted first",
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The trash", Body: internal.Trash{}},
+			}, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError),
+		},
+		RouteRestorePosition: {
+			Summary: "Take a position out of the trash",
+			Path:    []openapi.Parameter{idParameter},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:       {Description: "The restored position", Body: internal.Position{}, Headers: recordHeaders},
+				http.StatusNotFound: {Description: "No position with this ID is in the trash"},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteRestoreEmployee: {
+			Summary: "Take an employee out of the trash",
+			Path:    []openapi.Parameter{idParameter},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK:         {Description: "The restored employee", Body: internal.Employee{}, Headers: recordHeaders},
+				http.StatusBadRequest: {Description: "The employee's position is in the trash and has to be restored first"},
+				http.StatusNotFound:   {Description: "No employee with this ID is in the trash"},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteGetAudit: {
+			Summary: "Return a page of the audit trail of every change to positions and employees, newest first",
+			Query: []openapi.Parameter{
+				limitParameter,
+				{Name: "cursor", Description: "opaque cursor from next_cursor; leave it out for the newest entries"},
+				{
+					Name:        "entity",
+					Description: "only changes of this kind of record",
+					Schema:      openapi3.NewStringSchema().WithEnum(internal.EntityPosition, internal.EntityEmployee),
+				},
+				{Name: "entity_id", Description: "only changes of this record", Schema: openapi3.NewUUIDSchema()},
+				{Name: "actor", Description: "only changes made by this login"},
+				{Name: "from", Description: "only changes made at or after this time", Schema: openapi3.NewDateTimeSchema()},
+				{Name: "to", Description: "only changes made before this time", Schema: openapi3.NewDateTimeSchema()},
+			},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The entries; next_cursor is left out on the last page", Body: auditPage{}},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError),
+		},
+		RouteGetSalaryHistory: {
+			Summary: "Return the salary records of a position, oldest first; the one in effect sets its salary",
+			Path:    []openapi.Parameter{idParameter},
+			Responses: responses(map[int]openapi.Response{
+				http.StatusOK: {Description: "The salary records", Body: salaryHistory{}},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusInternalServerError),
+		},
+		RouteScheduleSalary: {
+			Summary: "Schedule a salary change of a position from a time in the future on, replacing a record " +
+				"that takes effect at the same time",
+			Path:      []openapi.Parameter{idParameter},
+			Request:   internal.SalaryRecord{},
+			RequestOp: validate.Create,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusCreated: {Description: "The scheduled record", Body: internal.SalaryRecord{}},
+				http.StatusUnprocessableEntity: {
+					Description: "The body breaks validation rules, effective_from is not in the future or " +
+						"amount has more decimal places than the currency; details.errors lists every invalid field",
+				},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+		RouteCreateEmployee: {
+			Summary:   "Create an employee",
+			Request:   internal.Employee{},
+			RequestOp: validate.Create,
+			Responses: responses(map[int]openapi.Response{
+				http.StatusCreated:  {Description: "Created", Body: created{}},
+				http.StatusConflict: {Description: "An employee with this name already exists"},
+			}, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict,
+				http.StatusUnprocessableEntity, http.StatusInternalServerError),
+		},
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/NVTer/rest-api-example/internal"
+)
+
+// trashResponse is internal.Trash with the positions shaped for the caller.
+type trashResponse struct {
+	Positions interface{}         `json:"positions"`
+	Employees []internal.Employee `json:"employees"`
+}
+
+// GetTrash serves GET /trash with the deleted records that have not been
+// purged yet, the most recently deleted first.
+func (h *Hand) GetTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.service.GetTrash(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, trashResponse{Positions: shapePositions(r, trash.Positions), Employees: trash.Employees})
+}
+
+// RestorePosition serves POST /position/{id}/restore, which takes the
+// position out of the trash and replies with it.
+func (h *Hand) RestorePosition(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p, err := h.service.RestorePosition(r.Context(), id.String())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setValidators(w, p.Version, p.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, shapePosition(r, p))
+}
+
+// RestoreEmployee serves POST /employee/{id}/restore like RestorePosition.
+func (h *Hand) RestoreEmployee(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	e, err := h.service.RestoreEmployee(r.Context(), id.String())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	setValidators(w, e.Version, e.UpdatedAt)
+	writeJSON(w, r, http.StatusOK, e)
+}
@@ -3,8 +3,12 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/problem"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 )
@@ -57,3 +61,47 @@ func IDMiddleware(logger logrus.FieldLogger) func(next http.Handler) http.Handle
 		})
 	}
 }
+
+const (
+	UserLogin = "user_login"
+	UserRoles = "user_roles"
+)
+
+// TokenValidator checks a bearer token and returns its claims.
+type TokenValidator interface {
+	Validate(token string) (auth.Claims, error)
+}
+
+// AuthMiddleware rejects requests without a valid bearer token with 401 and
+// stores the login and roles of the token subject in the request context.
+func AuthMiddleware(logger logrus.FieldLogger, tokens TokenValidator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			const prefix = "Bearer "
+			if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+				unauthorized(w, r)
+				return
+			}
+			claims, err := tokens.Validate(header[len(prefix):])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"type":        "auth",
+					"remote_addr": r.RemoteAddr,
+				}).Warn("invalid token")
+				unauthorized(w, r)
+				return
+			}
+			//revive:disable
+			ctx := context.WithValue(r.Context(), UserLogin, claims.Subject) //nolint:staticcheck
+			ctx = context.WithValue(ctx, UserRoles, claims.Roles)            //nolint:staticcheck
+			//revive:enable
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	problem.Write(w, r, http.StatusUnauthorized, errors.Unauthorized())
+}
@@ -1,12 +1,22 @@
 package middleware
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/openapi"
+	"github.com/NVTer/rest-api-example/internal/problem"
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 )
 
@@ -55,3 +65,202 @@ func testRequest(t *testing.T, req *http.Request, middleware func(next http.Hand
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestAuthMiddleware(t *testing.T) {
+	tokens := auth.NewHS256([]byte("secret"), time.Minute)
+	token, _, err := tokens.Issue(auth.User{Login: "admin", Roles: []string{auth.RoleViewer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := test.NewNullLogger()
+	testTable := []struct {
+		header   string
+		expected int
+	}{
+		{header: "Bearer " + token, expected: http.StatusOK},
+		{header: "bearer " + token, expected: http.StatusOK},
+		{header: "", expected: http.StatusUnauthorized},
+		{header: "Bearer ", expected: http.StatusUnauthorized},
+		{header: "Basic YWRtaW46c2VjcmV0", expected: http.StatusUnauthorized},
+		{header: "Bearer " + token + "x", expected: http.StatusUnauthorized},
+	}
+	for _, testCase := range testTable {
+		req := httptest.NewRequest("GET", "/", nil)
+		if testCase.header != "" {
+			req.Header.Set("Authorization", testCase.header)
+		}
+		w := httptest.NewRecorder()
+		r := mux.NewRouter()
+		r.Use(AuthMiddleware(logger, tokens))
+		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "admin", r.Context().Value(UserLogin))
+			assert.Equal(t, []string{auth.RoleViewer}, r.Context().Value(UserRoles))
+		})
+		r.ServeHTTP(w, req)
+		assert.Equal(t, testCase.expected, w.Code)
+		if testCase.expected == http.StatusUnauthorized {
+			assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+// testSpec describes a few routes of the API the way the handlers do.
+func testSpec(t *testing.T) *openapi3.T {
+	limit := openapi.Parameter{Name: "limit", Schema: openapi3.NewIntegerSchema().WithMin(1).WithMax(100)}
+	ok := map[int]openapi.Response{http.StatusOK: {Description: "ok", Body: internal.Position{}}}
+	ops := map[string]openapi.Operation{
+		"getPositions": {
+			Query: []openapi.Parameter{
+				limit,
+				{Name: "cursor", AllowEmpty: true},
+				{Name: "salary_min", Schema: openapi3.NewStringSchema().WithFormat("decimal")},
+			},
+			Responses: ok,
+		},
+		"getEmployees": {Query: []openapi.Parameter{limit}, Responses: ok},
+		"search":       {Query: []openapi.Parameter{{Name: "q", Required: true}}, Responses: ok},
+		"getPosition": {
+			Path:      []openapi.Parameter{{Name: "id", Schema: openapi3.NewUUIDSchema(), Required: true}},
+			Responses: ok,
+		},
+		"createPosition": {Request: internal.Position{}, RequestOp: validate.Create, Responses: ok},
+		"updateEmployee": {Request: internal.Employee{}, RequestOp: validate.Update, Responses: ok},
+	}
+	r := mux.NewRouter()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	r.HandleFunc("/positions", noop).Methods("GET").Name("getPositions")
+	r.HandleFunc("/employees", noop).Methods("GET").Name("getEmployees")
+	r.HandleFunc("/search", noop).Methods("GET").Name("search")
+	r.HandleFunc("/position/{id:\\S+}", noop).Methods("GET").Name("getPosition")
+	r.HandleFunc("/position", noop).Methods("POST").Name("createPosition")
+	r.HandleFunc("/employee", noop).Methods("PUT").Name("updateEmployee")
+	doc, err := openapi.Generate(r, "test", "1", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPIMiddleware(t *testing.T) { //nolint:funlen
+	doc := testSpec(t)
+	logger, _ := test.NewNullLogger()
+	validator, err := OpenAPIMiddleware(logger, doc, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTable := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		contentType string
+		status      int
+		code        string
+		fields      []interface{}
+	}{
+		{name: "valid body", method: "POST", target: "/position", body: `{"name":"worker","salary":{"amount":1000.5,"currency":"USD"}}`, status: 200},
+		{name: "salary as string", method: "POST", target: "/position", body: `{"name":"worker","salary":{"amount":"10","currency":"USD"}}`, status: 200},
+		{name: "valid query", method: "GET", target: "/positions?limit=5&salary_min=10.5", status: 200},
+		{name: "empty cursor", method: "GET", target: "/positions?cursor=", status: 200},
+		{name: "route not in spec", method: "GET", target: "/metrics", status: 200},
+		{name: "bad limit", method: "GET", target: "/positions?limit=abc", status: 400, code: "bad_request"},
+		{name: "limit too high", method: "GET", target: "/employees?limit=1000", status: 400, code: "bad_request"},
+		{name: "bad decimal", method: "GET", target: "/positions?salary_min=ten", status: 400, code: "bad_request"},
+		{name: "missing query", method: "GET", target: "/search", status: 400, code: "bad_request"},
+		{name: "bad id", method: "GET", target: "/position/42", status: 400, code: "bad_request"},
+		{name: "malformed body", method: "POST", target: "/position", body: `{"name":`, status: 400, code: "parse_error"},
+		{name: "missing body", method: "POST", target: "/position", status: 400, code: "parse_error"},
+		{
+			name:        "wrong media type",
+			method:      "POST",
+			target:      "/position",
+			body:        "name=worker",
+			contentType: "application/x-www-form-urlencoded",
+			status:      415,
+			code:        "unsupported_media_type",
+		},
+		{
+			name:   "invalid body",
+			method: "POST",
+			target: "/position",
+			body:   `{"name":5,"colour":"red"}`,
+			status: 422,
+			code:   "validation_failed",
+			fields: []interface{}{"colour:unknown", "name:type", "salary:required"},
+		},
+		{
+			name:   "update without id",
+			method: "PUT",
+			target: "/employee",
+			body:   `{"first_name":"Bob","las_name":"Vik","position_id":"6f1c2b8e-4a4e-4c1b-9d1c-2a7e0f6b1a11"}`,
+			status: 422,
+			code:   "validation_failed",
+			fields: []interface{}{"ID:required"},
+		},
+	}
+	for _, testCase := range testTable {
+		r := mux.NewRouter()
+		r.Use(validator)
+		r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		req := httptest.NewRequest(testCase.method, testCase.target, strings.NewReader(testCase.body))
+		if testCase.contentType != "" {
+			req.Header.Set("Content-Type", testCase.contentType)
+		} else if testCase.body != "" || testCase.method == "POST" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, testCase.status, w.Code, testCase.name)
+		if testCase.code == "" {
+			continue
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, testCase.code, p.Code, testCase.name)
+		if testCase.fields == nil {
+			continue
+		}
+		var fields []interface{}
+		for _, f := range p.Details["errors"].([]interface{}) {
+			f := f.(map[string]interface{})
+			fields = append(fields, f["field"].(string)+":"+f["code"].(string))
+		}
+		assert.Equal(t, testCase.fields, fields, testCase.name)
+	}
+}
+
+func TestOpenAPIMiddleware_Debug(t *testing.T) {
+	doc := testSpec(t)
+	logger, hook := test.NewNullLogger()
+	validator, err := OpenAPIMiddleware(logger, doc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for body, valid := range map[string]bool{
+		`{"id":"6f1c2b8e-4a4e-4c1b-9d1c-2a7e0f6b1a11","name":"worker","salary":{"amount":"10.5","currency":"USD"},"version":1,` +
+			`"created_at":"2022-05-01T10:00:00Z","updated_at":"2022-05-02T10:00:00.123456Z"}`: true,
+		`{"id":"6f1c2b8e-4a4e-4c1b-9d1c-2a7e0f6b1a11","title":"worker"}`: false,
+	} {
+		hook.Reset()
+		body := body
+		r := mux.NewRouter()
+		r.Use(validator)
+		r.HandleFunc("/position/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/position/6f1c2b8e-4a4e-4c1b-9d1c-2a7e0f6b1a11", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, body, w.Body.String())
+		if valid {
+			assert.Empty(t, hook.Entries, body)
+		} else {
+			assert.Len(t, hook.Entries, 1, body)
+			assert.Equal(t, logrus.ErrorLevel, hook.LastEntry().Level)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"bytes"
+	errs "errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/problem"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/sirupsen/logrus"
+)
+
+// OpenAPIMiddleware rejects requests that do not match the operation doc
+// describes for them. Malformed bodies and bad parameters are answered with
+// 400 and bodies that break the schema with 422 listing every invalid field.
+// Requests for routes doc does not describe are passed on untouched.
+//
+// doc comes from openapi.Generate, which also defines the uuid and decimal
+// formats its schemas use.
+//
+// In debug mode responses are checked too and every mismatch is logged; the
+// response itself is sent unchanged.
+//
+// Credentials are not checked here, that is left to AuthMiddleware.
+func OpenAPIMiddleware(
+	logger logrus.FieldLogger, doc *openapi3.T, debug bool,
+) (func(next http.Handler) http.Handler, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			input, ok := requestInput(router, r, options)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				err = requestError(err)
+				status := http.StatusBadRequest
+				if e, ok := errors.Lookup(err); ok {
+					status = e.Status()
+				}
+				problem.Write(w, r, status, err)
+				return
+			}
+			if !debug {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			err := openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 rec.status,
+				Header:                 rec.Header(),
+				Body:                   ioutil.NopCloser(bytes.NewReader(rec.body.Bytes())),
+				Options:                options,
+			})
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					CorrelationID: r.Context().Value(CorrelationID),
+					"method":      r.Method,
+					"path":        r.URL.Path,
+					"status":      rec.status,
+				}).WithError(err).Error("response does not match the OpenAPI document")
+			}
+		})
+	}, nil
+}
+
+// requestInput finds the operation for r. ok is false if doc has none.
+func requestInput(
+	router routers.Router, r *http.Request, options *openapi3filter.Options,
+) (*openapi3filter.RequestValidationInput, bool) {
+	route, params, err := router.FindRoute(r)
+	if err != nil {
+		return nil, false
+	}
+	return &openapi3filter.RequestValidationInput{
+		Request:    r,
+		PathParams: params,
+		Route:      route,
+		Options:    options,
+	}, true
+}
+
+// requestError turns what ValidateRequest found into the error the client
+// sees: a ParseError for a missing body or one that is not JSON, an
+// UnsupportedMediaType for a body of a media type the operation does not
+// take, a BadRequest naming the first bad parameter, or a
+// ValidationError listing every field of the body that breaks the schema.
+func requestError(err error) error {
+	var fieldErrors []errors.FieldError
+	for _, e := range flatten(err) {
+		var reqErr *openapi3filter.RequestError
+		if !errs.As(e, &reqErr) {
+			return errors.WithDetails(errors.BadRequest(), map[string]interface{}{"reason": e.Error()})
+		}
+		if reqErr.Parameter != nil {
+			return errors.WithDetails(errors.BadRequest(), map[string]interface{}{
+				"parameter": reqErr.Parameter.Name,
+				"reason":    reqErr.Error(),
+			})
+		}
+		if reqErr.Err == nil {
+			if strings.HasPrefix(reqErr.Reason, "header Content-Type has unexpected value") {
+				return errors.WithDetails(errors.UnsupportedMediaType(), map[string]interface{}{"reason": reqErr.Error()})
+			}
+			return errors.WithDetails(errors.BadRequest(), map[string]interface{}{"reason": reqErr.Error()})
+		}
+		before := len(fieldErrors)
+		for _, schemaErr := range flatten(reqErr.Err) {
+			if schemaErr, ok := schemaErr.(*openapi3.SchemaError); ok {
+				fieldErrors = appendFieldErrors(fieldErrors, nil, schemaErr)
+			}
+		}
+		if len(fieldErrors) == before {
+			return errors.WithDetails(errors.ParseError(), map[string]interface{}{"reason": reqErr.Error()})
+		}
+	}
+	sort.SliceStable(fieldErrors, func(i, j int) bool { return fieldErrors[i].Field < fieldErrors[j].Field })
+	return &errors.ValidationError{Fields: fieldErrors}
+}
+
+// appendFieldErrors describes err, found at path, with the codes the
+// validate package uses for the same rules. allOf only wraps the errors of
+// its parts, so those are reported instead.
+func appendFieldErrors(fieldErrors []errors.FieldError, path []string, err *openapi3.SchemaError) []errors.FieldError {
+	path = append(append([]string(nil), path...), err.JSONPointer()...)
+	if err.SchemaField == "allOf" {
+		for _, inner := range flatten(err.Origin) {
+			if inner, ok := inner.(*openapi3.SchemaError); ok {
+				fieldErrors = appendFieldErrors(fieldErrors, path, inner)
+			}
+		}
+		return fieldErrors
+	}
+	fe := errors.FieldError{Field: strings.Join(path, "."), Code: err.SchemaField, Message: err.Reason}
+	switch err.SchemaField {
+	case "required":
+		fe.Message = "is required"
+	case "maxLength":
+		fe.Code = "max_length"
+	case "properties":
+		var name string
+		if _, scanErr := fmt.Sscanf(err.Reason, "property %q is unsupported", &name); scanErr == nil {
+			fe.Field = strings.Join(append(path, name), ".")
+			fe.Code, fe.Message = "unknown", "is not a known field"
+		}
+	}
+	return append(fieldErrors, fe)
+}
+
+func flatten(err error) []error {
+	multi, ok := err.(openapi3.MultiError)
+	if !ok {
+		if err == nil {
+			return nil
+		}
+		return []error{err}
+	}
+	var out []error
+	for _, e := range multi {
+		out = append(out, flatten(e)...)
+	}
+	return out
+}
+
+// responseRecorder passes a response through and keeps a copy of its status
+// and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Money is an amount in a currency.
+type Money struct {
+	Amount   decimal.Decimal `json:"amount" validate:"required,gt=0"`
+	Currency string          `json:"currency" validate:"required,currency" doc:"ISO 4217 code"`
+}
+
+func NewMoney(amount decimal.Decimal, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Equal reports whether m and o are the same amount in the same currency.
+func (m Money) Equal(o Money) bool {
+	return m.Currency == o.Currency && m.Amount.Equal(o.Amount)
+}
+
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency
+}
+
+// Round rounds m to the minor units of its currency, half away from zero.
+func (m Money) Round() Money {
+	return Money{Amount: m.Amount.Round(MinorUnits(m.Currency)), Currency: m.Currency}
+}
+
+// Exact reports whether m has no more decimal places than its currency has
+// minor units.
+func (m Money) Exact() bool {
+	return m.Amount.Equal(m.Round().Amount)
+}
+
+// UnmarshalJSON reads the object Money marshals to. Positions stored before
+// they had a currency carry a bare amount, which is read in DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] != '{' {
+		m.Currency = DefaultCurrency
+		return json.Unmarshal(data, &m.Amount)
+	}
+	type plain Money
+	return json.Unmarshal(data, (*plain)(m))
+}
+
+// IsCurrencyCode reports whether code has the form of an ISO 4217 code,
+// three capital letters.
+func IsCurrencyCode(code string) bool {
+	return len(code) == 3 && strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+// minorUnits lists the ISO 4217 currencies whose minor unit is not a
+// hundredth.
+var minorUnits = map[string]int32{ //nolint:gochecknoglobals
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// MinorUnits returns the number of decimal places of the currency.
+func MinorUnits(currency string) int32 {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
@@ -0,0 +1,72 @@
+package openapi
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// swaggerUI holds the files of Swagger UI 4.15.5 the docs page loads, taken
+// from the swagger-ui-dist package, and its license.
+//
+//go:embed swagger-ui
+var swaggerUI embed.FS // nolint: gochecknoglobals
+
+// docsPage is the interactive documentation: Swagger UI, loaded from Assets,
+// showing the document at SpecURL.
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Assets}}swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.Assets}}swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`)) // nolint: gochecknoglobals
+
+// Handler replies with doc as JSON. The document is encoded once, up front.
+func Handler(doc *openapi3.T) (http.Handler, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write(body)
+	}), nil
+}
+
+// DocsHandler replies with a page browsing the document of doc served at
+// specURL, with the files of AssetsHandler served under assetsURL.
+func DocsHandler(doc *openapi3.T, specURL, assetsURL string) http.Handler {
+	data := struct {
+		Title   string
+		Assets  string
+		SpecURL string
+	}{Title: doc.Info.Title, Assets: assetsURL, SpecURL: specURL}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = docsPage.Execute(w, data)
+	})
+}
+
+// AssetsHandler serves the files of Swagger UI the docs page needs. Requests
+// name them relative to the root, so prefixes must be stripped first.
+func AssetsHandler() http.Handler {
+	assets, err := fs.Sub(swaggerUI, "swagger-ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(assets))
+}
@@ -0,0 +1,246 @@
+// Package openapi generates the OpenAPI document of the service from its
+// routes and the Go types of its bodies, so that the document cannot drift
+// from the code, and serves it together with interactive documentation.
+//
+// Every route is named and the name looks up the Operation describing it.
+// Bodies are described by example values of their types: struct fields are
+// read through their json tags, their validate tags become the rules of the
+// schema and a doc tag adds a description.
+package openapi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// ContentType is the media type of bodies that do not name one.
+const ContentType = "application/json"
+
+// securityScheme is the name of the bearer token scheme in the document.
+const securityScheme = "bearerAuth"
+
+// Parameter is a path, query or header parameter of an operation.
+type Parameter struct {
+	Name        string
+	Description string
+	Schema      *openapi3.Schema
+	Required    bool
+	// AllowEmpty accepts the parameter without a value, e.g. "?cursor=".
+	AllowEmpty bool
+}
+
+// Response is a reply of an operation. Body is a value of the type sent, or
+// nil for a reply without a body.
+type Response struct {
+	Description string
+	Body        interface{}
+	// ContentType defaults to ContentType.
+	ContentType string
+	// Headers describes the string headers of the reply by name.
+	Headers map[string]string
+}
+
+// Content is a body that may be sent as several media types, each with a
+// value of its own type.
+type Content map[string]interface{}
+
+// Operation describes the route of the same name.
+type Operation struct {
+	Summary string
+	// Public operations need no bearer token.
+	Public bool
+	// Path has to describe every variable of the route path.
+	Path   []Parameter
+	Query  []Parameter
+	Header []Parameter
+	// Request is a value of the type of the body, or a Content, read with
+	// the validate tags of RequestOp, or nil if the operation takes no body.
+	Request   interface{}
+	RequestOp validate.Op
+	Responses map[int]Response
+}
+
+// pathVariable matches a variable of a mux path template and its optional
+// pattern, e.g. "{id:\S+}".
+var pathVariable = regexp.MustCompile(`\{(\w+)(?::[^}]*)?\}`) // nolint: gochecknoglobals
+
+var defineFormats sync.Once // nolint: gochecknoglobals
+
+// Generate describes every route of router with the operation named like the
+// route and checks that the document is valid. A route without a name or an
+// operation, a path variable the operation does not describe and an
+// operation no route uses are errors.
+func Generate(router *mux.Router, title, version string, ops map[string]Operation) (*openapi3.T, error) {
+	DefineFormats()
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: title, Version: version},
+		Paths:   openapi3.Paths{},
+		Components: openapi3.Components{
+			Schemas: openapi3.Schemas{},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				securityScheme: &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+			},
+		},
+		Security: *openapi3.NewSecurityRequirements().With(openapi3.NewSecurityRequirement().Authenticate(securityScheme)),
+	}
+	s := &schemas{components: doc.Components.Schemas}
+	used := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		op, ok := ops[route.GetName()]
+		if !ok {
+			return fmt.Errorf("openapi: no operation describes %v %s", methods, template)
+		}
+		used[route.GetName()] = true
+		path := pathVariable.ReplaceAllString(template, "{$1}")
+		operation, err := op.describe(s, route.GetName(), template)
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			doc.AddOperation(path, method, operation)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range ops {
+		if !used[name] {
+			return nil, fmt.Errorf("openapi: no route is named %s", name)
+		}
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// DefineFormats makes the uuid and decimal string formats known to the
+// validation of kin-openapi. A value is checked by parsing it the same way
+// the handlers do.
+func DefineFormats() {
+	defineFormats.Do(func() {
+		openapi3.DefineStringFormatCallback("uuid", func(value string) error {
+			_, err := uuid.Parse(value)
+			return err
+		})
+		openapi3.DefineStringFormatCallback("decimal", func(value string) error {
+			_, err := decimal.NewFromString(value)
+			return err
+		})
+	})
+}
+
+// registerDecoder lets openapi3filter read bodies of JSON based media types
+// such as application/merge-patch+json as JSON.
+func registerDecoder(mediaType string) {
+	if strings.HasSuffix(mediaType, "+json") && openapi3filter.RegisteredBodyDecoder(mediaType) == nil {
+		openapi3filter.RegisterBodyDecoder(mediaType, openapi3filter.RegisteredBodyDecoder(ContentType))
+	}
+}
+
+// describe turns op, the operation of the route with path template, into its
+// part of the document.
+func (op Operation) describe(s *schemas, name, template string) (*openapi3.Operation, error) {
+	operation := openapi3.NewOperation()
+	operation.OperationID = name
+	operation.Summary = op.Summary
+	if op.Public {
+		operation.Security = openapi3.NewSecurityRequirements()
+	}
+	declared := map[string]Parameter{}
+	for _, p := range op.Path {
+		declared[p.Name] = p
+	}
+	for _, match := range pathVariable.FindAllStringSubmatch(template, -1) {
+		p, ok := declared[match[1]]
+		if !ok {
+			return nil, fmt.Errorf("openapi: %s does not describe the path variable %s", name, match[1])
+		}
+		delete(declared, match[1])
+		operation.AddParameter(p.parameter(openapi3.NewPathParameter(p.Name)))
+	}
+	for variable := range declared {
+		return nil, fmt.Errorf("openapi: %s describes %s, which is not in its path", name, variable)
+	}
+	for _, p := range op.Query {
+		operation.AddParameter(p.parameter(openapi3.NewQueryParameter(p.Name).WithRequired(p.Required)))
+	}
+	for _, p := range op.Header {
+		operation.AddParameter(p.parameter(openapi3.NewHeaderParameter(p.Name).WithRequired(p.Required)))
+	}
+	if op.Request != nil {
+		content, ok := op.Request.(Content)
+		if !ok {
+			content = Content{ContentType: op.Request}
+		}
+		body := openapi3.NewContent()
+		for mediaType, v := range content {
+			registerDecoder(mediaType)
+			body[mediaType] = openapi3.NewMediaType().WithSchemaRef(s.body(v, op.RequestOp))
+		}
+		operation.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).WithContent(body)}
+	}
+	if len(op.Responses) == 0 {
+		return nil, fmt.Errorf("openapi: %s has no responses", name)
+	}
+	statuses := make([]int, 0, len(op.Responses))
+	for status := range op.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	operation.Responses = openapi3.Responses{}
+	for _, status := range statuses {
+		r := op.Responses[status]
+		response := openapi3.NewResponse().WithDescription(r.Description)
+		if r.Body != nil {
+			contentType := r.ContentType
+			if contentType == "" {
+				contentType = ContentType
+			}
+			response.WithContent(openapi3.NewContentWithSchemaRef(s.body(r.Body, ""), []string{contentType}))
+		}
+		if len(r.Headers) > 0 {
+			response.Headers = openapi3.Headers{}
+		}
+		for name, description := range r.Headers {
+			header := openapi3.Header{Parameter: openapi3.Parameter{Description: description}}
+			header.Schema = openapi3.NewStringSchema().NewRef()
+			response.Headers[name] = &openapi3.HeaderRef{Value: &header}
+		}
+		operation.Responses[strconv.Itoa(status)] = &openapi3.ResponseRef{Value: response}
+	}
+	return operation, nil
+}
+
+// parameter fills in parameter, a new path, query or header parameter, from p.
+func (p Parameter) parameter(parameter *openapi3.Parameter) *openapi3.Parameter {
+	parameter.Description = p.Description
+	parameter.AllowEmptyValue = p.AllowEmpty
+	schema := p.Schema
+	if schema == nil {
+		schema = openapi3.NewStringSchema()
+	}
+	return parameter.WithSchema(schema)
+}
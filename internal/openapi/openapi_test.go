@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func noop(w http.ResponseWriter, r *http.Request) {}
+
+func positionRoutes() (*mux.Router, map[string]Operation) {
+	r := mux.NewRouter()
+	r.HandleFunc("/position/{id:\\S+}", noop).Methods("GET").Name("getPosition")
+	r.HandleFunc("/position", noop).Methods("POST").Name("createPosition")
+	r.HandleFunc("/position", noop).Methods("PUT").Name("updatePosition")
+	ok := map[int]Response{http.StatusOK: {
+		Description: "The position", Body: internal.Position{}, Headers: map[string]string{"ETag": "version"},
+	}}
+	return r, map[string]Operation{
+		"getPosition": {
+			Path:      []Parameter{{Name: "id", Schema: openapi3.NewUUIDSchema(), Required: true}},
+			Responses: ok,
+		},
+		"createPosition": {Request: internal.Position{}, RequestOp: validate.Create, Responses: ok},
+		"updatePosition": {
+			Header:    []Parameter{{Name: "If-Match"}},
+			Request:   internal.Position{},
+			RequestOp: validate.Update,
+			Public:    true,
+			Responses: ok,
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	r, ops := positionRoutes()
+	doc, err := Generate(r, "test", "1", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := doc.Paths.Find("/position/{id}").Get
+	if assert.NotNil(t, get) {
+		assert.Equal(t, "getPosition", get.OperationID)
+		assert.Equal(t, "path", get.Parameters.GetByInAndName("path", "id").In)
+		assert.Equal(t, "#/components/schemas/position", get.Responses.Get(http.StatusOK).Value.Content.Get("application/json").Schema.Ref)
+		assert.Nil(t, get.Security)
+		assert.Equal(t, "version", get.Responses.Get(http.StatusOK).Value.Headers["ETag"].Value.Description)
+	}
+	put := doc.Paths.Find("/position").Put
+	assert.NotNil(t, put.Security, "a public operation has its own, empty security")
+	assert.NotNil(t, put.Parameters.GetByInAndName("header", "If-Match"))
+
+	components := doc.Components.Schemas
+	assert.Equal(t, []string{"id", "name", "version", "created_at", "updated_at"}, components["position"].Value.Required,
+		"responses may leave the salary out")
+	assert.Equal(t, []string{"name", "salary"}, components["new_position"].Value.Required)
+	assert.Equal(t, []string{"id", "name", "salary"}, components["position_update"].Value.Required)
+	position := components["new_position"].Value
+	assert.False(t, *position.AdditionalPropertiesAllowed)
+	assert.Equal(t, uint64(100), *position.Properties["name"].Value.MaxLength)
+	assert.Equal(t, "uuid", position.Properties["id"].Value.Format)
+	assert.Equal(t, "date-time", position.Properties["updated_at"].Value.Format)
+	salary := position.Properties["salary"].Value
+	assert.Equal(t, "#/components/schemas/new_money", salary.AllOf[0].Ref)
+	assert.Contains(t, salary.Description, "minor units")
+	assert.Contains(t, salary.Description, "compensation:read")
+	money := components["new_money"].Value
+	assert.Equal(t, []string{"amount", "currency"}, money.Required)
+	amount := money.Properties["amount"].Value
+	assert.Equal(t, "#/components/schemas/decimal", amount.AllOf[0].Ref)
+	assert.Contains(t, amount.Description, "greater than 0")
+	assert.Contains(t, money.Properties["currency"].Value.Description, "ISO 4217")
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	for name, change := range map[string]func(r *mux.Router, ops map[string]Operation){
+		"route without operation": func(r *mux.Router, ops map[string]Operation) {
+			r.HandleFunc("/metrics", noop).Methods("GET")
+		},
+		"operation without route": func(r *mux.Router, ops map[string]Operation) {
+			ops["getMetrics"] = Operation{Responses: map[int]Response{http.StatusOK: {Description: "ok"}}}
+		},
+		"undescribed path variable": func(r *mux.Router, ops map[string]Operation) {
+			op := ops["getPosition"]
+			op.Path = nil
+			ops["getPosition"] = op
+		},
+		"path parameter not in path": func(r *mux.Router, ops map[string]Operation) {
+			op := ops["createPosition"]
+			op.Path = []Parameter{{Name: "id", Required: true}}
+			ops["createPosition"] = op
+		},
+		"no responses": func(r *mux.Router, ops map[string]Operation) {
+			op := ops["createPosition"]
+			op.Responses = nil
+			ops["createPosition"] = op
+		},
+	} {
+		r, ops := positionRoutes()
+		change(r, ops)
+		_, err := Generate(r, "test", "1", ops)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestComponentName(t *testing.T) {
+	assert.Equal(t, "position", componentName("Position", ""))
+	assert.Equal(t, "new_search_result", componentName("SearchResult", validate.Create))
+	assert.Equal(t, "employees_page_update", componentName("employeesPage", validate.Update))
+	assert.Equal(t, "", componentName("", validate.Create))
+}
@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/NVTer/rest-api-example/internal/validate"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// OneOf is a body that is one of several types, e.g. a list endpoint that
+// answers with a page or a cursor page.
+type OneOf []interface{}
+
+// nolint: gochecknoglobals
+var (
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	decimalType = reflect.TypeOf(decimal.Decimal{})
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// schemas turns Go types into schemas, adding every named struct to the
+// components of the document.
+type schemas struct {
+	components openapi3.Schemas
+}
+
+// body returns the schema of v, which may also be a OneOf.
+func (s *schemas) body(v interface{}, op validate.Op) *openapi3.SchemaRef {
+	if one, ok := v.(OneOf); ok {
+		schema := &openapi3.Schema{}
+		for _, item := range one {
+			schema.OneOf = append(schema.OneOf, s.body(item, op))
+		}
+		return schema.NewRef()
+	}
+	return s.of(reflect.TypeOf(v), op)
+}
+
+// of returns the schema of t. Named structs are referenced; their validate
+// tags are read for op, so the body of a create and of an update get
+// different components.
+func (s *schemas) of(t reflect.Type, op validate.Op) *openapi3.SchemaRef {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case uuidType:
+		return openapi3.NewUUIDSchema().NewRef()
+	case decimalType:
+		return s.decimal()
+	case timeType:
+		return openapi3.NewDateTimeSchema().NewRef()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return openapi3.NewStringSchema().NewRef()
+	case reflect.Bool:
+		return openapi3.NewBoolSchema().NewRef()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi3.NewIntegerSchema().NewRef()
+	case reflect.Float32, reflect.Float64:
+		return openapi3.NewFloat64Schema().NewRef()
+	case reflect.Slice, reflect.Array:
+		schema := openapi3.NewArraySchema()
+		schema.Items = s.of(t.Elem(), op)
+		return schema.NewRef()
+	case reflect.Map:
+		return openapi3.NewObjectSchema().WithAnyAdditionalProperties().NewRef()
+	case reflect.Struct:
+		return s.object(t, op)
+	case reflect.Interface:
+		return (&openapi3.Schema{Nullable: true}).NewRef()
+	}
+	return (&openapi3.Schema{}).NewRef()
+}
+
+// object returns the schema of the struct t, a reference to a component if
+// t is named.
+func (s *schemas) object(t reflect.Type, op validate.Op) *openapi3.SchemaRef {
+	name := componentName(t.Name(), op)
+	schema := openapi3.NewObjectSchema()
+	schema.AdditionalPropertiesAllowed = openapi3.BoolPtr(false)
+	if name != "" {
+		if component, ok := s.components[name]; ok {
+			return openapi3.NewSchemaRef("#/components/schemas/"+name, component.Value)
+		}
+		// Add the component before its fields so that a type referring to
+		// itself ends.
+		s.components[name] = schema.NewRef()
+	}
+	schema.Properties = openapi3.Schemas{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldName := validate.FieldName(field)
+		if fieldName == "" {
+			continue
+		}
+		property := s.of(field.Type, op)
+		// Responses always carry the fields that are neither omitempty nor
+		// tagged openapi:"optional"; what a request has to carry comes from
+		// the validate tags.
+		if op == "" && !omitEmpty(field) && field.Tag.Get("openapi") != "optional" {
+			schema.Required = append(schema.Required, fieldName)
+		}
+		var notes []string
+		for _, rule := range validate.Rules(field.Tag.Get("validate"), op) {
+			switch rule.Name {
+			case "required":
+				if op != "" {
+					schema.Required = append(schema.Required, fieldName)
+				}
+			case "max":
+				n, err := strconv.ParseUint(rule.Param, 10, 64)
+				if err == nil && property.Ref == "" {
+					property.Value.MaxLength = &n
+				}
+			default:
+				notes = append(notes, ruleDescription(rule))
+			}
+		}
+		if doc := field.Tag.Get("doc"); doc != "" {
+			notes = append(notes, doc)
+		}
+		if len(notes) > 0 {
+			property = describe(property, strings.Join(notes, "; "))
+		}
+		schema.Properties[fieldName] = property
+	}
+	if name == "" {
+		return schema.NewRef()
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, schema)
+}
+
+func omitEmpty(field reflect.StructField) bool {
+	for _, option := range strings.Split(field.Tag.Get("json"), ",")[1:] {
+		if option == "omitempty" {
+			return true
+		}
+	}
+	return false
+}
+
+// decimal is the schema of decimal.Decimal, which is read from a number or
+// a string and always written as a string.
+func (s *schemas) decimal() *openapi3.SchemaRef {
+	const name = "decimal"
+	if _, ok := s.components[name]; !ok {
+		schema := &openapi3.Schema{
+			Description: "a decimal number; responses always send it as a string",
+			OneOf: openapi3.SchemaRefs{
+				openapi3.NewFloat64Schema().NewRef(),
+				openapi3.NewStringSchema().WithFormat("decimal").NewRef(),
+			},
+		}
+		s.components[name] = schema.NewRef()
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+name, s.components[name].Value)
+}
+
+// describe adds a description to schema. A reference cannot carry one, so
+// it is wrapped in an allOf.
+func describe(schema *openapi3.SchemaRef, description string) *openapi3.SchemaRef {
+	if schema.Ref == "" {
+		schema.Value.Description = description
+		return schema
+	}
+	wrapper := &openapi3.Schema{AllOf: openapi3.SchemaRefs{schema}, Description: description}
+	return wrapper.NewRef()
+}
+
+func ruleDescription(rule validate.Rule) string {
+	switch rule.Name {
+	case "gt":
+		return "greater than " + rule.Param
+	case "scale":
+		return fmt.Sprintf("at most %s decimal places", rule.Param)
+	case "currency":
+		return "an ISO 4217 currency code"
+	case "exact":
+		return "no more decimal places than the currency has minor units"
+	}
+	return rule.Name + " " + rule.Param
+}
+
+// componentName names the component of a type: Position is "position" in
+// responses, "new_position" when created and "position_update" when
+// updated. Anonymous types are not components.
+func componentName(typeName string, op validate.Op) string {
+	if typeName == "" {
+		return ""
+	}
+	var b strings.Builder
+	for i, r := range typeName {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	name := b.String()
+	switch op {
+	case validate.Create:
+		return "new_" + name
+	case validate.Update:
+		return name + "_update"
+	}
+	return name
+}
@@ -0,0 +1,327 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902)
+// documents to the JSON of a record.
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+// Media types of the patch documents Apply understands.
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+// MediaTypes are the media types Apply understands.
+var MediaTypes = []string{MergePatch, JSONPatch} // nolint: gochecknoglobals
+
+// Apply reads a patch document of contentType from r and applies it to doc.
+// An unknown media type is UnsupportedMediaType, a patch that is not JSON or
+// not shaped like its media type a ParseError, and a JSON Patch operation
+// that cannot be carried out, e.g. a failing test, a PatchConflict.
+func Apply(contentType string, doc []byte, r io.Reader) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != MergePatch && mediaType != JSONPatch) {
+		return nil, errors.WithDetails(errors.UnsupportedMediaType(), map[string]interface{}{"accept": MediaTypes})
+	}
+	patch, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	if mediaType == MergePatch {
+		return Merge(doc, patch)
+	}
+	return JSON(doc, patch)
+}
+
+// Merge applies the merge patch to doc: members of patch replace those of
+// doc, objects are merged member by member and null removes a member.
+func Merge(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, parseError(err)
+	}
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = mergeValue(t[name], value)
+	}
+	return t
+}
+
+// operation is one step of a JSON Patch.
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSON applies the operations of the JSON Patch to doc in order. Either all
+// of them are applied or none is.
+func JSON(doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, parseError(err)
+	}
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, parseError(fmt.Errorf("operation %d has no path", i))
+		}
+		var err error
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	path := *op.Path
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, parseError(fmt.Errorf("%s %s has no value", op.Op, path))
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, parseError(err)
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if _, err := get(doc, path); err != nil {
+				return nil, err
+			}
+			doc, _ = remove(doc, path)
+			return add(doc, path, value)
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, conflict(fmt.Errorf("test of %s failed", path))
+		}
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		if op.From == nil {
+			return nil, parseError(fmt.Errorf("%s to %s has no from", op.Op, path))
+		}
+		value, err := get(doc, *op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			// The copy must not share objects or arrays with its source.
+			raw, _ := json.Marshal(value)
+			_ = json.Unmarshal(raw, &value)
+		} else {
+			if strings.HasPrefix(path, *op.From+"/") {
+				return nil, conflict(fmt.Errorf("cannot move %s into itself", *op.From))
+			}
+			if doc, err = remove(doc, *op.From); err != nil {
+				return nil, err
+			}
+		}
+		return add(doc, path, value)
+	}
+	return nil, parseError(fmt.Errorf("unknown operation %q", op.Op))
+}
+
+// get returns the value at the JSON Pointer path.
+func get(doc interface{}, path string) (interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, conflict(fmt.Errorf("%s does not exist", path))
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, conflict(fmt.Errorf("%s does not exist", path))
+			}
+			doc = node[i]
+		default:
+			return nil, conflict(fmt.Errorf("%s does not exist", path))
+		}
+	}
+	return doc, nil
+}
+
+// add sets the member or inserts the element at path, returning the new
+// document.
+func add(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return change(doc, path, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[last] = value
+			return node, nil
+		case []interface{}:
+			i := len(node)
+			if last != "-" {
+				if i, err = index(last, len(node)); err != nil {
+					return nil, conflict(fmt.Errorf("%s is out of range", path))
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, conflict(fmt.Errorf("the parent of %s is not an object or array", path))
+	})
+}
+
+// remove deletes the member or element at path, returning the new document.
+func remove(doc interface{}, path string) (interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, conflict(fmt.Errorf("cannot remove the whole document"))
+	}
+	return change(doc, path, tokens, func(parent interface{}, last string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[last]; !ok {
+				return nil, conflict(fmt.Errorf("%s does not exist", path))
+			}
+			delete(node, last)
+			return node, nil
+		case []interface{}:
+			i, err := index(last, len(node)-1)
+			if err != nil {
+				return nil, conflict(fmt.Errorf("%s does not exist", path))
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, conflict(fmt.Errorf("%s does not exist", path))
+	})
+}
+
+// change finds the parent of the last token of path, lets edit replace it
+// and stores the result back into its own parent. Arrays may be reallocated,
+// so every level on the way down is rebuilt.
+func change(
+	doc interface{}, path string, tokens []string, edit func(parent interface{}, last string) (interface{}, error),
+) (interface{}, error) {
+	if len(tokens) == 1 {
+		return edit(doc, tokens[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tokens[0]]
+		if !ok {
+			return nil, conflict(fmt.Errorf("the parent of %s does not exist", path))
+		}
+		child, err := change(child, path, tokens[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[tokens[0]] = child
+		return node, nil
+	case []interface{}:
+		i, err := index(tokens[0], len(node)-1)
+		if err != nil {
+			return nil, conflict(fmt.Errorf("the parent of %s does not exist", path))
+		}
+		child, err := change(node[i], path, tokens[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+	return nil, conflict(fmt.Errorf("the parent of %s does not exist", path))
+}
+
+// pointer splits a JSON Pointer (RFC 6901) into its unescaped tokens.
+func pointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, parseError(fmt.Errorf("path %q does not start with /", path))
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// index parses an array index no greater than max.
+func index(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("bad index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("bad index %q", token)
+	}
+	return i, nil
+}
+
+// equal compares two decoded JSON values.
+func equal(a, b interface{}) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(x) == string(y)
+}
+
+func parseError(err error) error {
+	return errors.WithDetails(errors.ParseError(), map[string]interface{}{"reason": err.Error()})
+}
+
+func conflict(err error) error {
+	return errors.WithDetails(errors.PatchConflict(), map[string]interface{}{"reason": err.Error()})
+}
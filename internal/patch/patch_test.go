@@ -0,0 +1,92 @@
+package patch
+
+import (
+	errs "errors"
+	"strings"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	testTable := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, testCase := range testTable {
+		result, err := Merge([]byte(testCase.doc), []byte(testCase.patch))
+		assert.NoError(t, err, testCase.patch)
+		assert.JSONEq(t, testCase.expected, string(result), testCase.patch)
+	}
+	_, err := Merge([]byte(`{}`), []byte(`{"a":`))
+	assert.True(t, errs.Is(err, errors.ParseError()))
+}
+
+func TestJSON(t *testing.T) {
+	doc := `{"foo":"bar","list":[1,2,3],"obj":{"a/b":1,"m~n":2}}`
+	testTable := []struct {
+		patch    string
+		expected string
+		err      error
+	}{
+		{patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar","list":[1,2,3],"obj":{"a/b":1,"m~n":2}}`},
+		{patch: `[{"op":"add","path":"/list/1","value":9}]`, expected: `{"foo":"bar","list":[1,9,2,3],"obj":{"a/b":1,"m~n":2}}`},
+		{patch: `[{"op":"add","path":"/list/-","value":4}]`, expected: `{"foo":"bar","list":[1,2,3,4],"obj":{"a/b":1,"m~n":2}}`},
+		{patch: `[{"op":"remove","path":"/list/0"}]`, expected: `{"foo":"bar","list":[2,3],"obj":{"a/b":1,"m~n":2}}`},
+		{patch: `[{"op":"replace","path":"/obj/a~1b","value":5}]`, expected: `{"foo":"bar","list":[1,2,3],"obj":{"a/b":5,"m~n":2}}`},
+		{patch: `[{"op":"move","from":"/obj/m~0n","path":"/mn"}]`, expected: `{"foo":"bar","list":[1,2,3],"mn":2,"obj":{"a/b":1}}`},
+		{patch: `[{"op":"copy","from":"/foo","path":"/list/0"}]`, expected: `{"foo":"bar","list":["bar",1,2,3],"obj":{"a/b":1,"m~n":2}}`},
+		{
+			patch:    `[{"op":"copy","from":"/obj","path":"/o"},{"op":"remove","path":"/o/m~0n"}]`,
+			expected: `{"foo":"bar","list":[1,2,3],"o":{"a/b":1},"obj":{"a/b":1,"m~n":2}}`,
+		},
+		{patch: `[{"op":"test","path":"/obj","value":{"m~n":2,"a/b":1}}]`, expected: doc},
+		{patch: `[{"op":"replace","path":"","value":[]}]`, expected: `[]`},
+		{patch: `[{"op":"replace","path":"/foo","value":null}]`, expected: `{"foo":null,"list":[1,2,3],"obj":{"a/b":1,"m~n":2}}`},
+		{patch: `[{"op":"test","path":"/foo","value":"baz"}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"remove","path":"/nope"}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"replace","path":"/nope","value":1}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"add","path":"/list/4","value":1}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"add","path":"/nope/a","value":1}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"move","from":"/obj","path":"/obj/x"}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"remove","path":"/list/01"}]`, err: errors.PatchConflict()},
+		{patch: `[{"op":"add","path":"/baz"}]`, err: errors.ParseError()},
+		{patch: `[{"op":"remove"}]`, err: errors.ParseError()},
+		{patch: `[{"op":"remove","path":"foo"}]`, err: errors.ParseError()},
+		{patch: `[{"op":"rename","path":"/foo"}]`, err: errors.ParseError()},
+		{patch: `{"op":"remove","path":"/foo"}`, err: errors.ParseError()},
+	}
+	for _, testCase := range testTable {
+		result, err := JSON([]byte(doc), []byte(testCase.patch))
+		if testCase.err != nil {
+			assert.True(t, errs.Is(err, testCase.err), "%s: %v", testCase.patch, err)
+			continue
+		}
+		assert.NoError(t, err, testCase.patch)
+		assert.JSONEq(t, testCase.expected, string(result), testCase.patch)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"name":"worker"}`)
+	result, err := Apply("application/merge-patch+json; charset=utf-8", doc, strings.NewReader(`{"name":"boss"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"boss"}`, string(result))
+	result, err = Apply(JSONPatch, doc, strings.NewReader(`[{"op":"remove","path":"/name"}]`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(result))
+	for _, contentType := range []string{"application/json", "", "text/plain;;"} {
+		_, err = Apply(contentType, doc, strings.NewReader(`{}`))
+		assert.True(t, errs.Is(err, errors.UnsupportedMediaType()), contentType)
+		assert.Equal(t, map[string]interface{}{"accept": MediaTypes}, errors.Details(err))
+	}
+}
@@ -0,0 +1,230 @@
+// Package policy checks the roles of the caller before a request reaches the
+// service. Every method names the permission it needs, so a method added to
+// the service is unreachable until it is added here.
+package policy
+
+import (
+	"context"
+	errs "errors"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/handler"
+	"github.com/NVTer/rest-api-example/internal/middleware"
+)
+
+// Policy wraps a handler.Service and only lets through the calls the roles
+// in the context allow.
+type Policy struct {
+	next handler.Service
+}
+
+func New(next handler.Service) *Policy {
+	return &Policy{next: next}
+}
+
+// authorize returns nil if the roles stored by middleware.AuthMiddleware
+// grant every permission, Unauthorized if there are no roles at all and a
+// PermissionError naming the first missing permission otherwise.
+func authorize(ctx context.Context, permissions ...string) error {
+	roles, ok := ctx.Value(middleware.UserRoles).([]string)
+	if !ok {
+		return errors.Unauthorized()
+	}
+	for _, permission := range permissions {
+		if !auth.Can(roles, permission) {
+			return &errors.PermissionError{Permission: permission, Roles: roles}
+		}
+	}
+	return nil
+}
+
+func (p *Policy) CreatePosition(ctx context.Context, pos *internal.Position) (string, error) {
+	if err := authorize(ctx, auth.PermWritePositions, auth.PermWriteCompensation); err != nil {
+		return "", err
+	}
+	return p.next.CreatePosition(ctx, pos)
+}
+
+func (p *Policy) CreateEmployee(ctx context.Context, e *internal.Employee) (string, error) {
+	if err := authorize(ctx, auth.PermWriteEmployees); err != nil {
+		return "", err
+	}
+	return p.next.CreateEmployee(ctx, e)
+}
+
+func (p *Policy) GetPositions(
+	ctx context.Context, f internal.PositionFilter, limit, offset int,
+) ([]internal.Position, int, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return nil, 0, err
+	}
+	return p.next.GetPositions(ctx, f, limit, offset)
+}
+
+func (p *Policy) GetEmployees(
+	ctx context.Context, f internal.EmployeeFilter, limit, offset int,
+) ([]internal.Employee, int, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return nil, 0, err
+	}
+	return p.next.GetEmployees(ctx, f, limit, offset)
+}
+
+func (p *Policy) GetPositionsPage(
+	ctx context.Context, f internal.PositionFilter, cursor string, limit int,
+) ([]internal.Position, string, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return nil, "", err
+	}
+	return p.next.GetPositionsPage(ctx, f, cursor, limit)
+}
+
+func (p *Policy) GetEmployeesPage(
+	ctx context.Context, f internal.EmployeeFilter, cursor string, limit int,
+) ([]internal.Employee, string, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return nil, "", err
+	}
+	return p.next.GetEmployeesPage(ctx, f, cursor, limit)
+}
+
+func (p *Policy) Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error) {
+	if err := authorize(ctx, auth.PermReadRecords); err != nil {
+		return nil, err
+	}
+	return p.next.Search(ctx, query, limit)
+}
+
+// PositionsChanged and EmployeesChanged need the permission of the lists
+// they date.
+func (p *Policy) PositionsChanged(ctx context.Context) (time.Time, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return time.Time{}, err
+	}
+	return p.next.PositionsChanged(ctx)
+}
+
+func (p *Policy) EmployeesChanged(ctx context.Context) (time.Time, error) {
+	if err := authorize(ctx, auth.PermListRecords); err != nil {
+		return time.Time{}, err
+	}
+	return p.next.EmployeesChanged(ctx)
+}
+
+func (p *Policy) GetPosition(ctx context.Context, id string) (internal.Position, error) {
+	if err := authorize(ctx, auth.PermReadRecords); err != nil {
+		return internal.Position{}, err
+	}
+	return p.next.GetPosition(ctx, id)
+}
+
+func (p *Policy) GetEmployee(ctx context.Context, id string) (internal.Employee, error) {
+	if err := authorize(ctx, auth.PermReadRecords); err != nil {
+		return internal.Employee{}, err
+	}
+	return p.next.GetEmployee(ctx, id)
+}
+
+// DeletePosition also needs PermDeleteEmployees to cascade and
+// PermWriteEmployees to reassign.
+func (p *Policy) DeletePosition(ctx context.Context, id string, d internal.PositionDeletion) error {
+	permissions := []string{auth.PermDeletePositions}
+	switch d.Mode {
+	case internal.DeleteCascade:
+		permissions = append(permissions, auth.PermDeleteEmployees)
+	case internal.DeleteReassign:
+		permissions = append(permissions, auth.PermWriteEmployees)
+	}
+	if err := authorize(ctx, permissions...); err != nil {
+		return err
+	}
+	return p.next.DeletePosition(ctx, id, d)
+}
+
+func (p *Policy) DeleteEmployee(ctx context.Context, id string) error {
+	if err := authorize(ctx, auth.PermDeleteEmployees); err != nil {
+		return err
+	}
+	return p.next.DeleteEmployee(ctx, id)
+}
+
+// UpdatePosition also needs PermWriteCompensation when the salary changes.
+// An unknown position is left for the service to report.
+func (p *Policy) UpdatePosition(ctx context.Context, pos *internal.Position) error {
+	if err := authorize(ctx, auth.PermWritePositions); err != nil {
+		return err
+	}
+	current, err := p.next.GetPosition(ctx, pos.ID.String())
+	if err != nil && !errs.Is(err, errors.NotFound()) {
+		return err
+	}
+	if err == nil && !current.Salary.Equal(pos.Salary) {
+		if err := authorize(ctx, auth.PermWriteCompensation); err != nil {
+			return err
+		}
+	}
+	return p.next.UpdatePosition(ctx, pos)
+}
+
+func (p *Policy) UpdateEmployee(ctx context.Context, e *internal.Employee) error {
+	if err := authorize(ctx, auth.PermWriteEmployees); err != nil {
+		return err
+	}
+	return p.next.UpdateEmployee(ctx, e)
+}
+
+// GetTrash needs the same permission as reading the records themselves.
+func (p *Policy) GetTrash(ctx context.Context) (internal.Trash, error) {
+	if err := authorize(ctx, auth.PermReadRecords); err != nil {
+		return internal.Trash{}, err
+	}
+	return p.next.GetTrash(ctx)
+}
+
+// RestorePosition needs the permission that moved the position to the trash.
+func (p *Policy) RestorePosition(ctx context.Context, id string) (internal.Position, error) {
+	if err := authorize(ctx, auth.PermDeletePositions); err != nil {
+		return internal.Position{}, err
+	}
+	return p.next.RestorePosition(ctx, id)
+}
+
+// RestoreEmployee works like RestorePosition.
+func (p *Policy) RestoreEmployee(ctx context.Context, id string) (internal.Employee, error) {
+	if err := authorize(ctx, auth.PermDeleteEmployees); err != nil {
+		return internal.Employee{}, err
+	}
+	return p.next.RestoreEmployee(ctx, id)
+}
+
+// GetAudit needs a permission of its own: the trail shows every change of
+// every record, salaries included.
+func (p *Policy) GetAudit(
+	ctx context.Context, f internal.AuditFilter, cursor string, limit int,
+) ([]internal.AuditEntry, string, error) {
+	if err := authorize(ctx, auth.PermReadAudit); err != nil {
+		return nil, "", err
+	}
+	return p.next.GetAudit(ctx, f, cursor, limit)
+}
+
+// GetSalaryHistory needs to read compensation as well: the history is
+// nothing but salaries, so there is nothing left to show once they are
+// redacted.
+func (p *Policy) GetSalaryHistory(ctx context.Context, id string) ([]internal.SalaryRecord, error) {
+	if err := authorize(ctx, auth.PermReadRecords, auth.PermReadCompensation); err != nil {
+		return nil, err
+	}
+	return p.next.GetSalaryHistory(ctx, id)
+}
+
+// ScheduleSalary needs what creating a position with a salary needs.
+func (p *Policy) ScheduleSalary(ctx context.Context, id string, r *internal.SalaryRecord) error {
+	if err := authorize(ctx, auth.PermWritePositions, auth.PermWriteCompensation); err != nil {
+		return err
+	}
+	return p.next.ScheduleSalary(ctx, id, r)
+}
@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/auth"
+	errs "github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/middleware"
+	"github.com/NVTer/rest-api-example/internal/repository"
+	"github.com/NVTer/rest-api-example/internal/service"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func contextWithRoles(roles ...string) context.Context {
+	//revive:disable
+	ctx := context.WithValue(context.Background(), "correlation_id", uuid.New().String()) //nolint:staticcheck
+	return context.WithValue(ctx, middleware.UserRoles, roles)                            //nolint:staticcheck
+	//revive:enable
+}
+
+func newPolicy(t *testing.T) (*Policy, internal.Position) {
+	repos := repository.NewRepo(repository.NewDataBase())
+	p := internal.Position{ID: uuid.New(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	require.NoError(t, repos.AddPosition(context.Background(), &p))
+	return New(service.NewServ(repos, repository.NewAuditLog())), p
+}
+
+func forbidden(permission string, roles ...string) error {
+	return &errs.PermissionError{Permission: permission, Roles: roles}
+}
+
+func TestViewer(t *testing.T) {
+	policy, p := newPolicy(t)
+	ctx := contextWithRoles(auth.RoleViewer)
+	_, _, err := policy.GetPositions(ctx, internal.PositionFilter{}, 10, 1)
+	assert.NoError(t, err)
+	_, _, err = policy.GetEmployeesPage(ctx, internal.EmployeeFilter{}, "", 10)
+	assert.NoError(t, err)
+
+	_, err = policy.GetPosition(ctx, p.ID.String())
+	assert.Equal(t, forbidden(auth.PermReadRecords, auth.RoleViewer), err)
+	_, err = policy.Search(ctx, "worker", 10)
+	assert.ErrorIs(t, err, errs.Forbidden())
+	_, err = policy.CreateEmployee(ctx, &internal.Employee{FirstName: "Nick", LasName: "Bobs", PositionID: p.ID})
+	assert.Equal(t, forbidden(auth.PermWriteEmployees, auth.RoleViewer), err)
+	_, err = policy.GetSalaryHistory(ctx, p.ID.String())
+	assert.Equal(t, forbidden(auth.PermReadRecords, auth.RoleViewer), err)
+}
+
+func TestHREditor(t *testing.T) {
+	policy, p := newPolicy(t)
+	ctx := contextWithRoles(auth.RoleHREditor)
+	e := internal.Employee{FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	id, err := policy.CreateEmployee(ctx, &e)
+	require.NoError(t, err)
+	e.LasName = "Brown"
+	assert.NoError(t, policy.UpdateEmployee(ctx, &e))
+	_, err = policy.GetEmployee(ctx, id)
+	assert.NoError(t, err)
+
+	assert.Equal(t, forbidden(auth.PermDeleteEmployees, auth.RoleHREditor), policy.DeleteEmployee(ctx, id))
+	assert.Equal(t, forbidden(auth.PermDeletePositions, auth.RoleHREditor),
+		policy.DeletePosition(ctx, p.ID.String(), internal.PositionDeletion{}))
+	_, err = policy.CreatePosition(ctx, &internal.Position{Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")})
+	assert.Equal(t, forbidden(auth.PermWritePositions, auth.RoleHREditor), err)
+	raise := internal.Position{ID: p.ID, Name: p.Name, Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.Equal(t, forbidden(auth.PermWritePositions, auth.RoleHREditor), policy.UpdatePosition(ctx, &raise))
+	_, err = policy.GetTrash(ctx)
+	assert.NoError(t, err)
+	_, err = policy.RestoreEmployee(ctx, id)
+	assert.Equal(t, forbidden(auth.PermDeleteEmployees, auth.RoleHREditor), err)
+	_, _, err = policy.GetAudit(ctx, internal.AuditFilter{}, "", 10)
+	assert.Equal(t, forbidden(auth.PermReadAudit, auth.RoleHREditor), err)
+	_, err = policy.GetSalaryHistory(ctx, p.ID.String())
+	assert.NoError(t, err)
+	scheduled := internal.SalaryRecord{Amount: decimal.New(900, 0), EffectiveFrom: time.Now().Add(time.Hour)}
+	assert.Equal(t, forbidden(auth.PermWritePositions, auth.RoleHREditor),
+		policy.ScheduleSalary(ctx, p.ID.String(), &scheduled))
+}
+
+func TestAdmin(t *testing.T) {
+	policy, p := newPolicy(t)
+	ctx := contextWithRoles(auth.RoleAdmin)
+	raise := internal.Position{ID: p.ID, Name: p.Name, Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.NoError(t, policy.UpdatePosition(ctx, &raise))
+	scheduled := internal.SalaryRecord{Amount: decimal.New(1000, 0), EffectiveFrom: time.Now().Add(time.Hour)}
+	assert.NoError(t, policy.ScheduleSalary(ctx, p.ID.String(), &scheduled))
+	missing := internal.Position{ID: uuid.New(), Name: "lead", Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.Equal(t, errs.NotFound(), policy.UpdatePosition(ctx, &missing))
+	assert.NoError(t, policy.DeletePosition(ctx, p.ID.String(), internal.PositionDeletion{}))
+	_, err := policy.RestorePosition(ctx, p.ID.String())
+	assert.NoError(t, err)
+	entries, _, err := policy.GetAudit(ctx, internal.AuditFilter{EntityID: p.ID}, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestNoRoles(t *testing.T) {
+	policy, _ := newPolicy(t)
+	_, _, err := policy.GetPositions(context.Background(), internal.PositionFilter{}, 10, 1)
+	assert.Equal(t, errs.Unauthorized(), err)
+	_, _, err = policy.GetPositions(contextWithRoles(), internal.PositionFilter{}, 10, 1)
+	assert.Equal(t, forbidden(auth.PermListRecords), err)
+}
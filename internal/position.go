@@ -1,12 +1,42 @@
 package internal
 
 import (
+	"time"
+
 	"github.com/google/uuid"
-	"github.com/shopspring/decimal"
 )
 
 type Position struct {
-	ID     uuid.UUID       `json:"id"`
-	Name   string          `json:"name"`
-	Salary decimal.Decimal `json:"salary"`
+	ID   uuid.UUID `json:"id" validate:"update:required"`
+	Name string    `json:"name" validate:"required,max=100"`
+	// Salary is the salary record in effect. Writing a new one adds a record
+	// that takes effect at once.
+	Salary Money `json:"salary" openapi:"optional" validate:"required,exact" doc:"the salary in effect, see /position/{id}/salary-history; left out of responses unless the caller holds the compensation:read permission (hr-editor and admin)"`
+	// Version is set by the repository and counts the writes of the
+	// position. Updates that name a version only apply to that version.
+	Version int `json:"version" doc:"set by the server and ignored in requests; the ETag header carries it for If-Match"`
+	// CreatedAt and UpdatedAt are set by the repository as well.
+	CreatedAt time.Time `json:"created_at" doc:"set by the server and ignored in requests"`
+	UpdatedAt time.Time `json:"updated_at" doc:"set by the server and ignored in requests; the Last-Modified header carries it"`
+	// DeletedAt is set when the position is moved to the trash. Trashed
+	// positions are only seen in the trash and in lists that ask for them.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" doc:"set by the server when the position is moved to the trash"`
+}
+
+// What deleting a position does to the employees that hold it.
+const (
+	// DeleteRestrict refuses to delete a position anyone holds.
+	DeleteRestrict = "restrict"
+	// DeleteCascade deletes the employees with the position.
+	DeleteCascade = "cascade"
+	// DeleteReassign moves the employees to another position first.
+	DeleteReassign = "reassign"
+)
+
+// PositionDeletion tells what becomes of the employees of a deleted position.
+// The zero value restricts.
+type PositionDeletion struct {
+	Mode string
+	// ReassignTo is the position DeleteReassign moves the employees to.
+	ReassignTo uuid.UUID
 }
@@ -0,0 +1,76 @@
+// Package problem writes error replies as RFC 7807 problem details.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+// ContentType is the media type of a problem details body.
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object with the code of the error,
+// the correlation ID of the request and any error details as extensions.
+type Problem struct {
+	Type          string                 `json:"type"`
+	Title         string                 `json:"title"`
+	Status        int                    `json:"status"`
+	Detail        string                 `json:"detail,omitempty"`
+	Instance      string                 `json:"instance,omitempty"`
+	Code          string                 `json:"code"`
+	CorrelationID string                 `json:"correlation_id,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+}
+
+// New describes err as the reply with status to r. The text of errors that
+// are not known to the errors package is only shown for client errors, so
+// that internal failures do not leak.
+func New(r *http.Request, status int, err error) Problem {
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: r.URL.Path,
+		Code:     codeFor(status),
+		Details:  errors.Details(err),
+	}
+	if e, ok := errors.Lookup(err); ok {
+		p.Code = e.Code()
+		p.Detail = err.Error()
+	} else if status < http.StatusInternalServerError && err != nil {
+		p.Detail = err.Error()
+	}
+	if id, ok := r.Context().Value("correlation_id").(string); ok {
+		p.CorrelationID = id
+	}
+	return p
+}
+
+// Write replies to r with status and err as a problem details body.
+func Write(w http.ResponseWriter, r *http.Request, status int, err error) {
+	body, marshalErr := json.Marshal(New(r, status, err))
+	if marshalErr != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// codeFor is the code of errors the errors package does not know, derived
+// from the status text, e.g. "method_not_allowed".
+func codeFor(status int) string {
+	if status >= http.StatusInternalServerError {
+		return "internal_error"
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.ReplaceAll(text, " ", "_"))
+}
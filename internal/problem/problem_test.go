@@ -0,0 +1,63 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	testTable := []struct {
+		status   int
+		err      error
+		expected Problem
+	}{
+		{
+			status:   http.StatusNotFound,
+			err:      errors.NotFound(),
+			expected: Problem{Title: "Not Found", Status: 404, Code: "not_found", Detail: "not found"},
+		},
+		{
+			status: http.StatusBadRequest,
+			err:    errors.WithDetails(errors.ParseError(), map[string]interface{}{"reason": "unexpected EOF"}),
+			expected: Problem{
+				Title: "Bad Request", Status: 400, Code: "parse_error", Detail: "parse error",
+				Details: map[string]interface{}{"reason": "unexpected EOF"},
+			},
+		},
+		{
+			status:   http.StatusInternalServerError,
+			err:      fmt.Errorf("dial tcp 10.0.0.1:5432: connection refused"),
+			expected: Problem{Title: "Internal Server Error", Status: 500, Code: "internal_error"},
+		},
+		{
+			status:   http.StatusMethodNotAllowed,
+			err:      fmt.Errorf("no PATCH here"),
+			expected: Problem{Title: "Method Not Allowed", Status: 405, Code: "method_not_allowed", Detail: "no PATCH here"},
+		},
+	}
+	for _, testCase := range testTable {
+		r := httptest.NewRequest("GET", "/positions", nil)
+		//revive:disable
+		r = r.WithContext(context.WithValue(r.Context(), "correlation_id", "abc")) //nolint:staticcheck
+		//revive:enable
+		w := httptest.NewRecorder()
+		Write(w, r, testCase.status, testCase.err)
+		assert.Equal(t, testCase.status, w.Code)
+		assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+		var body Problem
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		testCase.expected.Type = "about:blank"
+		testCase.expected.Instance = "/positions"
+		testCase.expected.CorrelationID = "abc"
+		assert.Equal(t, testCase.expected, body)
+	}
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/sirupsen/logrus"
+)
+
+const auditFileName = "audit.log"
+
+// AuditLog keeps the audit trail in memory. Opened on a directory it also
+// appends every entry to a file there, one JSON line each, and reads them
+// back on the next start. Entries are never compacted away.
+type AuditLog struct {
+	mu      sync.RWMutex
+	entries []internal.AuditEntry
+	file    *os.File
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// OpenAuditLog returns an AuditLog persisted in dir. Close must be called to
+// release the file.
+func OpenAuditLog(dir string) (*AuditLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, auditFileName)
+	l := NewAuditLog()
+	if err := l.load(path); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.file = file
+	return l, nil
+}
+
+func (l *AuditLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// AddAudit sets the ID and the time of e and appends it to the trail.
+func (l *AuditLog) AddAudit(ctx context.Context, e *internal.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.ID = int64(len(l.entries)) + 1
+	e.Time = now()
+	if l.file != nil {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	l.entries = append(l.entries, *e)
+	return nil
+}
+
+// ListAudit returns up to limit entries matching f, newest first. A positive
+// before only returns entries older than the entry with that ID.
+func (l *AuditLog) ListAudit(ctx context.Context, f internal.AuditFilter, before int64, limit int) ([]internal.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	last := len(l.entries)
+	if before > 0 && before <= int64(last) {
+		last = int(before) - 1
+	}
+	entries := make([]internal.AuditEntry, 0)
+	for i := last - 1; i >= 0 && len(entries) < limit; i-- {
+		if f.Match(l.entries[i]) {
+			entries = append(entries, l.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+// load reads the entries written by an earlier run. Like the write-ahead log
+// it cuts off a torn entry at the very end.
+func (l *AuditLog) load(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return nil
+			}
+			logrus.WithField("offset", offset).Warn("truncate torn audit log entry")
+			return file.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+		var e internal.AuditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("read audit log %s at offset %d: %w", path, offset, err)
+		}
+		l.entries = append(l.entries, e)
+		offset += int64(len(line))
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/google/uuid"
+)
+
+type Database struct {
+	mu        sync.RWMutex
+	employees map[string]internal.Employee
+	positions map[string]internal.Position
+	// salaries holds the salary records of each position by its ID. They are
+	// kept without EffectiveTo, which Salaries derives.
+	salaries map[string][]internal.SalaryRecord
+	index    index
+	journal  *journal
+	// positionsChanged and employeesChanged are when a write last touched
+	// each map. They are not persisted: a Database counts as changed when
+	// it is created, which is never later than any record it loads.
+	positionsChanged time.Time
+	employeesChanged time.Time
+}
+
+func NewDataBase() *Database {
+	created := now()
+	return &Database{
+		employees:        map[string]internal.Employee{},
+		positions:        map[string]internal.Position{},
+		salaries:         map[string][]internal.SalaryRecord{},
+		index:            newIndex(),
+		positionsChanged: created,
+		employeesChanged: created,
+	}
+}
+
+// GetEmployees returns a snapshot of the stored employees that is safe to use
+// after the lock is released.
+func (d *Database) GetEmployees() map[string]internal.Employee {
+	var m map[string]internal.Employee
+	_ = d.View(func(tx *Tx) error {
+		m = tx.Employees()
+		return nil
+	})
+	return m
+}
+
+// GetPosition returns a snapshot of the stored positions that is safe to use
+// after the lock is released.
+func (d *Database) GetPosition() map[string]internal.Position {
+	var m map[string]internal.Position
+	_ = d.View(func(tx *Tx) error {
+		m = tx.Positions()
+		return nil
+	})
+	return m
+}
+
+// View runs fn inside a read-only transaction. Any number of View calls may run
+// in parallel, but they never overlap with an Update.
+func (d *Database) View(fn func(tx *Tx) error) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return fn(&Tx{db: d})
+}
+
+// Update runs fn inside an exclusive read-write transaction. If fn returns an
+// error or panics, every change made through tx is rolled back. For a
+// Database opened with OpenDataBase the changes are written to the log before
+// the lock is released.
+func (d *Database) Update(fn func(tx *Tx) error) (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx := &Tx{db: d, writable: true}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.rollback()
+			panic(r)
+		}
+		if err != nil {
+			tx.rollback()
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if d.journal != nil {
+		err = d.journal.append(tx.ops)
+	}
+	return err
+}
+
+// Tx gives access to both maps of a Database while its lock is held. A Tx must
+// not be used after the function it was passed to returns.
+type Tx struct {
+	db       *Database
+	writable bool
+	undo     []func()
+	ops      []walOp
+}
+
+// Position returns the position id with the salary in effect now; see
+// effective.
+func (tx *Tx) Position(id string) (internal.Position, bool) {
+	p, ok := tx.db.positions[id]
+	if !ok {
+		return internal.Position{}, false
+	}
+	return effective(tx, p), true
+}
+
+func (tx *Tx) Employee(id string) (internal.Employee, bool) {
+	e, ok := tx.db.employees[id]
+	return e, ok
+}
+
+// PositionsChanged returns when a write last touched the positions or a
+// salary record last took effect, whichever is later.
+func (tx *Tx) PositionsChanged() time.Time {
+	changed, at := tx.db.positionsChanged, now()
+	for _, records := range tx.db.salaries {
+		for _, r := range records {
+			if r.EffectiveFrom.After(changed) && !r.EffectiveFrom.After(at) {
+				changed = r.EffectiveFrom
+			}
+		}
+	}
+	return changed
+}
+
+// EmployeesChanged returns when a write last touched the employees.
+func (tx *Tx) EmployeesChanged() time.Time {
+	return tx.db.employeesChanged
+}
+
+// Salaries returns the salary records of the position id as a timeline; see
+// internal.SalaryTimeline.
+func (tx *Tx) Salaries(id string) []internal.SalaryRecord {
+	records := append([]internal.SalaryRecord(nil), tx.db.salaries[id]...)
+	return internal.SalaryTimeline(records)
+}
+
+func (tx *Tx) Positions() map[string]internal.Position {
+	m := make(map[string]internal.Position, len(tx.db.positions))
+	for k, v := range tx.db.positions {
+		m[k] = effective(tx, v)
+	}
+	return m
+}
+
+func (tx *Tx) Employees() map[string]internal.Employee {
+	m := make(map[string]internal.Employee, len(tx.db.employees))
+	for k, v := range tx.db.employees {
+		m[k] = v
+	}
+	return m
+}
+
+// PositionsByName returns the positions outside the trash called name ordered
+// by ID.
+func (tx *Tx) PositionsByName(name string) []internal.Position {
+	ids := tx.db.index.positionsByName[name].sorted()
+	positions := make([]internal.Position, 0, len(ids))
+	for _, id := range ids {
+		positions = append(positions, effective(tx, tx.db.positions[id]))
+	}
+	return positions
+}
+
+// EmployeesByName returns the employees outside the trash with the given first
+// and last name ordered by ID.
+func (tx *Tx) EmployeesByName(firstName, lasName string) []internal.Employee {
+	ids := tx.db.index.employeesByName[fullName(firstName, lasName)].sorted()
+	return tx.employeesByID(ids)
+}
+
+// EmployeesByPosition returns the employees holding the position ordered by
+// ID, including those in the trash.
+func (tx *Tx) EmployeesByPosition(positionID string) []internal.Employee {
+	return tx.employeesByID(tx.db.index.employeesByPosition[positionID].sorted())
+}
+
+// TrashedPositions returns the positions in the trash ordered by ID.
+func (tx *Tx) TrashedPositions() []internal.Position {
+	ids := tx.db.index.trashedPositions.sorted()
+	positions := make([]internal.Position, 0, len(ids))
+	for _, id := range ids {
+		positions = append(positions, effective(tx, tx.db.positions[id]))
+	}
+	return positions
+}
+
+// TrashedEmployees returns the employees in the trash ordered by ID.
+func (tx *Tx) TrashedEmployees() []internal.Employee {
+	return tx.employeesByID(tx.db.index.trashedEmployees.sorted())
+}
+
+// PositionsPage returns up to limit positions ordered by ID. The page starts
+// right after the ID after, or at offset when after is empty.
+func (tx *Tx) PositionsPage(after string, offset, limit int) []internal.Position {
+	ids := window(tx.db.positionIDs(), after, offset, limit)
+	positions := make([]internal.Position, 0, len(ids))
+	for _, id := range ids {
+		positions = append(positions, effective(tx, tx.db.positions[id]))
+	}
+	return positions
+}
+
+// EmployeesPage returns up to limit employees ordered by ID. The page starts
+// right after the ID after, or at offset when after is empty.
+func (tx *Tx) EmployeesPage(after string, offset, limit int) []internal.Employee {
+	return tx.employeesByID(window(tx.db.employeeIDs(), after, offset, limit))
+}
+
+// FilterPositions returns the positions matching f in the order it asks for.
+// It fails with the error of f.SalaryRate if f compares salaries that it
+// cannot convert.
+func (tx *Tx) FilterPositions(f internal.PositionFilter) ([]internal.Position, error) {
+	all := make([]internal.Position, 0, len(tx.db.positions))
+	currencies := idSet{}
+	for _, id := range tx.db.positionIDs() {
+		p := effective(tx, tx.db.positions[id])
+		all = append(all, p)
+		currencies[p.Salary.Currency] = struct{}{}
+	}
+	f, err := f.WithRates(currencies.sorted())
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]internal.Position, 0)
+	for _, p := range all {
+		if f.Match(p) {
+			positions = append(positions, p)
+		}
+	}
+	if len(f.Sort) > 0 {
+		sort.SliceStable(positions, func(i, j int) bool {
+			return f.Less(positions[i], positions[j])
+		})
+	}
+	return positions, nil
+}
+
+// FilterEmployees returns the employees matching f in the order it asks for.
+// A position filter is answered from the index.
+func (tx *Tx) FilterEmployees(f internal.EmployeeFilter) []internal.Employee {
+	ids := tx.db.employeeIDs()
+	if f.PositionID != uuid.Nil {
+		ids = tx.db.index.employeesByPosition[f.PositionID.String()].sorted()
+	}
+	employees := make([]internal.Employee, 0)
+	for _, id := range ids {
+		if e := tx.db.employees[id]; f.Match(e) {
+			employees = append(employees, e)
+		}
+	}
+	if len(f.Sort) > 0 {
+		sort.SliceStable(employees, func(i, j int) bool {
+			return f.Less(employees[i], employees[j])
+		})
+	}
+	return employees
+}
+
+func (tx *Tx) employeesByID(ids []string) []internal.Employee {
+	employees := make([]internal.Employee, 0, len(ids))
+	for _, id := range ids {
+		employees = append(employees, tx.db.employees[id])
+	}
+	return employees
+}
+
+func (tx *Tx) PutPosition(p internal.Position) {
+	tx.checkWritable()
+	id := p.ID.String()
+	old, ok := tx.db.positions[id]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			tx.db.setPosition(old)
+		} else {
+			tx.db.removePosition(id)
+		}
+	})
+	tx.db.setPosition(p)
+	tx.db.positionsChanged = now()
+	tx.log(walOp{Op: opPutPosition, Position: &p})
+}
+
+func (tx *Tx) PutEmployee(e internal.Employee) {
+	tx.checkWritable()
+	id := e.ID.String()
+	old, ok := tx.db.employees[id]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			tx.db.setEmployee(old)
+		} else {
+			tx.db.removeEmployee(id)
+		}
+	})
+	tx.db.setEmployee(e)
+	tx.db.employeesChanged = now()
+	tx.log(walOp{Op: opPutEmployee, Employee: &e})
+}
+
+// PutSalaries replaces the salary records of the position id.
+func (tx *Tx) PutSalaries(id string, records []internal.SalaryRecord) {
+	tx.checkWritable()
+	tx.setSalaries(id, records)
+	tx.log(walOp{Op: opPutSalaries, ID: id, Salaries: records})
+}
+
+// setSalaries stores records without EffectiveTo and undoes that on rollback.
+func (tx *Tx) setSalaries(id string, records []internal.SalaryRecord) {
+	old, ok := tx.db.salaries[id]
+	tx.undo = append(tx.undo, func() {
+		if ok {
+			tx.db.salaries[id] = old
+		} else {
+			delete(tx.db.salaries, id)
+		}
+	})
+	if records == nil {
+		delete(tx.db.salaries, id)
+		return
+	}
+	stored := make([]internal.SalaryRecord, len(records))
+	for i, r := range records {
+		r.EffectiveTo = nil
+		stored[i] = r
+	}
+	tx.db.salaries[id] = stored
+}
+
+// DeletePosition removes the position together with its salary records.
+func (tx *Tx) DeletePosition(id string) bool {
+	tx.checkWritable()
+	old, ok := tx.db.positions[id]
+	if !ok {
+		return false
+	}
+	tx.undo = append(tx.undo, func() {
+		tx.db.setPosition(old)
+	})
+	tx.db.removePosition(id)
+	tx.setSalaries(id, nil)
+	tx.db.positionsChanged = now()
+	tx.log(walOp{Op: opDeletePosition, ID: id})
+	return true
+}
+
+func (tx *Tx) DeleteEmployee(id string) bool {
+	tx.checkWritable()
+	old, ok := tx.db.employees[id]
+	if !ok {
+		return false
+	}
+	tx.undo = append(tx.undo, func() {
+		tx.db.setEmployee(old)
+	})
+	tx.db.removeEmployee(id)
+	tx.db.employeesChanged = now()
+	tx.log(walOp{Op: opDeleteEmployee, ID: id})
+	return true
+}
+
+// log records op for the write-ahead log. In-memory databases skip it.
+func (tx *Tx) log(op walOp) {
+	if tx.db.journal != nil {
+		tx.ops = append(tx.ops, op)
+	}
+}
+
+func (tx *Tx) checkWritable() {
+	if !tx.writable {
+		panic("repository: write in read-only transaction")
+	}
+}
+
+// now is the time writes are stamped with, cut to the microseconds Postgres
+// keeps so that both repositories report the same times.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (tx *Tx) rollback() {
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		tx.undo[i]()
+	}
+	tx.undo = nil
+	tx.ops = nil
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/NVTer/rest-api-example/internal"
+)
+
+// idSet holds the IDs of the records that share an index key.
+type idSet map[string]struct{}
+
+// index keeps the secondary lookups of a Database in step with its maps.
+// Records are always looked up by ID in the maps themselves. Records in the
+// trash are left out of the name and text lookups and kept in their own sets;
+// employeesByPosition holds them as well, since they still refer to their
+// position.
+type index struct {
+	positionsByName     map[string]idSet
+	employeesByName     map[string]idSet
+	employeesByPosition map[string]idSet
+	text                textIndex
+	order               order
+	trashedPositions    idSet
+	trashedEmployees    idSet
+}
+
+// order caches the IDs of each map in ascending order. Writes that add or
+// remove an ID drop the cache and the next reader rebuilds it, so a burst of
+// inserts costs one sort instead of one shift per insert. Readers share the
+// database read lock, hence the separate mutex.
+type order struct {
+	mu        sync.Mutex
+	positions []string
+	employees []string
+}
+
+func newIndex() index {
+	return index{
+		positionsByName:     map[string]idSet{},
+		employeesByName:     map[string]idSet{},
+		employeesByPosition: map[string]idSet{},
+		text:                newTextIndex(),
+		trashedPositions:    idSet{},
+		trashedEmployees:    idSet{},
+	}
+}
+
+// setPosition stores p, replacing any previous version, and updates the index.
+func (d *Database) setPosition(p internal.Position) {
+	id := p.ID.String()
+	if _, ok := d.positions[id]; !ok {
+		d.index.order.positions = nil
+	}
+	d.removePosition(id)
+	d.positions[id] = p
+	if p.DeletedAt != nil {
+		d.index.trashedPositions[id] = struct{}{}
+		return
+	}
+	add(d.index.positionsByName, p.Name, id)
+	d.index.text.add(d.index.text.positions, internal.PositionTokens(p), id)
+}
+
+func (d *Database) removePosition(id string) {
+	old, ok := d.positions[id]
+	if !ok {
+		return
+	}
+	if old.DeletedAt != nil {
+		delete(d.index.trashedPositions, id)
+	} else {
+		remove(d.index.positionsByName, old.Name, id)
+		d.index.text.remove(d.index.text.positions, internal.PositionTokens(old), id)
+	}
+	delete(d.positions, id)
+	d.index.order.positions = nil
+}
+
+// setEmployee stores e, replacing any previous version, and updates the index.
+func (d *Database) setEmployee(e internal.Employee) {
+	id := e.ID.String()
+	if _, ok := d.employees[id]; !ok {
+		d.index.order.employees = nil
+	}
+	d.removeEmployee(id)
+	d.employees[id] = e
+	add(d.index.employeesByPosition, e.PositionID.String(), id)
+	if e.DeletedAt != nil {
+		d.index.trashedEmployees[id] = struct{}{}
+		return
+	}
+	add(d.index.employeesByName, fullName(e.FirstName, e.LasName), id)
+	d.index.text.add(d.index.text.employees, internal.EmployeeTokens(e), id)
+}
+
+func (d *Database) removeEmployee(id string) {
+	old, ok := d.employees[id]
+	if !ok {
+		return
+	}
+	remove(d.index.employeesByPosition, old.PositionID.String(), id)
+	if old.DeletedAt != nil {
+		delete(d.index.trashedEmployees, id)
+	} else {
+		remove(d.index.employeesByName, fullName(old.FirstName, old.LasName), id)
+		d.index.text.remove(d.index.text.employees, internal.EmployeeTokens(old), id)
+	}
+	delete(d.employees, id)
+	d.index.order.employees = nil
+}
+
+func add(m map[string]idSet, key, id string) {
+	set, ok := m[key]
+	if !ok {
+		set = idSet{}
+		m[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+func remove(m map[string]idSet, key, id string) {
+	delete(m[key], id)
+	if len(m[key]) == 0 {
+		delete(m, key)
+	}
+}
+
+// fullName is the employeesByName key. The length prefix keeps pairs such as
+// ("ab", "c") and ("a", "bc") apart.
+func fullName(firstName, lasName string) string {
+	return strconv.Itoa(len(firstName)) + ":" + firstName + lasName
+}
+
+// sorted returns the IDs of the set in ascending order so that lookups
+// through the index give the same result on every call.
+func (s idSet) sorted() []string {
+	ids := make([]string, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// positionIDs returns all position IDs in ascending order. The slice is shared
+// and must not be modified.
+func (d *Database) positionIDs() []string {
+	d.index.order.mu.Lock()
+	defer d.index.order.mu.Unlock()
+	if d.index.order.positions == nil {
+		ids := make([]string, 0, len(d.positions))
+		for id := range d.positions {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		d.index.order.positions = ids
+	}
+	return d.index.order.positions
+}
+
+// employeeIDs returns all employee IDs in ascending order. The slice is shared
+// and must not be modified.
+func (d *Database) employeeIDs() []string {
+	d.index.order.mu.Lock()
+	defer d.index.order.mu.Unlock()
+	if d.index.order.employees == nil {
+		ids := make([]string, 0, len(d.employees))
+		for id := range d.employees {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		d.index.order.employees = ids
+	}
+	return d.index.order.employees
+}
+
+// window returns the part of ids that starts right after the ID after (or at
+// offset when after is empty) and holds at most limit entries.
+func window(ids []string, after string, offset, limit int) []string {
+	if after != "" {
+		offset = sort.Search(len(ids), func(i int) bool {
+			return ids[i] > after
+		})
+	}
+	lo, hi := bounds(len(ids), limit, offset)
+	return ids[lo:hi]
+}
+
+// bounds clamps a limit/offset window to a slice of length n.
+func bounds(n, limit, offset int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	if limit < 0 || offset+limit > n {
+		return offset, n
+	}
+	return offset, offset + limit
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+
+	"github.com/NVTer/rest-api-example/internal"
+)
+
+const selectAudit = "SELECT id, entity, entity_id, action, actor, correlation_id, at, changes FROM audit_log"
+
+// AuditRepository keeps the audit trail in the audit_log table.
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepo(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// txKey is the context key of the transaction of the mutation being audited.
+type txKey struct{}
+
+// audit hands changes to the auditor of ctx with tx in the context, so that
+// an AuditRepository on the same database adds the entries in tx and they
+// commit or roll back with the mutation.
+func audit(ctx context.Context, tx *sql.Tx, changes ...internal.Change) error {
+	return internal.Audit(context.WithValue(ctx, txKey{}, tx), changes...)
+}
+
+// AddAudit sets the ID and the time of e and inserts it, in the transaction
+// of the mutation if it is audited from one.
+func (t AuditRepository) AddAudit(ctx context.Context, e *internal.AuditEntry) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	var q querier = t.db
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		q = tx
+	}
+	err = q.QueryRowContext(ctx,
+		`INSERT INTO audit_log (entity, entity_id, action, actor, correlation_id, at, changes)
+		VALUES ($1, $2, $3, $4, $5, now(), $6) RETURNING id, at`,
+		e.Entity, e.EntityID, e.Action, e.Actor, e.CorrelationID, changes,
+	).Scan(&e.ID, &e.Time)
+	return mapError(err)
+}
+
+// ListAudit returns up to limit entries matching f, newest first. A positive
+// before only returns entries older than the entry with that ID.
+func (t AuditRepository) ListAudit(
+	ctx context.Context, f internal.AuditFilter, before int64, limit int,
+) ([]internal.AuditEntry, error) {
+	q := auditQuery(f)
+	if before > 0 {
+		q.where("id < " + q.arg(before))
+	}
+	rows, err := t.db.QueryContext(ctx,
+		selectAudit+q.String()+" ORDER BY id DESC LIMIT "+strconv.Itoa(limit), q.args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	entries := make([]internal.AuditEntry, 0)
+	for rows.Next() {
+		var e internal.AuditEntry
+		var changes []byte
+		err := rows.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &e.CorrelationID, &e.Time, &changes)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, mapError(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, mapError(rows.Err())
+}
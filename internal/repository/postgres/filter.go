@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/google/uuid"
+)
+
+// query collects the WHERE conditions of a filter and their arguments.
+type query struct {
+	conditions []string
+	args       []interface{}
+	// columns replaces sortColumns for the fields it has.
+	columns map[string]string
+}
+
+// arg adds value to the arguments and returns its placeholder.
+func (q *query) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+func (q *query) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *query) String() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+func positionQuery(f internal.PositionFilter) *query {
+	q := &query{}
+	if !f.IncludeDeleted {
+		q.where("deleted_at IS NULL")
+	}
+	if f.NameContains != "" {
+		q.where("name ILIKE '%' || " + q.arg(escapeLike(f.NameContains)) + " || '%'")
+	}
+	if !f.ComparesSalaries() {
+		return q
+	}
+	salary := salaryIn(q, f)
+	q.columns = map[string]string{internal.SortSalary: salary}
+	if f.SalaryMin.Valid {
+		q.where(salary + " >= " + q.arg(f.SalaryMin.Decimal))
+	}
+	if f.SalaryMax.Valid {
+		q.where(salary + " <= " + q.arg(f.SalaryMax.Decimal))
+	}
+	return q
+}
+
+// salaryIn returns the salary converted into f.SalaryCurrency at f.Rates and
+// rounded like exchange.Convert does; round rounds half away from zero as
+// well. A currency without a rate, stored after the rates were looked up,
+// gives NULL, which matches no bound.
+func salaryIn(q *query, f internal.PositionFilter) string {
+	currencies := make([]string, 0, len(f.Rates))
+	for currency := range f.Rates {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	places := strconv.Itoa(int(internal.MinorUnits(f.SalaryCurrency)))
+	var b strings.Builder
+	b.WriteString("CASE salary_currency WHEN " + q.arg(f.SalaryCurrency) + " THEN salary")
+	for _, currency := range currencies {
+		b.WriteString(" WHEN " + q.arg(currency) + " THEN round(salary * " + q.arg(f.Rates[currency]) + ", " + places + ")")
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+func employeeQuery(f internal.EmployeeFilter) *query {
+	q := &query{}
+	if !f.IncludeDeleted {
+		q.where("deleted_at IS NULL")
+	}
+	if f.PositionID != uuid.Nil {
+		q.where("position_id = " + q.arg(f.PositionID))
+	}
+	if f.FirstNamePrefix != "" {
+		q.where("first_name ILIKE " + q.arg(escapeLike(f.FirstNamePrefix)) + " || '%'")
+	}
+	if f.LasNamePrefix != "" {
+		q.where("las_name ILIKE " + q.arg(escapeLike(f.LasNamePrefix)) + " || '%'")
+	}
+	return q
+}
+
+func auditQuery(f internal.AuditFilter) *query {
+	q := &query{}
+	if f.Entity != "" {
+		q.where("entity = " + q.arg(f.Entity))
+	}
+	if f.EntityID != uuid.Nil {
+		q.where("entity_id = " + q.arg(f.EntityID))
+	}
+	if f.Actor != "" {
+		q.where("actor = " + q.arg(f.Actor))
+	}
+	if !f.From.IsZero() {
+		q.where("at >= " + q.arg(f.From))
+	}
+	if !f.To.IsZero() {
+		q.where("at < " + q.arg(f.To))
+	}
+	return q
+}
+
+// sortColumns maps the sortable fields onto columns. Text columns use the C
+// collation so that the order matches the in-memory repository.
+var sortColumns = map[string]string{ //nolint:gochecknoglobals
+	internal.SortID:         "id",
+	internal.SortName:       `name COLLATE "C"`,
+	internal.SortSalary:     "salary",
+	internal.SortFirstName:  `first_name COLLATE "C"`,
+	internal.SortLasName:    `las_name COLLATE "C"`,
+	internal.SortPositionID: "position_id",
+}
+
+// orderBy builds the ORDER BY clause. id always comes last as a tie breaker.
+// Unknown fields are skipped; Serv rejects them before they get here.
+func (q *query) orderBy(sort []internal.SortField) string {
+	keys := make([]string, 0, len(sort)+1)
+	for _, s := range sort {
+		column, ok := q.columns[s.Field]
+		if !ok {
+			column, ok = sortColumns[s.Field]
+		}
+		if !ok {
+			continue
+		}
+		if s.Desc {
+			column += " DESC"
+		}
+		keys = append(keys, column)
+	}
+	keys = append(keys, "id")
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
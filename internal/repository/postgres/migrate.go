@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// migrationLock is an arbitrary key for pg_advisory_xact_lock so that two
+// instances starting at once do not apply the same migration twice.
+const migrationLock = 7225406
+
+type migration struct {
+	version int
+	name    string
+}
+
+// Migrate applies every migration from the migrations directory that has not
+// been recorded in schema_migrations yet. Each file runs in its own transaction.
+func Migrate(db *sql.DB) error {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return err
+	}
+	list, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		if err := apply(db, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		prefix := strings.SplitN(entry.Name(), "_", 2)[0]
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: bad version prefix", entry.Name())
+		}
+		list = append(list, migration{version: version, name: entry.Name()})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].version < list[j].version
+	})
+	return list, nil
+}
+
+func apply(db *sql.DB, m migration) error {
+	body, err := migrations.ReadFile(path.Join("migrations", m.name))
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	var applied bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.Exec(string(body)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
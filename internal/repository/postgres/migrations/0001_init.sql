@@ -0,0 +1,14 @@
+CREATE TABLE positions (
+    id     UUID PRIMARY KEY,
+    name   TEXT NOT NULL,
+    salary NUMERIC NOT NULL
+);
+
+CREATE TABLE employees (
+    id          UUID PRIMARY KEY,
+    first_name  TEXT NOT NULL,
+    las_name    TEXT NOT NULL,
+    position_id UUID NOT NULL REFERENCES positions (id)
+);
+
+CREATE INDEX employees_position_id_idx ON employees (position_id);
@@ -0,0 +1,12 @@
+-- The search columns hold internal.Tokenize output, which the repository
+-- computes on every insert and update. Rows written before this migration
+-- are backfilled from lower-cased text; their diacritics are folded the next
+-- time they are updated.
+ALTER TABLE positions ADD COLUMN search TSVECTOR NOT NULL DEFAULT ''::tsvector;
+ALTER TABLE employees ADD COLUMN search TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+UPDATE positions SET search = to_tsvector('simple', lower(name));
+UPDATE employees SET search = to_tsvector('simple', lower(first_name || ' ' || las_name));
+
+CREATE INDEX positions_search_idx ON positions USING GIN (search);
+CREATE INDEX employees_search_idx ON employees USING GIN (search);
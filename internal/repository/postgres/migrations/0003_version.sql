@@ -0,0 +1,4 @@
+-- The version columns count the writes of a row so that updates can be
+-- made conditional on the version a client read. Existing rows start at 1.
+ALTER TABLE positions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE employees ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
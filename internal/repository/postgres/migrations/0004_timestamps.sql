@@ -0,0 +1,29 @@
+-- created_at and updated_at are kept by the repository. Rows written before
+-- this migration get the time it ran.
+ALTER TABLE positions
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE employees
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- table_changes holds when a statement last wrote to each table, which is
+-- the Last-Modified of its lists: a delete, or an update that moves a row out
+-- of a filter, changes a list without leaving a newer updated_at in it.
+CREATE TABLE table_changes (
+    name       TEXT PRIMARY KEY,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+INSERT INTO table_changes (name, changed_at) VALUES ('positions', now()), ('employees', now());
+
+CREATE FUNCTION touch_table_changes() RETURNS trigger AS $$
+BEGIN
+    UPDATE table_changes SET changed_at = now() WHERE name = TG_TABLE_NAME;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER positions_changed AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON positions
+    FOR EACH STATEMENT EXECUTE PROCEDURE touch_table_changes();
+CREATE TRIGGER employees_changed AFTER INSERT OR UPDATE OR DELETE OR TRUNCATE ON employees
+    FOR EACH STATEMENT EXECUTE PROCEDURE touch_table_changes();
@@ -0,0 +1,8 @@
+-- deleted_at is set when a row is moved to the trash. Rows in the trash are
+-- left out of everything but the trash, lists that ask for them and the
+-- purge, which finds them by age through the partial indexes.
+ALTER TABLE positions ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE employees ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX positions_deleted_at_idx ON positions (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX employees_deleted_at_idx ON employees (deleted_at) WHERE deleted_at IS NOT NULL;
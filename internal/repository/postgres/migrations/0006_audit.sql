@@ -0,0 +1,17 @@
+-- The audit trail. Rows are only ever inserted; changes holds the field-level
+-- diff as a JSON array of {field, before, after}. Entries are listed newest
+-- first, so the indexes end in id.
+CREATE TABLE audit_log (
+    id             BIGSERIAL PRIMARY KEY,
+    entity         TEXT NOT NULL,
+    entity_id      UUID NOT NULL,
+    action         TEXT NOT NULL,
+    actor          TEXT NOT NULL,
+    correlation_id TEXT NOT NULL,
+    at             TIMESTAMPTZ NOT NULL,
+    changes        JSONB NOT NULL
+);
+
+CREATE INDEX audit_log_entity_idx ON audit_log (entity, entity_id, id);
+CREATE INDEX audit_log_actor_idx ON audit_log (actor, id);
+CREATE INDEX audit_log_at_idx ON audit_log (at);
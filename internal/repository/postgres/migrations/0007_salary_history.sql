@@ -0,0 +1,16 @@
+-- salary_records holds the effective-dated salaries of the positions. A
+-- record lasts until the next record of its position takes effect, so only
+-- effective_from is stored. positions.salary follows the record in effect.
+CREATE TABLE salary_records (
+    id             UUID PRIMARY KEY,
+    position_id    UUID NOT NULL REFERENCES positions (id) ON DELETE CASCADE,
+    amount         NUMERIC NOT NULL,
+    currency       TEXT NOT NULL,
+    effective_from TIMESTAMPTZ NOT NULL,
+    UNIQUE (position_id, effective_from)
+);
+
+-- Existing positions get a single record from their creation that shares
+-- their ID.
+INSERT INTO salary_records (id, position_id, amount, currency, effective_from)
+    SELECT id, id, salary, 'USD', created_at FROM positions;
@@ -0,0 +1,3 @@
+-- salary_currency is the currency of positions.salary, that of the salary
+-- record in effect. Every salary so far was in USD.
+ALTER TABLE positions ADD COLUMN salary_currency TEXT NOT NULL DEFAULT 'USD';
@@ -0,0 +1,21 @@
+-- current_positions shows the positions with the salary in effect now. A
+-- salary record that took effect since a position was last written counts as
+-- a write of it: each one adds to the version, and the last one is when the
+-- position was updated. Reads go through the view; writes store what it
+-- shows before they change a position.
+CREATE VIEW current_positions AS
+SELECT p.id, p.name,
+       coalesce(s.amount, p.salary) AS salary,
+       coalesce(s.currency, p.salary_currency) AS salary_currency,
+       p.version + coalesce(s.due, 0)::INTEGER AS version,
+       p.created_at,
+       coalesce(s.effective_from, p.updated_at) AS updated_at,
+       p.deleted_at,
+       p.search
+FROM positions p LEFT JOIN LATERAL (
+    SELECT amount, currency, effective_from, count(*) OVER () AS due
+    FROM salary_records
+    WHERE position_id = p.id AND effective_from > p.updated_at AND effective_from <= now()
+    ORDER BY effective_from DESC
+    LIMIT 1
+) s ON true;
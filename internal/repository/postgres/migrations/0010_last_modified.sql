@@ -0,0 +1,22 @@
+-- Inserts and updates leave a newer updated_at behind, so a list is as new
+-- as its newest row unless rows went away. table_changes now only records
+-- statements that remove rows, which leaves the other writers from queueing
+-- on its row. clock_timestamp and GREATEST keep a transaction that started
+-- earlier but commits later from moving it back.
+CREATE OR REPLACE FUNCTION touch_table_changes() RETURNS trigger AS $$
+BEGIN
+    UPDATE table_changes SET changed_at = GREATEST(changed_at, clock_timestamp()) WHERE name = TG_TABLE_NAME;
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER positions_changed ON positions;
+DROP TRIGGER employees_changed ON employees;
+CREATE TRIGGER positions_changed AFTER DELETE OR TRUNCATE ON positions
+    FOR EACH STATEMENT EXECUTE PROCEDURE touch_table_changes();
+CREATE TRIGGER employees_changed AFTER DELETE OR TRUNCATE ON employees
+    FOR EACH STATEMENT EXECUTE PROCEDURE touch_table_changes();
+
+CREATE INDEX positions_updated_at ON positions (updated_at);
+CREATE INDEX employees_updated_at ON employees (updated_at);
+CREATE INDEX salary_records_effective_from ON salary_records (effective_from);
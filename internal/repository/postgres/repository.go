@@ -0,0 +1,783 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	errs "errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// foreignKeyViolation is the SQLSTATE Postgres reports when a row references
+// a key that does not exist.
+const foreignKeyViolation = "23503"
+
+const (
+	positionColumns = "id, name, salary, salary_currency, version, created_at, updated_at, deleted_at"
+	employeeColumns = "id, first_name, las_name, position_id, version, created_at, updated_at, deleted_at"
+	// selectPositions reads current_positions, which has the salary in
+	// effect now.
+	selectPositions = "SELECT " + positionColumns + " FROM current_positions"
+	selectEmployees = "SELECT " + employeeColumns + " FROM employees"
+)
+
+// livePosition is the condition that the position $n is not in the trash. The
+// row is locked, so that it cannot be trashed before the statement commits.
+func livePosition(n int) string {
+	return "EXISTS (SELECT 1 FROM positions WHERE id = $" + strconv.Itoa(n) + " AND deleted_at IS NULL FOR SHARE)"
+}
+
+// querier runs a query on a *sql.DB or in a *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepo(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (t Repository) GetPositionByID(ctx context.Context, id uuid.UUID) (internal.Position, error) {
+	var p internal.Position
+	err := scanPosition(t.db.QueryRowContext(ctx, selectPositions+" WHERE id = $1 AND deleted_at IS NULL", id), &p)
+	if err != nil {
+		return internal.Position{}, mapError(err)
+	}
+	return p, nil
+}
+
+func (t Repository) GetEmployeeByID(ctx context.Context, id uuid.UUID) (internal.Employee, error) {
+	var e internal.Employee
+	err := scanEmployee(t.db.QueryRowContext(ctx, selectEmployees+" WHERE id = $1 AND deleted_at IS NULL", id), &e)
+	if err != nil {
+		return internal.Employee{}, mapError(err)
+	}
+	return e, nil
+}
+
+func (t Repository) ListPositions(ctx context.Context, f internal.PositionFilter, limit, offset int) ([]internal.Position, error) {
+	f, err := t.withRates(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	q := positionQuery(f)
+	stmt := selectPositions + q.String() + q.orderBy(f.Sort) + " LIMIT " + q.arg(limit) + " OFFSET " + q.arg(offset)
+	return queryPositions(ctx, t.db, stmt, q.args...)
+}
+
+func (t Repository) ListEmployees(ctx context.Context, f internal.EmployeeFilter, limit, offset int) ([]internal.Employee, error) {
+	q := employeeQuery(f)
+	stmt := selectEmployees + q.String() + q.orderBy(f.Sort) + " LIMIT " + q.arg(limit) + " OFFSET " + q.arg(offset)
+	return queryEmployees(ctx, t.db, stmt, q.args...)
+}
+
+func (t Repository) ListPositionsAfter(
+	ctx context.Context, f internal.PositionFilter, after uuid.UUID, limit int,
+) ([]internal.Position, error) {
+	f, err := t.withRates(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	q := positionQuery(f)
+	q.where("id > " + q.arg(after))
+	stmt := selectPositions + q.String() + " ORDER BY id LIMIT " + q.arg(limit)
+	return queryPositions(ctx, t.db, stmt, q.args...)
+}
+
+func (t Repository) ListEmployeesAfter(
+	ctx context.Context, f internal.EmployeeFilter, after uuid.UUID, limit int,
+) ([]internal.Employee, error) {
+	q := employeeQuery(f)
+	q.where("id > " + q.arg(after))
+	stmt := selectEmployees + q.String() + " ORDER BY id LIMIT " + q.arg(limit)
+	return queryEmployees(ctx, t.db, stmt, q.args...)
+}
+
+func (t Repository) FindPositionsByName(ctx context.Context, name string) ([]internal.Position, error) {
+	return queryPositions(ctx, t.db, selectPositions+" WHERE name = $1 AND deleted_at IS NULL", name)
+}
+
+func (t Repository) FindEmployeesByName(ctx context.Context, firstName, lasName string) ([]internal.Employee, error) {
+	return queryEmployees(ctx, t.db,
+		selectEmployees+" WHERE first_name = $1 AND las_name = $2 AND deleted_at IS NULL", firstName, lasName)
+}
+
+func (t Repository) FindEmployeesByPosition(ctx context.Context, positionID uuid.UUID) ([]internal.Employee, error) {
+	return queryEmployees(ctx, t.db, selectEmployees+" WHERE position_id = $1 AND deleted_at IS NULL", positionID)
+}
+
+// Search returns at most limit employees and positions matching every word
+// of query, best first. Every word also matches the words it begins.
+func (t Repository) Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error) {
+	results := make([]internal.SearchResult, 0)
+	tokens := internal.Tokenize(query)
+	if len(tokens) == 0 {
+		return results, nil
+	}
+	rows, err := t.db.QueryContext(ctx, searchQuery, tsQuery(tokens), limit)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r                internal.SearchResult
+			id               uuid.UUID
+			first, las, name sql.NullString
+			positionID       uuid.NullUUID
+			salary           decimal.NullDecimal
+			currency         sql.NullString
+			version          int
+			created, updated time.Time
+		)
+		err := rows.Scan(
+			&r.Type, &id, &first, &las, &positionID, &name, &salary, &currency, &version, &created, &updated, &r.Score,
+		)
+		if err != nil {
+			return nil, mapError(err)
+		}
+		if r.Type == internal.SearchTypeEmployee {
+			r.Employee = &internal.Employee{
+				ID: id, FirstName: first.String, LasName: las.String, PositionID: positionID.UUID,
+				Version: version, CreatedAt: created, UpdatedAt: updated,
+			}
+		} else {
+			r.Position = &internal.Position{
+				ID: id, Name: name.String, Salary: internal.NewMoney(salary.Decimal, currency.String),
+				Version: version, CreatedAt: created, UpdatedAt: updated,
+			}
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	return results, nil
+}
+
+func (t Repository) CountPositions(ctx context.Context, f internal.PositionFilter) (int, error) {
+	f, err := t.withRates(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+	q := positionQuery(f)
+	return t.count(ctx, "SELECT count(*) FROM current_positions"+q.String(), q.args...)
+}
+
+// withRates returns f with the rates of the currencies of the stored
+// salaries, if it compares salaries. The errors of f.SalaryRate are returned
+// as they are.
+func (t Repository) withRates(ctx context.Context, f internal.PositionFilter) (internal.PositionFilter, error) {
+	if !f.ComparesSalaries() {
+		return f, nil
+	}
+	rows, err := t.db.QueryContext(ctx, "SELECT DISTINCT salary_currency FROM current_positions ORDER BY 1")
+	if err != nil {
+		return f, mapError(err)
+	}
+	defer rows.Close()
+	var currencies []string
+	for rows.Next() {
+		var currency string
+		if err := rows.Scan(&currency); err != nil {
+			return f, mapError(err)
+		}
+		currencies = append(currencies, currency)
+	}
+	if err := rows.Err(); err != nil {
+		return f, mapError(err)
+	}
+	return f.WithRates(currencies)
+}
+
+func (t Repository) CountEmployees(ctx context.Context, f internal.EmployeeFilter) (int, error) {
+	q := employeeQuery(f)
+	return t.count(ctx, "SELECT count(*) FROM employees"+q.String(), q.args...)
+}
+
+// AddPosition inserts nothing if a position outside the trash has the same
+// name and salary, which is PositionIsExists. The name is locked for the rest
+// of the transaction, so that concurrent inserts cannot both pass the check.
+func (t Repository) AddPosition(ctx context.Context, p *internal.Position) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	taken, err := lockName(ctx, tx, "positions", p.Name,
+		"SELECT EXISTS (SELECT 1 FROM current_positions WHERE name = $1 AND salary = $2 AND salary_currency = $3 "+
+			"AND deleted_at IS NULL)", p.Name, p.Salary.Amount, p.Salary.Currency)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.PositionIsExists()
+	}
+	err = tx.QueryRowContext(ctx,
+		"WITH p AS (INSERT INTO positions (id, name, salary, salary_currency, search) "+
+			"VALUES ($1, $2, $3, $4, to_tsvector('simple', $5)) RETURNING version, created_at, updated_at), "+
+			"s AS (INSERT INTO salary_records (id, position_id, amount, currency, effective_from) "+
+			"SELECT $6, $1, $3, $4, created_at FROM p) "+
+			"SELECT version, created_at, updated_at FROM p",
+		p.ID, p.Name, p.Salary.Amount, p.Salary.Currency, searchText(internal.PositionTokens(*p)), uuid.New()).
+		Scan(&p.Version, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return mapError(err)
+	}
+	p.DeletedAt = nil
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityPosition, Action: internal.AuditCreate, ID: p.ID, After: *p,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// AddEmployee inserts nothing unless the position exists outside the trash,
+// which is PositionIsNotExists, or if an employee outside the trash has the
+// same name, which is EmployeeIsExists.
+func (t Repository) AddEmployee(ctx context.Context, e *internal.Employee) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err := lockPosition(ctx, tx, e.PositionID, "FOR SHARE"); err != nil {
+		if errs.Is(err, errors.NotFound()) {
+			return errors.PositionIsNotExists()
+		}
+		return err
+	}
+	taken, err := lockName(ctx, tx, "employees", e.FirstName+" "+e.LasName,
+		"SELECT EXISTS (SELECT 1 FROM employees WHERE first_name = $1 AND las_name = $2 AND deleted_at IS NULL)",
+		e.FirstName, e.LasName)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.EmployeeIsExists()
+	}
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO employees (id, first_name, las_name, position_id, search) "+
+			"VALUES ($1, $2, $3, $4, to_tsvector('simple', $5)) RETURNING version, created_at, updated_at",
+		e.ID, e.FirstName, e.LasName, e.PositionID, searchText(internal.EmployeeTokens(*e))).
+		Scan(&e.Version, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return mapError(err)
+	}
+	e.DeletedAt = nil
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityEmployee, Action: internal.AuditCreate, ID: e.ID, After: *e,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// DeletePosition moves the position to the trash and deals with its employees
+// as d says, all in one transaction. The position is locked first, which
+// keeps anyone from taking it on until the transaction ends.
+func (t Repository) DeletePosition(ctx context.Context, id uuid.UUID, d internal.PositionDeletion) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err := lockPosition(ctx, tx, id, "FOR UPDATE"); err != nil {
+		return err
+	}
+	if err := saveSalary(ctx, tx, id); err != nil {
+		return err
+	}
+	var p internal.Position
+	err = scanPosition(tx.QueryRowContext(ctx, "SELECT "+positionColumns+" FROM positions WHERE id = $1", id), &p)
+	if err != nil {
+		return mapError(err)
+	}
+	changes := []internal.Change{{Entity: internal.EntityPosition, Action: internal.AuditDelete, ID: id, Before: p}}
+	var employees []internal.Employee
+	if d.Mode == internal.DeleteCascade || d.Mode == internal.DeleteReassign {
+		employees, err = queryEmployees(ctx, tx,
+			selectEmployees+" WHERE position_id = $1 AND deleted_at IS NULL ORDER BY id FOR UPDATE", id)
+		if err != nil {
+			return err
+		}
+	}
+	switch d.Mode {
+	case internal.DeleteCascade:
+		_, err := tx.ExecContext(ctx, "UPDATE employees SET "+trash+" WHERE position_id = $1 AND deleted_at IS NULL", id)
+		if err != nil {
+			return mapError(err)
+		}
+		for _, e := range employees {
+			changes = append(changes, internal.Change{
+				Entity: internal.EntityEmployee, Action: internal.AuditDelete, ID: e.ID, Before: e,
+			})
+		}
+	case internal.DeleteReassign:
+		if d.ReassignTo == id {
+			return errors.PositionIsNotExists()
+		}
+		if err := lockPosition(ctx, tx, d.ReassignTo, "FOR SHARE"); err != nil {
+			if errs.Is(err, errors.NotFound()) {
+				return errors.PositionIsNotExists()
+			}
+			return err
+		}
+		moved, err := queryEmployees(ctx, tx,
+			"UPDATE employees SET position_id = $2, version = version + 1, updated_at = now() "+
+				"WHERE position_id = $1 AND deleted_at IS NULL RETURNING "+employeeColumns,
+			id, d.ReassignTo)
+		if err != nil {
+			return err
+		}
+		after := make(map[uuid.UUID]internal.Employee, len(moved))
+		for _, e := range moved {
+			after[e.ID] = e
+		}
+		for _, e := range employees {
+			changes = append(changes, internal.Change{
+				Entity: internal.EntityEmployee, Action: internal.AuditUpdate, ID: e.ID, Before: e, After: after[e.ID],
+			})
+		}
+	default:
+		if err := blockingEmployees(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE positions SET "+trash+" WHERE id = $1", id); err != nil {
+		return mapError(err)
+	}
+	if err := audit(ctx, tx, changes...); err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// DeleteEmployee moves the employee to the trash.
+func (t Repository) DeleteEmployee(ctx context.Context, id uuid.UUID) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	var e internal.Employee
+	err = scanEmployee(tx.QueryRowContext(ctx,
+		selectEmployees+" WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id), &e)
+	if err != nil {
+		return mapError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE employees SET "+trash+" WHERE id = $1", id); err != nil {
+		return mapError(err)
+	}
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityEmployee, Action: internal.AuditDelete, ID: id, Before: e,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// RestorePosition takes the position out of the trash and returns it with
+// the next version. A position that is not in the trash is NotFound.
+func (t Repository) RestorePosition(ctx context.Context, id uuid.UUID) (internal.Position, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return internal.Position{}, mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err := saveSalary(ctx, tx, id); err != nil {
+		return internal.Position{}, err
+	}
+	var p internal.Position
+	err = scanPosition(tx.QueryRowContext(ctx,
+		"UPDATE positions SET "+restore+" WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+positionColumns, id), &p)
+	if err != nil {
+		return internal.Position{}, mapError(err)
+	}
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityPosition, Action: internal.AuditRestore, ID: id, After: p,
+	})
+	if err != nil {
+		return internal.Position{}, err
+	}
+	return p, mapError(tx.Commit())
+}
+
+// RestoreEmployee works like RestorePosition. An employee whose position is
+// still in the trash is PositionIsNotExists until the position is restored.
+func (t Repository) RestoreEmployee(ctx context.Context, id uuid.UUID) (internal.Employee, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return internal.Employee{}, mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	var e internal.Employee
+	err = scanEmployee(tx.QueryRowContext(ctx,
+		"UPDATE employees SET "+restore+" WHERE id = $1 AND deleted_at IS NOT NULL AND "+
+			"EXISTS (SELECT 1 FROM positions WHERE id = employees.position_id AND deleted_at IS NULL FOR SHARE) "+
+			"RETURNING "+employeeColumns, id), &e)
+	if !errs.Is(err, sql.ErrNoRows) {
+		if err != nil {
+			return internal.Employee{}, mapError(err)
+		}
+		err = audit(ctx, tx, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditRestore, ID: id, After: e,
+		})
+		if err != nil {
+			return internal.Employee{}, err
+		}
+		return e, mapError(tx.Commit())
+	}
+	var trashed bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM employees WHERE id = $1 AND deleted_at IS NOT NULL)", id).Scan(&trashed)
+	if err != nil {
+		return internal.Employee{}, mapError(err)
+	}
+	if trashed {
+		return internal.Employee{}, errors.PositionIsNotExists()
+	}
+	return internal.Employee{}, errors.NotFound()
+}
+
+// Trash returns the rows in the trash, the most recently deleted first.
+func (t Repository) Trash(ctx context.Context) (internal.Trash, error) {
+	const trashed = " WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id"
+	positions, err := queryPositions(ctx, t.db, selectPositions+trashed)
+	if err != nil {
+		return internal.Trash{}, err
+	}
+	employees, err := queryEmployees(ctx, t.db, selectEmployees+trashed)
+	if err != nil {
+		return internal.Trash{}, err
+	}
+	return internal.Trash{Positions: positions, Employees: employees}, nil
+}
+
+// Purge deletes for good the rows that went to the trash before before and
+// returns how many there were. A position stays while an employee still
+// refers to it.
+func (t Repository) Purge(ctx context.Context, before time.Time) (int, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	employees, err := queryEmployees(ctx, tx,
+		"DELETE FROM employees WHERE deleted_at < $1 RETURNING "+employeeColumns, before)
+	if err != nil {
+		return 0, err
+	}
+	positions, err := queryPositions(ctx, tx,
+		"DELETE FROM positions WHERE deleted_at < $1 "+
+			"AND NOT EXISTS (SELECT 1 FROM employees WHERE position_id = positions.id) RETURNING "+positionColumns,
+		before)
+	if err != nil {
+		return 0, err
+	}
+	changes := make([]internal.Change, 0, len(employees)+len(positions))
+	for _, e := range employees {
+		changes = append(changes, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditPurge, ID: e.ID, Before: e,
+		})
+	}
+	for _, p := range positions {
+		changes = append(changes, internal.Change{
+			Entity: internal.EntityPosition, Action: internal.AuditPurge, ID: p.ID, Before: p,
+		})
+	}
+	if err := audit(ctx, tx, changes...); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, mapError(err)
+	}
+	return len(changes), nil
+}
+
+// PositionsChanged returns when a position was last written or removed, or
+// a salary record last took effect, whichever is latest.
+func (t Repository) PositionsChanged(ctx context.Context) (time.Time, error) {
+	return t.changed(ctx, "positions",
+		"(SELECT max(effective_from) FROM salary_records WHERE effective_from <= now())")
+}
+
+// EmployeesChanged returns when an employee was last written or removed.
+func (t Repository) EmployeesChanged(ctx context.Context) (time.Time, error) {
+	return t.changed(ctx, "employees")
+}
+
+// UpdatePosition replaces the position, keeping when it was created, and
+// gives it the next version and a new updated_at. A position naming a version
+// other than the stored one is PreconditionFailed; version 0 updates whatever
+// is stored. A new salary is added to the salary records from updated_at on.
+func (t Repository) UpdatePosition(ctx context.Context, p *internal.Position) error {
+	p.DeletedAt = nil
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err := lockPosition(ctx, tx, p.ID, "FOR UPDATE"); err != nil {
+		return err
+	}
+	if err := saveSalary(ctx, tx, p.ID); err != nil {
+		return err
+	}
+	var current internal.Position
+	err = scanPosition(tx.QueryRowContext(ctx, "SELECT "+positionColumns+" FROM positions WHERE id = $1", p.ID), &current)
+	if err != nil {
+		return mapError(err)
+	}
+	err = updateVersion(ctx, tx, "positions", p.ID, p.Version, errors.PreconditionFailed(),
+		[]interface{}{&p.Version, &p.CreatedAt, &p.UpdatedAt},
+		"UPDATE positions SET name = $2, salary = $3, salary_currency = $4, search = to_tsvector('simple', $5), "+
+			"version = version + 1, updated_at = now() "+
+			"WHERE id = $1 AND deleted_at IS NULL AND ($6::INTEGER = 0 OR version = $6) "+
+			"RETURNING version, created_at, updated_at",
+		p.ID, p.Name, p.Salary.Amount, p.Salary.Currency, searchText(internal.PositionTokens(*p)), p.Version)
+	if err != nil {
+		return err
+	}
+	if !current.Salary.Equal(p.Salary) {
+		if err := recordSalary(ctx, tx, p.ID, p.Salary, p.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityPosition, Action: internal.AuditUpdate, ID: p.ID, Before: current, After: *p,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// UpdateEmployee checks the version like UpdatePosition. A position that is
+// missing or in the trash is PositionIsNotExists.
+func (t Repository) UpdateEmployee(ctx context.Context, e *internal.Employee) error {
+	e.DeletedAt = nil
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	var current internal.Employee
+	err = scanEmployee(tx.QueryRowContext(ctx,
+		selectEmployees+" WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", e.ID), &current)
+	if err != nil {
+		return mapError(err)
+	}
+	err = updateVersion(ctx, tx, "employees", e.ID, e.Version, errors.PositionIsNotExists(),
+		[]interface{}{&e.Version, &e.CreatedAt, &e.UpdatedAt},
+		"UPDATE employees SET first_name = $2, las_name = $3, position_id = $4, "+
+			"search = to_tsvector('simple', $5), version = version + 1, updated_at = now() "+
+			"WHERE id = $1 AND deleted_at IS NULL AND ($6::INTEGER = 0 OR version = $6) AND "+livePosition(4)+
+			" RETURNING version, created_at, updated_at",
+		e.ID, e.FirstName, e.LasName, e.PositionID, searchText(internal.EmployeeTokens(*e)), e.Version)
+	if isForeignKeyViolation(err) {
+		return errors.PositionIsNotExists()
+	}
+	if err != nil {
+		return err
+	}
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityEmployee, Action: internal.AuditUpdate, ID: e.ID, Before: current, After: *e,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// queryPositions runs a query returning rows of positionColumns.
+func queryPositions(ctx context.Context, q querier, query string, args ...interface{}) ([]internal.Position, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	positions := make([]internal.Position, 0)
+	for rows.Next() {
+		var p internal.Position
+		if err := scanPosition(rows, &p); err != nil {
+			return nil, mapError(err)
+		}
+		positions = append(positions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	return positions, nil
+}
+
+// queryEmployees runs a query returning rows of employeeColumns.
+func queryEmployees(ctx context.Context, q querier, query string, args ...interface{}) ([]internal.Employee, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	employees := make([]internal.Employee, 0)
+	for rows.Next() {
+		var e internal.Employee
+		if err := scanEmployee(rows, &e); err != nil {
+			return nil, mapError(err)
+		}
+		employees = append(employees, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	return employees, nil
+}
+
+func (t Repository) count(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var n int
+	if err := t.db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, mapError(err)
+	}
+	return n, nil
+}
+
+// changed returns the latest of when a statement last removed rows from
+// table, the newest updated_at in it and the times more says.
+func (t Repository) changed(ctx context.Context, table string, more ...string) (time.Time, error) {
+	times := append([]string{
+		"(SELECT changed_at FROM table_changes WHERE name = '" + table + "')",
+		"(SELECT max(updated_at) FROM " + table + ")",
+	}, more...)
+	var changed time.Time
+	err := t.db.QueryRowContext(ctx, "SELECT GREATEST("+strings.Join(times, ", ")+")").Scan(&changed)
+	return changed, mapError(err)
+}
+
+// updateVersion runs an UPDATE of the row id in table, expected at version
+// unless that is 0, that returns the new version and timestamps into dest.
+// When no row is updated it tells a row that is missing or in the trash,
+// NotFound, from a stale version, PreconditionFailed; if neither is the case
+// another condition of the UPDATE failed, which is otherwise. Foreign key
+// violations are returned as is like exec does.
+func updateVersion(
+	ctx context.Context, q querier, table string, id uuid.UUID, version int, otherwise error,
+	dest []interface{}, query string, args ...interface{},
+) error {
+	err := q.QueryRowContext(ctx, query, args...).Scan(dest...)
+	if !errs.Is(err, sql.ErrNoRows) {
+		if isForeignKeyViolation(err) {
+			return err
+		}
+		return mapError(err)
+	}
+	var stored int
+	err = q.QueryRowContext(ctx, "SELECT version FROM "+table+" WHERE id = $1 AND deleted_at IS NULL", id).
+		Scan(&stored)
+	if err != nil {
+		return mapError(err)
+	}
+	if version != 0 && version != stored {
+		return errors.PreconditionFailed()
+	}
+	return otherwise
+}
+
+// trash and restore are the SET clauses that move a row into and out of the
+// trash.
+const (
+	trash   = "deleted_at = now(), version = version + 1, updated_at = now()"
+	restore = "deleted_at = NULL, version = version + 1, updated_at = now()"
+)
+
+// scanPosition reads a row of positionColumns into p.
+func scanPosition(row interface{ Scan(...interface{}) error }, p *internal.Position) error {
+	return row.Scan(
+		&p.ID, &p.Name, &p.Salary.Amount, &p.Salary.Currency, &p.Version, &p.CreatedAt, &p.UpdatedAt, &p.DeletedAt,
+	)
+}
+
+// scanEmployee reads a row of employeeColumns into e.
+func scanEmployee(row interface{ Scan(...interface{}) error }, e *internal.Employee) error {
+	return row.Scan(&e.ID, &e.FirstName, &e.LasName, &e.PositionID, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.DeletedAt)
+}
+
+// lockPosition locks the row of the position id in tx with lock, FOR UPDATE
+// or FOR SHARE, and is NotFound if there is none outside the trash.
+func lockPosition(ctx context.Context, tx *sql.Tx, id uuid.UUID, lock string) error {
+	var locked uuid.UUID
+	err := tx.QueryRowContext(ctx, "SELECT id FROM positions WHERE id = $1 AND deleted_at IS NULL "+lock, id).Scan(&locked)
+	return mapError(err)
+}
+
+// lockName locks the name in table until tx ends and then runs exists, a
+// query telling whether the name is taken.
+func lockName(ctx context.Context, tx *sql.Tx, table, name, exists string, args ...interface{}) (bool, error) {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", table+":"+name); err != nil {
+		return false, mapError(err)
+	}
+	var taken bool
+	err := tx.QueryRowContext(ctx, exists, args...).Scan(&taken)
+	return taken, mapError(err)
+}
+
+// blockingEmployees is PositionIsUsed naming the employees that hold the
+// position id, or nil if nobody does.
+func blockingEmployees(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	rows, err := tx.QueryContext(ctx,
+		"SELECT id FROM employees WHERE position_id = $1 AND deleted_at IS NULL ORDER BY id", id)
+	if err != nil {
+		return mapError(err)
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var employee uuid.UUID
+		if err := rows.Scan(&employee); err != nil {
+			return mapError(err)
+		}
+		ids = append(ids, employee)
+	}
+	if err := rows.Err(); err != nil {
+		return mapError(err)
+	}
+	if len(ids) > 0 {
+		return errors.PositionIsUsedBy(ids)
+	}
+	return nil
+}
+
+// mapError turns driver errors into the errors the in-memory repository
+// returns. Context errors are passed through so that callers can tell a
+// cancelled request from a broken database.
+func mapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errs.Is(err, sql.ErrNoRows):
+		return errors.NotFound()
+	case errs.Is(err, context.Canceled), errs.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	logrus.WithError(err).Error("postgres")
+	return errors.StatusInternalServerError()
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errs.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+)
+
+// putSalary adds a salary record, replacing the one of the position that
+// takes effect at the same time.
+const putSalary = "INSERT INTO salary_records (id, position_id, amount, currency, effective_from) " +
+	"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (position_id, effective_from) " +
+	"DO UPDATE SET id = EXCLUDED.id, amount = EXCLUDED.amount, currency = EXCLUDED.currency"
+
+// applySalary sets the salary of the position $1 to the record in effect now
+// where that differs, as a write of the position. It catches a record dated
+// before the position was last written, which current_positions leaves out.
+const applySalary = "UPDATE positions SET salary = s.amount, salary_currency = s.currency, " +
+	"version = version + 1, updated_at = now() " +
+	"FROM (SELECT amount, currency FROM salary_records " +
+	"WHERE position_id = $1 AND effective_from <= now() ORDER BY effective_from DESC LIMIT 1) s " +
+	"WHERE positions.id = $1 AND (positions.salary <> s.amount OR positions.salary_currency <> s.currency)"
+
+// saveSalaryQuery stores the position $1 as current_positions shows it.
+const saveSalaryQuery = "UPDATE positions SET salary = c.salary, salary_currency = c.salary_currency, " +
+	"version = c.version, updated_at = c.updated_at FROM current_positions c " +
+	"WHERE c.id = positions.id AND positions.id = $1 AND c.version <> positions.version"
+
+// SalaryHistory returns the salary records of the position, oldest first. A
+// position in the trash is NotFound.
+func (t Repository) SalaryHistory(ctx context.Context, positionID uuid.UUID) ([]internal.SalaryRecord, error) {
+	rows, err := t.db.QueryContext(ctx,
+		"SELECT id, position_id, amount, currency, effective_from, "+
+			"lead(effective_from) OVER (ORDER BY effective_from) FROM salary_records "+
+			"WHERE position_id = $1 AND EXISTS (SELECT 1 FROM positions WHERE id = $1 AND deleted_at IS NULL) "+
+			"ORDER BY effective_from",
+		positionID)
+	if err != nil {
+		return nil, mapError(err)
+	}
+	defer rows.Close()
+	records := make([]internal.SalaryRecord, 0)
+	for rows.Next() {
+		var r internal.SalaryRecord
+		if err := rows.Scan(&r.ID, &r.PositionID, &r.Amount, &r.Currency, &r.EffectiveFrom, &r.EffectiveTo); err != nil {
+			return nil, mapError(err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, mapError(err)
+	}
+	if len(records) == 0 {
+		return nil, errors.NotFound()
+	}
+	return records, nil
+}
+
+// ScheduleSalary adds r to the salary records of its position, replacing a
+// record that takes effect at the same time, and sets its ID and
+// EffectiveTo. A record that is already in effect is applied at once.
+func (t Repository) ScheduleSalary(ctx context.Context, r *internal.SalaryRecord) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mapError(err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err := lockPosition(ctx, tx, r.PositionID, "FOR UPDATE"); err != nil {
+		return err
+	}
+	if err := saveSalary(ctx, tx, r.PositionID); err != nil {
+		return err
+	}
+	r.ID = uuid.New()
+	if _, err := tx.ExecContext(ctx, putSalary, r.ID, r.PositionID, r.Amount, r.Currency, r.EffectiveFrom); err != nil {
+		return mapError(err)
+	}
+	var next sql.NullTime
+	err = tx.QueryRowContext(ctx,
+		"SELECT min(effective_from) FROM salary_records WHERE position_id = $1 AND effective_from > $2",
+		r.PositionID, r.EffectiveFrom).Scan(&next)
+	if err != nil {
+		return mapError(err)
+	}
+	r.EffectiveTo = nil
+	if next.Valid {
+		r.EffectiveTo = &next.Time
+	}
+	if _, err := tx.ExecContext(ctx, applySalary, r.PositionID); err != nil {
+		return mapError(err)
+	}
+	err = audit(ctx, tx, internal.Change{
+		Entity: internal.EntityPosition, Action: internal.AuditScheduleSalary, ID: r.PositionID, After: *r,
+	})
+	if err != nil {
+		return err
+	}
+	return mapError(tx.Commit())
+}
+
+// recordSalary adds salary, taking effect at at, to the records of the
+// position id.
+func recordSalary(ctx context.Context, tx *sql.Tx, id uuid.UUID, salary internal.Money, at time.Time) error {
+	_, err := tx.ExecContext(ctx, putSalary, uuid.New(), id, salary.Amount, salary.Currency, at)
+	return mapError(err)
+}
+
+// saveSalary stores the position id with the salary in effect now, which
+// writes start from.
+func saveSalary(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, saveSalaryQuery, id)
+	return mapError(err)
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import "strings"
+
+// searchQuery ranks employees and positions outside the trash against the tsquery in $1 and
+// returns the best $2 of them. Ties are broken by type and ID like
+// internal.SortSearchResults does.
+const searchQuery = `SELECT type, id, first_name, las_name, position_id, name, salary, salary_currency, version,
+    created_at, updated_at, score FROM (
+    SELECT 'employee' AS type, id, first_name, las_name, position_id, NULL AS name, NULL::NUMERIC AS salary,
+           NULL AS salary_currency, version, created_at, updated_at, ts_rank(search, q) AS score
+    FROM employees, to_tsquery('simple', $1) q WHERE search @@ q AND deleted_at IS NULL
+    UNION ALL
+    SELECT 'position', id, NULL, NULL, NULL, name, salary, salary_currency, version, created_at, updated_at,
+           ts_rank(search, q)
+    FROM current_positions, to_tsquery('simple', $1) q WHERE search @@ q AND deleted_at IS NULL
+) hits ORDER BY score DESC, type, id::TEXT COLLATE "C" LIMIT $2`
+
+// searchText joins tokens into the text stored in the search columns.
+func searchText(tokens []string) string {
+	return strings.Join(tokens, " ")
+}
+
+// tsQuery builds a tsquery that requires every token, each as a prefix.
+// internal.Tokenize only yields letters and digits, so no token can carry
+// tsquery syntax.
+func tsQuery(tokens []string) string {
+	parts := make([]string, len(tokens))
+	for i, token := range tokens {
+		parts[i] = token + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"context"
+	"sort"
+	"time"
+
 	"github.com/NVTer/rest-api-example/internal"
 	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
 )
 
 type Repository struct {
@@ -13,73 +18,531 @@ func NewRepo(data *Database) *Repository {
 	return &Repository{data: data}
 }
 
-func (t Repository) GetPositions() map[string]internal.Position {
-	return t.data.GetPosition()
+func (t Repository) GetPositionByID(ctx context.Context, id uuid.UUID) (internal.Position, error) {
+	var p internal.Position
+	err := t.view(ctx, func(tx *Tx) error {
+		var ok bool
+		p, ok = livePosition(tx, id.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		return nil
+	})
+	return p, err
 }
 
-func (t Repository) GetEmployees() map[string]internal.Employee {
-	return t.data.GetEmployees()
+func (t Repository) GetEmployeeByID(ctx context.Context, id uuid.UUID) (internal.Employee, error) {
+	var e internal.Employee
+	err := t.view(ctx, func(tx *Tx) error {
+		var ok bool
+		e, ok = liveEmployee(tx, id.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		return nil
+	})
+	return e, err
 }
 
-func (t Repository) AddPosition(p *internal.Position) {
-	t.data.GetPosition()[p.ID.String()] = *p
+// ListPositions returns up to limit positions matching f, skipping the first
+// offset of them. Without a sort in f they are ordered by ID.
+func (t Repository) ListPositions(ctx context.Context, f internal.PositionFilter, limit, offset int) ([]internal.Position, error) {
+	var positions []internal.Position
+	err := t.view(ctx, func(tx *Tx) error {
+		if listsAll(f.IsZero(), f.IncludeDeleted, tx.db.index.trashedPositions) {
+			positions = tx.PositionsPage("", offset, limit)
+			return nil
+		}
+		var err error
+		if positions, err = tx.FilterPositions(f); err != nil {
+			return err
+		}
+		lo, hi := bounds(len(positions), limit, offset)
+		positions = positions[lo:hi]
+		return nil
+	})
+	return positions, err
 }
 
-func (t Repository) AddEmployee(e *internal.Employee) {
-	t.data.GetEmployees()[e.ID.String()] = *e
+// ListEmployees returns up to limit employees matching f, skipping the first
+// offset of them. Without a sort in f they are ordered by ID.
+func (t Repository) ListEmployees(ctx context.Context, f internal.EmployeeFilter, limit, offset int) ([]internal.Employee, error) {
+	var employees []internal.Employee
+	err := t.view(ctx, func(tx *Tx) error {
+		if listsAll(f.IsZero(), f.IncludeDeleted, tx.db.index.trashedEmployees) {
+			employees = tx.EmployeesPage("", offset, limit)
+			return nil
+		}
+		employees = tx.FilterEmployees(f)
+		lo, hi := bounds(len(employees), limit, offset)
+		employees = employees[lo:hi]
+		return nil
+	})
+	return employees, err
 }
 
-func (t Repository) DeletePosition(id string) error {
-	if _, ok := t.data.positions[id]; ok {
-		delete(t.data.positions, id)
+// ListPositionsAfter returns up to limit positions matching f whose ID sorts
+// after the given one. uuid.Nil starts from the beginning. The sort of f is
+// ignored, cursor pages are always ordered by ID.
+func (t Repository) ListPositionsAfter(
+	ctx context.Context, f internal.PositionFilter, after uuid.UUID, limit int,
+) ([]internal.Position, error) {
+	f.Sort = nil
+	var positions []internal.Position
+	err := t.view(ctx, func(tx *Tx) error {
+		if listsAll(f.IsZero(), f.IncludeDeleted, tx.db.index.trashedPositions) {
+			positions = tx.PositionsPage(after.String(), 0, limit)
+			return nil
+		}
+		var err error
+		if positions, err = tx.FilterPositions(f); err != nil {
+			return err
+		}
+		lo := sort.Search(len(positions), func(i int) bool {
+			return positions[i].ID.String() > after.String()
+		})
+		lo, hi := bounds(len(positions), limit, lo)
+		positions = positions[lo:hi]
 		return nil
-	}
-	return errors.NotFound()
+	})
+	return positions, err
+}
+
+// ListEmployeesAfter returns up to limit employees matching f whose ID sorts
+// after the given one. uuid.Nil starts from the beginning. The sort of f is
+// ignored, cursor pages are always ordered by ID.
+func (t Repository) ListEmployeesAfter(
+	ctx context.Context, f internal.EmployeeFilter, after uuid.UUID, limit int,
+) ([]internal.Employee, error) {
+	f.Sort = nil
+	var employees []internal.Employee
+	err := t.view(ctx, func(tx *Tx) error {
+		if listsAll(f.IsZero(), f.IncludeDeleted, tx.db.index.trashedEmployees) {
+			employees = tx.EmployeesPage(after.String(), 0, limit)
+			return nil
+		}
+		employees = tx.FilterEmployees(f)
+		lo := sort.Search(len(employees), func(i int) bool {
+			return employees[i].ID.String() > after.String()
+		})
+		lo, hi := bounds(len(employees), limit, lo)
+		employees = employees[lo:hi]
+		return nil
+	})
+	return employees, err
+}
+
+func (t Repository) FindPositionsByName(ctx context.Context, name string) ([]internal.Position, error) {
+	var positions []internal.Position
+	err := t.view(ctx, func(tx *Tx) error {
+		positions = tx.PositionsByName(name)
+		return nil
+	})
+	return positions, err
+}
+
+func (t Repository) FindEmployeesByName(ctx context.Context, firstName, lasName string) ([]internal.Employee, error) {
+	var employees []internal.Employee
+	err := t.view(ctx, func(tx *Tx) error {
+		employees = tx.EmployeesByName(firstName, lasName)
+		return nil
+	})
+	return employees, err
+}
+
+func (t Repository) FindEmployeesByPosition(ctx context.Context, positionID uuid.UUID) ([]internal.Employee, error) {
+	var employees []internal.Employee
+	err := t.view(ctx, func(tx *Tx) error {
+		employees = live(tx.EmployeesByPosition(positionID.String()))
+		return nil
+	})
+	return employees, err
 }
 
-func (t Repository) DeleteEmployee(id string) error {
-	if _, ok := t.data.employees[id]; ok {
-		delete(t.data.employees, id)
+// Search returns at most limit employees and positions matching every word
+// of query, best first.
+func (t Repository) Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error) {
+	var results []internal.SearchResult
+	err := t.view(ctx, func(tx *Tx) error {
+		results = tx.Search(internal.Tokenize(query), limit)
 		return nil
+	})
+	return results, err
+}
+
+func (t Repository) CountPositions(ctx context.Context, f internal.PositionFilter) (int, error) {
+	f.Sort = nil
+	var n int
+	err := t.view(ctx, func(tx *Tx) error {
+		if f.IsZero() {
+			n = len(tx.db.positions)
+			if !f.IncludeDeleted {
+				n -= len(tx.db.index.trashedPositions)
+			}
+			return nil
+		}
+		positions, err := tx.FilterPositions(f)
+		n = len(positions)
+		return err
+	})
+	return n, err
+}
+
+func (t Repository) CountEmployees(ctx context.Context, f internal.EmployeeFilter) (int, error) {
+	f.Sort = nil
+	var n int
+	err := t.view(ctx, func(tx *Tx) error {
+		if f.IsZero() {
+			n = len(tx.db.employees)
+			if !f.IncludeDeleted {
+				n -= len(tx.db.index.trashedEmployees)
+			}
+			return nil
+		}
+		n = len(tx.FilterEmployees(f))
+		return nil
+	})
+	return n, err
+}
+
+// AddPosition stores nothing if a position outside the trash has the same
+// name and salary, which is PositionIsExists.
+func (t Repository) AddPosition(ctx context.Context, p *internal.Position) error {
+	return t.update(ctx, func(tx *Tx) error {
+		for _, value := range tx.PositionsByName(p.Name) {
+			if value.Salary.Equal(p.Salary) {
+				return errors.PositionIsExists()
+			}
+		}
+		p.Version = 1
+		p.CreatedAt = now()
+		p.UpdatedAt = p.CreatedAt
+		p.DeletedAt = nil
+		tx.PutPosition(*p)
+		recordSalary(tx, *p, p.Salary, p.CreatedAt)
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityPosition, Action: internal.AuditCreate, ID: p.ID, After: *p,
+		})
+	})
+}
+
+// AddEmployee stores nothing unless the position exists outside the trash,
+// which is PositionIsNotExists, or if an employee outside the trash has the
+// same name, which is EmployeeIsExists.
+func (t Repository) AddEmployee(ctx context.Context, e *internal.Employee) error {
+	return t.update(ctx, func(tx *Tx) error {
+		if _, ok := livePosition(tx, e.PositionID.String()); !ok {
+			return errors.PositionIsNotExists()
+		}
+		if len(tx.EmployeesByName(e.FirstName, e.LasName)) > 0 {
+			return errors.EmployeeIsExists()
+		}
+		e.Version = 1
+		e.CreatedAt = now()
+		e.UpdatedAt = e.CreatedAt
+		e.DeletedAt = nil
+		tx.PutEmployee(*e)
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditCreate, ID: e.ID, After: *e,
+		})
+	})
+}
+
+// DeletePosition moves the position to the trash and deals with its employees
+// as d says; those already in the trash keep referring to it. Restricting, it
+// fails with PositionIsUsed naming the employees; a target to reassign them
+// to that does not exist, or is the position itself, is PositionIsNotExists.
+func (t Repository) DeletePosition(ctx context.Context, id uuid.UUID, d internal.PositionDeletion) error {
+	return t.update(ctx, func(tx *Tx) error {
+		p, ok := livePosition(tx, id.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		if d.Mode == internal.DeleteReassign {
+			if _, ok := livePosition(tx, d.ReassignTo.String()); !ok || d.ReassignTo == id {
+				return errors.PositionIsNotExists()
+			}
+		}
+		deleted := now()
+		changes := []internal.Change{{Entity: internal.EntityPosition, Action: internal.AuditDelete, ID: id, Before: p}}
+		employees := live(tx.EmployeesByPosition(id.String()))
+		switch {
+		case len(employees) == 0:
+		case d.Mode == internal.DeleteCascade:
+			for _, e := range employees {
+				tx.PutEmployee(trashEmployee(e, deleted))
+				changes = append(changes, internal.Change{
+					Entity: internal.EntityEmployee, Action: internal.AuditDelete, ID: e.ID, Before: e,
+				})
+			}
+		case d.Mode == internal.DeleteReassign:
+			for _, e := range employees {
+				moved := e
+				moved.PositionID = d.ReassignTo
+				moved.Version++
+				moved.UpdatedAt = deleted
+				tx.PutEmployee(moved)
+				changes = append(changes, internal.Change{
+					Entity: internal.EntityEmployee, Action: internal.AuditUpdate, ID: e.ID, Before: e, After: moved,
+				})
+			}
+		default:
+			return errors.PositionIsUsedBy(idsOf(employees))
+		}
+		p.Version++
+		p.UpdatedAt = deleted
+		p.DeletedAt = &deleted
+		tx.PutPosition(p)
+		return internal.Audit(ctx, changes...)
+	})
+}
+
+// DeleteEmployee moves the employee to the trash.
+func (t Repository) DeleteEmployee(ctx context.Context, id uuid.UUID) error {
+	return t.update(ctx, func(tx *Tx) error {
+		e, ok := liveEmployee(tx, id.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		tx.PutEmployee(trashEmployee(e, now()))
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditDelete, ID: id, Before: e,
+		})
+	})
+}
+
+// RestorePosition takes the position out of the trash and returns it with
+// the next version. A position that is not in the trash is NotFound.
+func (t Repository) RestorePosition(ctx context.Context, id uuid.UUID) (internal.Position, error) {
+	var p internal.Position
+	err := t.update(ctx, func(tx *Tx) error {
+		var ok bool
+		p, ok = tx.Position(id.String())
+		if !ok || p.DeletedAt == nil {
+			return errors.NotFound()
+		}
+		p.Version++
+		p.UpdatedAt = now()
+		p.DeletedAt = nil
+		tx.PutPosition(p)
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityPosition, Action: internal.AuditRestore, ID: id, After: p,
+		})
+	})
+	if err != nil {
+		return internal.Position{}, err
 	}
-	return errors.NotFound()
+	return p, nil
 }
 
-func (t Repository) UpdatePosition(p *internal.Position) error {
-	if _, ok := t.data.positions[p.ID.String()]; ok {
-		t.data.positions[p.ID.String()] = *p
+// RestoreEmployee works like RestorePosition. An employee whose position is
+// still in the trash is PositionIsNotExists until the position is restored.
+func (t Repository) RestoreEmployee(ctx context.Context, id uuid.UUID) (internal.Employee, error) {
+	var e internal.Employee
+	err := t.update(ctx, func(tx *Tx) error {
+		var ok bool
+		e, ok = tx.Employee(id.String())
+		if !ok || e.DeletedAt == nil {
+			return errors.NotFound()
+		}
+		if _, ok := livePosition(tx, e.PositionID.String()); !ok {
+			return errors.PositionIsNotExists()
+		}
+		e.Version++
+		e.UpdatedAt = now()
+		e.DeletedAt = nil
+		tx.PutEmployee(e)
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditRestore, ID: id, After: e,
+		})
+	})
+	if err != nil {
+		return internal.Employee{}, err
+	}
+	return e, nil
+}
+
+// Trash returns the records in the trash, the most recently deleted first.
+func (t Repository) Trash(ctx context.Context) (internal.Trash, error) {
+	var trash internal.Trash
+	err := t.view(ctx, func(tx *Tx) error {
+		trash.Positions = tx.TrashedPositions()
+		trash.Employees = tx.TrashedEmployees()
 		return nil
+	})
+	sort.SliceStable(trash.Positions, func(i, j int) bool {
+		return trash.Positions[i].DeletedAt.After(*trash.Positions[j].DeletedAt)
+	})
+	sort.SliceStable(trash.Employees, func(i, j int) bool {
+		return trash.Employees[i].DeletedAt.After(*trash.Employees[j].DeletedAt)
+	})
+	return trash, err
+}
+
+// Purge deletes for good the records that went to the trash before before
+// and returns how many there were. A position stays while an employee still
+// refers to it.
+func (t Repository) Purge(ctx context.Context, before time.Time) (int, error) {
+	var changes []internal.Change
+	err := t.update(ctx, func(tx *Tx) error {
+		changes = nil
+		for _, e := range tx.TrashedEmployees() {
+			if e.DeletedAt.Before(before) {
+				tx.DeleteEmployee(e.ID.String())
+				changes = append(changes, internal.Change{
+					Entity: internal.EntityEmployee, Action: internal.AuditPurge, ID: e.ID, Before: e,
+				})
+			}
+		}
+		for _, p := range tx.TrashedPositions() {
+			if p.DeletedAt.Before(before) && len(tx.EmployeesByPosition(p.ID.String())) == 0 {
+				tx.DeletePosition(p.ID.String())
+				changes = append(changes, internal.Change{
+					Entity: internal.EntityPosition, Action: internal.AuditPurge, ID: p.ID, Before: p,
+				})
+			}
+		}
+		return internal.Audit(ctx, changes...)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return errors.NotFound()
+	return len(changes), nil
 }
 
-func (t Repository) UpdateEmployee(e *internal.Employee) error {
-	if _, ok := t.data.employees[e.ID.String()]; ok {
-		if _, ok1 := t.data.positions[e.PositionID.String()]; ok1 {
-			t.data.employees[e.ID.String()] = *e
-			return nil
+// PositionsChanged returns when a position was last added, updated or
+// deleted, or when the database was opened if that was later.
+func (t Repository) PositionsChanged(ctx context.Context) (time.Time, error) {
+	var changed time.Time
+	err := t.view(ctx, func(tx *Tx) error {
+		changed = tx.PositionsChanged()
+		return nil
+	})
+	return changed, err
+}
+
+// EmployeesChanged works like PositionsChanged.
+func (t Repository) EmployeesChanged(ctx context.Context) (time.Time, error) {
+	var changed time.Time
+	err := t.view(ctx, func(tx *Tx) error {
+		changed = tx.EmployeesChanged()
+		return nil
+	})
+	return changed, err
+}
+
+// UpdatePosition replaces the stored position, keeping when it was created,
+// and gives it the next version and a new UpdatedAt. A position naming a
+// version other than the stored one is PreconditionFailed; version 0 updates
+// whatever is stored.
+func (t Repository) UpdatePosition(ctx context.Context, p *internal.Position) error {
+	return t.update(ctx, func(tx *Tx) error {
+		current, ok := livePosition(tx, p.ID.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		if p.Version != 0 && p.Version != current.Version {
+			return errors.PreconditionFailed()
+		}
+		p.Version = current.Version + 1
+		p.CreatedAt = current.CreatedAt
+		p.UpdatedAt = now()
+		p.DeletedAt = nil
+		tx.PutPosition(*p)
+		if !p.Salary.Equal(current.Salary) {
+			recordSalary(tx, current, p.Salary, p.UpdatedAt)
+		}
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityPosition, Action: internal.AuditUpdate, ID: p.ID, Before: current, After: *p,
+		})
+	})
+}
+
+// UpdateEmployee checks the version like UpdatePosition.
+func (t Repository) UpdateEmployee(ctx context.Context, e *internal.Employee) error {
+	return t.update(ctx, func(tx *Tx) error {
+		current, ok := liveEmployee(tx, e.ID.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		if e.Version != 0 && e.Version != current.Version {
+			return errors.PreconditionFailed()
+		}
+		if _, ok := livePosition(tx, e.PositionID.String()); !ok {
+			return errors.PositionIsNotExists()
 		}
-		return errors.PositionIsNotExists()
+		e.Version = current.Version + 1
+		e.CreatedAt = current.CreatedAt
+		e.UpdatedAt = now()
+		e.DeletedAt = nil
+		tx.PutEmployee(*e)
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityEmployee, Action: internal.AuditUpdate, ID: e.ID, Before: current, After: *e,
+		})
+	})
+}
+
+// view and update refuse to start a transaction for a context that is already
+// done. Once the lock is taken the work is in memory and is not interrupted.
+// The audit entries of an update are added before its changes are written to
+// the log, so a failure to audit rolls the update back; a failure to write
+// the log afterwards leaves entries for an update that did not happen.
+func (t Repository) view(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.data.View(fn)
+}
+
+func (t Repository) update(ctx context.Context, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	return errors.NotFound()
+	return t.data.Update(fn)
 }
 
-type Database struct {
-	employees map[string]internal.Employee
-	positions map[string]internal.Position
+// listsAll reports whether a filter that is zero apart from includeDeleted
+// lists every record of a map with trashed in the trash, so that pages can be
+// cut straight from the ID order.
+func listsAll(zero, includeDeleted bool, trashed idSet) bool {
+	return zero && (includeDeleted || len(trashed) == 0)
 }
 
-func NewDataBase() *Database {
-	return &Database{
-		employees: map[string]internal.Employee{},
-		positions: map[string]internal.Position{},
+// livePosition returns the position id unless it is missing or in the trash.
+func livePosition(tx *Tx, id string) (internal.Position, bool) {
+	p, ok := tx.Position(id)
+	return p, ok && p.DeletedAt == nil
+}
+
+// liveEmployee returns the employee id unless it is missing or in the trash.
+func liveEmployee(tx *Tx, id string) (internal.Employee, bool) {
+	e, ok := tx.Employee(id)
+	return e, ok && e.DeletedAt == nil
+}
+
+// live returns the employees that are not in the trash.
+func live(employees []internal.Employee) []internal.Employee {
+	kept := employees[:0]
+	for _, e := range employees {
+		if e.DeletedAt == nil {
+			kept = append(kept, e)
+		}
 	}
+	return kept
 }
 
-func (d Database) GetEmployees() map[string]internal.Employee {
-	return d.employees
+// trashEmployee returns e moved to the trash at deleted.
+func trashEmployee(e internal.Employee, deleted time.Time) internal.Employee {
+	e.Version++
+	e.UpdatedAt = deleted
+	e.DeletedAt = &deleted
+	return e
 }
 
-func (d Database) GetPosition() map[string]internal.Position {
-	return d.positions
+func idsOf(employees []internal.Employee) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(employees))
+	for _, e := range employees {
+		ids = append(ids, e.ID)
+	}
+	return ids
 }
@@ -1,8 +1,17 @@
 package repository
 
 import (
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/NVTer/rest-api-example/internal"
 	errs "github.com/NVTer/rest-api-example/internal/errors"
@@ -24,6 +33,43 @@ func updateData() {
 	employeeIDs = make([]string, 0)
 }
 
+// untrashedPositions leaves out the positions in the trash.
+func untrashedPositions(m map[string]internal.Position) map[string]internal.Position {
+	for id, p := range m {
+		if p.DeletedAt != nil {
+			delete(m, id)
+		}
+	}
+	return m
+}
+
+// untrashedEmployees leaves out the employees in the trash.
+func untrashedEmployees(m map[string]internal.Employee) map[string]internal.Employee {
+	for id, e := range m {
+		if e.DeletedAt != nil {
+			delete(m, id)
+		}
+	}
+	return m
+}
+
+// positionsWithoutTimes clears the timestamps, which every add sets anew.
+func positionsWithoutTimes(m map[string]internal.Position) map[string]internal.Position {
+	for id, p := range m {
+		p.CreatedAt, p.UpdatedAt = time.Time{}, time.Time{}
+		m[id] = p
+	}
+	return m
+}
+
+func employeesWithoutTimes(m map[string]internal.Employee) map[string]internal.Employee {
+	for id, e := range m {
+		e.CreatedAt, e.UpdatedAt = time.Time{}, time.Time{}
+		m[id] = e
+	}
+	return m
+}
+
 func createPosID() uuid.UUID {
 	id := uuid.New()
 	positionIDs = append(positionIDs, id.String())
@@ -38,8 +84,8 @@ func createEmpID() uuid.UUID {
 
 func TestGetPositions(t *testing.T) {
 	updateData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	testTable := []struct {
 		expected map[string]internal.Position
 	}{
@@ -50,7 +96,7 @@ func TestGetPositions(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.GetPositions()
+		result := data.GetPosition()
 		assert.Equal(t, result, testCase.expected)
 	}
 }
@@ -60,16 +106,16 @@ func TestGetEmployees(t *testing.T) {
 	p := internal.Position{
 		ID:     createPosID(),
 		Name:   "worker",
-		Salary: decimal.New(500, 0),
+		Salary: internal.NewMoney(decimal.New(500, 0), "USD"),
 	}
-	repos.AddPosition(&p)
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	e := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: p.ID,
 	}
-	repos.AddEmployee(&e)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &e))
 	testTable := []struct {
 		expected map[string]internal.Employee
 	}{
@@ -80,7 +126,7 @@ func TestGetEmployees(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.GetEmployees()
+		result := data.GetEmployees()
 		assert.Equal(t, result, testCase.expected)
 	}
 }
@@ -90,21 +136,22 @@ func TestAddEmployee(t *testing.T) {
 	p := internal.Position{
 		ID:     createPosID(),
 		Name:   "worker",
-		Salary: decimal.New(500, 0),
+		Salary: internal.NewMoney(decimal.New(500, 0), "USD"),
 	}
-	repos.AddPosition(&p)
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	e := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: p.ID,
 	}
-	repos.AddEmployee(&e)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &e))
 	newEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Bread",
 		LasName:    "Brown",
 		PositionID: p.ID,
+		Version:    1,
 	}
 	testTable := []struct {
 		expected map[string]internal.Employee
@@ -125,17 +172,18 @@ func TestAddEmployee(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		updateData()
-		repos.AddEmployee(&testCase.add)
-		result := repos.GetEmployees()
-		assert.Equal(t, result, testCase.expected)
+		assert.NoError(t, repos.AddPosition(context.Background(), &p))
+		assert.NoError(t, repos.AddEmployee(context.Background(), &testCase.add))
+		result := data.GetEmployees()
+		assert.Equal(t, employeesWithoutTimes(result), employeesWithoutTimes(testCase.expected))
 	}
 }
 
 func TestAddPosition(t *testing.T) {
 	updateData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
-	newPos := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(2000, 0)}
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
+	newPos := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD"), Version: 1}
 	testTable := []struct {
 		expected map[string]internal.Position
 		add      internal.Position
@@ -155,29 +203,29 @@ func TestAddPosition(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		updateData()
-		repos.AddPosition(&testCase.add)
-		result := repos.GetPositions()
-		assert.Equal(t, result, testCase.expected)
+		assert.NoError(t, repos.AddPosition(context.Background(), &testCase.add))
+		result := data.GetPosition()
+		assert.Equal(t, positionsWithoutTimes(result), positionsWithoutTimes(testCase.expected))
 	}
 }
 
 func TestDeleteEmployee(t *testing.T) {
 	updateData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	firstEmp := internal.Employee{
 		ID: createEmpID(), FirstName: "Nick",
 		LasName:    "Bobs",
 		PositionID: p.ID,
 	}
-	repos.AddEmployee(&firstEmp)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmp))
 	secondEmp := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Bread",
 		LasName:    "Brown",
 		PositionID: p.ID,
 	}
-	repos.AddEmployee(&secondEmp)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &secondEmp))
 	fakeEmp := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Blue",
@@ -203,22 +251,22 @@ func TestDeleteEmployee(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.DeleteEmployee(testCase.delete.ID.String())
+		result := repos.DeleteEmployee(context.Background(), testCase.delete.ID)
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
-			assert.Equal(t, repos.GetEmployees(), testCase.expected)
+			assert.Equal(t, untrashedEmployees(data.GetEmployees()), testCase.expected)
 		}
 	}
 }
 
 func TestDeletePosition(t *testing.T) {
 	updateData()
-	firstPos := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPos)
-	secondPos := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(2000, 0)}
-	repos.AddPosition(&secondPos)
-	fakePos := internal.Position{ID: createPosID(), Name: "principal", Salary: decimal.New(4500, 0)}
+	firstPos := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPos))
+	secondPos := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &secondPos))
+	fakePos := internal.Position{ID: createPosID(), Name: "principal", Salary: internal.NewMoney(decimal.New(4500, 0), "USD")}
 	testTable := []struct {
 		expected map[string]internal.Position
 		delete   internal.Position
@@ -238,27 +286,169 @@ func TestDeletePosition(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.DeletePosition(testCase.delete.ID.String())
+		result := repos.DeletePosition(context.Background(), testCase.delete.ID, internal.PositionDeletion{})
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
-			assert.Equal(t, repos.GetPositions(), testCase.expected)
+			assert.Equal(t, untrashedPositions(data.GetPosition()), testCase.expected)
 		}
 	}
 }
 
+func TestDeletePositionEmployees(t *testing.T) { //nolint:funlen
+	updateData()
+	ctx := context.Background()
+	add := func(name string) internal.Position {
+		p := internal.Position{ID: uuid.New(), Name: name, Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+		assert.NoError(t, repos.AddPosition(ctx, &p))
+		return p
+	}
+	hire := func(p internal.Position, lasName string) internal.Employee {
+		e := internal.Employee{ID: uuid.New(), FirstName: "Nick", LasName: lasName, PositionID: p.ID}
+		assert.NoError(t, repos.AddEmployee(ctx, &e))
+		return e
+	}
+	worker, lead := add("worker"), add("lead")
+	first, second := hire(worker, "Bobs"), hire(worker, "Brown")
+
+	err := repos.DeletePosition(ctx, worker.ID, internal.PositionDeletion{Mode: internal.DeleteRestrict})
+	assert.ErrorIs(t, err, errs.PositionIsUsed())
+	blocking := []uuid.UUID{first.ID, second.ID}
+	sort.Slice(blocking, func(i, j int) bool { return blocking[i].String() < blocking[j].String() })
+	assert.Equal(t, map[string]interface{}{"employees": blocking}, errs.Details(err))
+
+	for _, target := range []uuid.UUID{uuid.New(), worker.ID} {
+		d := internal.PositionDeletion{Mode: internal.DeleteReassign, ReassignTo: target}
+		assert.Equal(t, errs.PositionIsNotExists(), repos.DeletePosition(ctx, worker.ID, d))
+	}
+	assert.Len(t, data.GetEmployees(), 2, "failed deletes change nothing")
+
+	reassign := internal.PositionDeletion{Mode: internal.DeleteReassign, ReassignTo: lead.ID}
+	assert.NoError(t, repos.DeletePosition(ctx, worker.ID, reassign))
+	for _, e := range []internal.Employee{first, second} {
+		moved, err := repos.GetEmployeeByID(ctx, e.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, lead.ID, moved.PositionID)
+		assert.Equal(t, 2, moved.Version)
+		assert.True(t, moved.UpdatedAt.After(e.UpdatedAt) || moved.UpdatedAt.Equal(e.UpdatedAt))
+	}
+	_, err = repos.GetPositionByID(ctx, worker.ID)
+	assert.Equal(t, errs.NotFound(), err)
+
+	assert.NoError(t, repos.DeletePosition(ctx, lead.ID, internal.PositionDeletion{Mode: internal.DeleteCascade}))
+	assert.Empty(t, untrashedEmployees(data.GetEmployees()))
+	assert.Empty(t, untrashedPositions(data.GetPosition()))
+	assert.Equal(t, errs.NotFound(), repos.DeletePosition(ctx, lead.ID, internal.PositionDeletion{Mode: internal.DeleteCascade}))
+}
+
+func TestTrash(t *testing.T) { //nolint:funlen
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+
+	assert.NoError(t, repos.DeleteEmployee(ctx, e.ID))
+	assert.Equal(t, errs.NotFound(), repos.DeleteEmployee(ctx, e.ID), "already in the trash")
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, repos.DeletePosition(ctx, worker.ID, internal.PositionDeletion{}), "trashed employees do not block")
+
+	_, err := repos.GetEmployeeByID(ctx, e.ID)
+	assert.Equal(t, errs.NotFound(), err)
+	assert.Equal(t, errs.NotFound(), repos.UpdatePosition(ctx, &internal.Position{ID: worker.ID, Name: "boss"}))
+	assert.Equal(t, errs.PositionIsNotExists(),
+		repos.AddEmployee(ctx, &internal.Employee{ID: uuid.New(), PositionID: worker.ID}))
+	positions, err := repos.ListPositions(ctx, internal.PositionFilter{}, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{lead}, positions)
+	count, err := repos.CountPositions(ctx, internal.PositionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	positions, err = repos.ListPositionsAfter(ctx, internal.PositionFilter{IncludeDeleted: true}, uuid.Nil, 10)
+	assert.NoError(t, err)
+	assert.Len(t, positions, 2)
+	count, err = repos.CountEmployees(ctx, internal.EmployeeFilter{IncludeDeleted: true, PositionID: worker.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	found, err := repos.FindPositionsByName(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+	results, err := repos.Search(ctx, "nick", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	trash, err := repos.Trash(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, trash.Positions, 1)
+	assert.Equal(t, worker.ID, trash.Positions[0].ID)
+	assert.Equal(t, 2, trash.Positions[0].Version)
+	assert.Len(t, trash.Employees, 1)
+	assert.NotNil(t, trash.Employees[0].DeletedAt)
+
+	_, err = repos.RestoreEmployee(ctx, e.ID)
+	assert.Equal(t, errs.PositionIsNotExists(), err, "the position is still in the trash")
+	_, err = repos.RestorePosition(ctx, lead.ID)
+	assert.Equal(t, errs.NotFound(), err, "not in the trash")
+	restored, err := repos.RestorePosition(ctx, worker.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, 3, restored.Version)
+	employee, err := repos.RestoreEmployee(ctx, e.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, employee.Version)
+	found, err = repos.FindPositionsByName(ctx, "worker")
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{restored}, found)
+	results, err = repos.Search(ctx, "nick", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+}
+
+func TestPurge(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+	assert.NoError(t, repos.DeleteEmployee(ctx, e.ID))
+	assert.NoError(t, repos.DeletePosition(ctx, lead.ID, internal.PositionDeletion{}))
+	time.Sleep(time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, repos.DeletePosition(ctx, worker.ID, internal.PositionDeletion{}))
+
+	n, err := repos.Purge(ctx, cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Empty(t, data.GetEmployees())
+	assert.Len(t, data.GetPosition(), 1)
+	_, err = repos.RestorePosition(ctx, lead.ID)
+	assert.Equal(t, errs.NotFound(), err)
+
+	n, err = repos.Purge(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, data.GetPosition())
+}
+
 func TestUpdateEmployee(t *testing.T) {
 	updateData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	firstEmp := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
-	repos.AddEmployee(&firstEmp)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmp))
 	id, err := uuid.Parse(employeeIDs[0])
 	if err != nil {
 		t.Error(err)
 	}
 	updateEmp := internal.Employee{ID: id, FirstName: "Bread", LasName: "Brown", PositionID: p.ID}
-	repos.AddEmployee(&updateEmp)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &updateEmp))
 	fakeEmp := internal.Employee{ID: createEmpID(), FirstName: "Blue", LasName: "Bluer", PositionID: p.ID}
 	noPosEmp := internal.Employee{ID: id, FirstName: "James", LasName: "White", PositionID: uuid.New()}
 	testTable := []struct {
@@ -293,31 +483,31 @@ func TestUpdateEmployee(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.UpdateEmployee(&testCase.update)
+		result := repos.UpdateEmployee(context.Background(), &testCase.update)
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
-			assert.Equal(t, repos.GetEmployees()[id.String()].FirstName, testCase.expectedFirstName)
-			assert.Equal(t, repos.GetEmployees()[id.String()].LasName, testCase.expectedLasName)
-			assert.Equal(t, repos.GetEmployees()[id.String()].PositionID, testCase.expectedPosition.ID)
+			assert.Equal(t, data.GetEmployees()[id.String()].FirstName, testCase.expectedFirstName)
+			assert.Equal(t, data.GetEmployees()[id.String()].LasName, testCase.expectedLasName)
+			assert.Equal(t, data.GetEmployees()[id.String()].PositionID, testCase.expectedPosition.ID)
 		}
 	}
 }
 
 func TestUpdatePosition(t *testing.T) {
 	updateData()
-	firstPos := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPos)
+	firstPos := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPos))
 	id, err := uuid.Parse(positionIDs[0])
 	if err != nil {
 		t.Error(err)
 	}
-	updatePos := internal.Position{ID: id, Name: "principal", Salary: decimal.New(4500, 0)}
-	fakePos := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(2000, 0)}
+	updatePos := internal.Position{ID: id, Name: "principal", Salary: internal.NewMoney(decimal.New(4500, 0), "USD")}
+	fakePos := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
 	testTable := []struct {
 		expectedName   string
 		id             uuid.UUID
-		expectedSalary decimal.Decimal
+		expectedSalary internal.Money
 		update         internal.Position
 		err            error
 	}{
@@ -325,23 +515,846 @@ func TestUpdatePosition(t *testing.T) {
 			update:         updatePos,
 			id:             id,
 			expectedName:   "principal",
-			expectedSalary: decimal.New(4500, 0),
+			expectedSalary: internal.NewMoney(decimal.New(4500, 0), "USD"),
 			err:            nil,
 		},
 		{
 			update:         fakePos,
 			expectedName:   "",
-			expectedSalary: decimal.Zero,
+			expectedSalary: internal.NewMoney(decimal.Zero, "USD"),
 			err:            errs.NotFound(),
 		},
 	}
 	for _, testCase := range testTable {
-		result := repos.UpdatePosition(&testCase.update)
+		result := repos.UpdatePosition(context.Background(), &testCase.update)
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
-			assert.Equal(t, repos.GetPositions()[id.String()].Name, testCase.expectedName)
-			assert.Equal(t, repos.GetPositions()[id.String()].Salary, testCase.expectedSalary)
+			assert.Equal(t, data.GetPosition()[id.String()].Name, testCase.expectedName)
+			assert.Equal(t, data.GetPosition()[id.String()].Salary, testCase.expectedSalary)
+		}
+	}
+}
+
+func TestUpdateVersion(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	assert.Equal(t, 1, p.Version)
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+	assert.Equal(t, 1, e.Version)
+
+	update := internal.Position{ID: p.ID, Name: "lead", Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Version: 1}
+	assert.NoError(t, repos.UpdatePosition(ctx, &update))
+	assert.Equal(t, 2, update.Version)
+	stale := internal.Position{ID: p.ID, Name: "principal", Salary: internal.NewMoney(decimal.New(500, 0), "USD"), Version: 1}
+	assert.Equal(t, errs.PreconditionFailed(), repos.UpdatePosition(ctx, &stale))
+	assert.Equal(t, 1, stale.Version)
+	anyVersion := internal.Position{ID: p.ID, Name: "principal", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.UpdatePosition(ctx, &anyVersion))
+	assert.Equal(t, 3, anyVersion.Version)
+	assert.Equal(t, anyVersion, data.GetPosition()[p.ID.String()])
+	assert.Equal(t, p.CreatedAt, anyVersion.CreatedAt)
+	assert.True(t, anyVersion.UpdatedAt.After(p.UpdatedAt))
+
+	e.FirstName, e.Version = "Bread", 2
+	assert.Equal(t, errs.PreconditionFailed(), repos.UpdateEmployee(ctx, &e))
+	e.Version = 1
+	assert.NoError(t, repos.UpdateEmployee(ctx, &e))
+	assert.Equal(t, e, data.GetEmployees()[e.ID.String()])
+	assert.Equal(t, 2, e.Version)
+}
+
+func TestChanged(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	opened, err := repos.PositionsChanged(ctx)
+	assert.NoError(t, err)
+	assert.False(t, opened.IsZero())
+	// Writes are stamped to the microsecond; keep them apart.
+	time.Sleep(time.Millisecond)
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	added, err := repos.PositionsChanged(ctx)
+	assert.NoError(t, err)
+	assert.True(t, added.After(opened))
+	employees, err := repos.EmployeesChanged(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, opened, employees, "adding a position leaves the employees alone")
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, repos.DeletePosition(ctx, p.ID, internal.PositionDeletion{}))
+	deleted, err := repos.PositionsChanged(ctx)
+	assert.NoError(t, err)
+	assert.True(t, deleted.After(added))
+}
+
+func TestUpdateRollback(t *testing.T) {
+	updateData()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	err := data.Update(func(tx *Tx) error {
+		tx.PutEmployee(e)
+		tx.PutPosition(internal.Position{ID: p.ID, Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")})
+		tx.DeletePosition(p.ID.String())
+		return errs.BadRequest()
+	})
+	assert.Equal(t, errs.BadRequest(), err)
+	assert.Equal(t, map[string]internal.Position{positionIDs[0]: p}, data.GetPosition())
+	assert.Equal(t, map[string]internal.Employee{}, data.GetEmployees())
+}
+
+func TestViewReadOnly(t *testing.T) {
+	updateData()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.Panics(t, func() {
+		_ = data.View(func(tx *Tx) error {
+			tx.PutPosition(p)
+			return nil
+		})
+	})
+	assert.Equal(t, map[string]internal.Position{}, data.GetPosition())
+}
+
+func TestRepositoryConcurrentAccess(t *testing.T) { //nolint:funlen
+	updateData()
+	const workers = 16
+	const iterations = 200
+	base := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &base))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				p := internal.Position{ID: uuid.New(), Name: name, Salary: internal.NewMoney(decimal.New(int64(i), 0), "USD")}
+				assert.NoError(t, repos.AddPosition(context.Background(), &p))
+				e := internal.Employee{ID: uuid.New(), FirstName: "Nick", LasName: name, PositionID: p.ID}
+				assert.NoError(t, repos.AddEmployee(context.Background(), &e))
+				p.Salary = internal.NewMoney(decimal.New(int64(i+1), 0), "USD")
+				assert.NoError(t, repos.UpdatePosition(context.Background(), &p))
+				e.PositionID = base.ID
+				assert.NoError(t, repos.UpdateEmployee(context.Background(), &e))
+				assert.NotEmpty(t, data.GetPosition())
+				assert.NotNil(t, data.GetEmployees())
+				assert.NoError(t, repos.DeletePosition(context.Background(), p.ID, internal.PositionDeletion{}))
+				assert.NoError(t, repos.DeleteEmployee(context.Background(), e.ID))
+			}
+		}("lead " + strconv.Itoa(w))
+	}
+	wg.Wait()
+	_, err := repos.Purge(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]internal.Position{positionIDs[0]: base}, data.GetPosition())
+	assert.Equal(t, map[string]internal.Employee{}, data.GetEmployees())
+}
+
+func TestUpdateEmployeeConcurrentDeletePosition(t *testing.T) {
+	updateData()
+	const rounds = 500
+	for i := 0; i < rounds; i++ {
+		salary := internal.NewMoney(decimal.New(int64(i), 0), "USD")
+		initial := internal.Position{ID: uuid.New(), Name: "worker", Salary: salary}
+		assert.NoError(t, repos.AddPosition(context.Background(), &initial))
+		p := internal.Position{ID: uuid.New(), Name: "lead", Salary: salary}
+		assert.NoError(t, repos.AddPosition(context.Background(), &p))
+		e := internal.Employee{ID: uuid.New(), FirstName: "Nick", LasName: strconv.Itoa(i), PositionID: initial.ID}
+		assert.NoError(t, repos.AddEmployee(context.Background(), &e))
+		e.PositionID = p.ID
+		var wg sync.WaitGroup
+		wg.Add(2)
+		var updateErr error
+		go func() {
+			defer wg.Done()
+			updateErr = repos.UpdateEmployee(context.Background(), &e)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = repos.DeletePosition(context.Background(), p.ID, internal.PositionDeletion{})
+		}()
+		wg.Wait()
+		stored := data.GetEmployees()[e.ID.String()]
+		if updateErr == nil {
+			assert.Equal(t, p.ID, stored.PositionID)
+		} else {
+			assert.Equal(t, errs.PositionIsNotExists(), updateErr)
+			assert.Equal(t, initial.ID, stored.PositionID)
+		}
+	}
+}
+
+func TestOpenDataBaseReplay(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	r := NewRepo(db)
+	p := internal.Position{ID: uuid.New(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, r.AddPosition(context.Background(), &p))
+	e := internal.Employee{ID: uuid.New(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	assert.NoError(t, r.AddEmployee(context.Background(), &e))
+	removed := internal.Position{ID: uuid.New(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, r.AddPosition(context.Background(), &removed))
+	assert.NoError(t, r.DeletePosition(context.Background(), removed.ID, internal.PositionDeletion{}))
+	p.Name = "principal"
+	assert.NoError(t, r.UpdatePosition(context.Background(), &p))
+	assert.Equal(t, errs.PositionIsNotExists(), r.UpdateEmployee(context.Background(), &internal.Employee{ID: e.ID, PositionID: uuid.New()}))
+
+	reopened, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	positions := reopened.GetPosition()
+	assert.Len(t, positions, 2)
+	assert.NotNil(t, positions[removed.ID.String()].DeletedAt, "the deleted position stays in the trash")
+	assert.Equal(t, "principal", positions[p.ID.String()].Name)
+	assert.True(t, p.Salary.Equal(positions[p.ID.String()].Salary))
+	assert.Equal(t, map[string]internal.Employee{e.ID.String(): e}, reopened.GetEmployees())
+}
+
+func TestOpenDataBaseCompact(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	r := NewRepo(db)
+	p := internal.Position{ID: uuid.New(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, r.AddPosition(context.Background(), &p))
+	assert.NoError(t, db.Compact())
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+	e := internal.Employee{ID: uuid.New(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	assert.NoError(t, r.AddEmployee(context.Background(), &e))
+	assert.NoError(t, db.Close())
+
+	reopened, err := OpenDataBase(dir, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Len(t, reopened.GetPosition(), 1)
+	assert.Equal(t, map[string]internal.Employee{e.ID.String(): e}, reopened.GetEmployees())
+	assert.NoError(t, NewRepo(reopened).AddPosition(context.Background(), &internal.Position{ID: uuid.New(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}))
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestOpenDataBaseTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	p := internal.Position{ID: uuid.New(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, NewRepo(db).AddPosition(context.Background(), &p))
+	walPath := filepath.Join(dir, walFileName)
+	f, err := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"ops":[{"op":"put_pos`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	reopened, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	assert.Len(t, reopened.GetPosition(), 1)
+	body, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(body), "\n"))
+
+	assert.NoError(t, os.WriteFile(walPath, []byte("garbage\n"+string(body)), 0o644))
+	_, err = OpenDataBase(dir, 0)
+	assert.Error(t, err)
+}
+
+func TestOpenDataBaseLegacySalary(t *testing.T) {
+	dir := t.TempDir()
+	id := uuid.New()
+	record := `{"ops":[{"op":"put_position","position":{"id":"` + id.String() + `","name":"worker","salary":"500.5"}}]}` + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, walFileName), []byte(record), 0o644))
+
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	salary := db.GetPosition()[id.String()].Salary
+	assert.True(t, internal.NewMoney(decimal.RequireFromString("500.5"), internal.DefaultCurrency).Equal(salary), salary.String())
+}
+
+func TestLookups(t *testing.T) { //nolint:funlen
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+
+	p, err := repos.GetPositionByID(ctx, lead.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, lead, p)
+	_, err = repos.GetPositionByID(ctx, uuid.New())
+	assert.Equal(t, errs.NotFound(), err)
+	found, err := repos.GetEmployeeByID(ctx, e.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, e, found)
+	_, err = repos.GetEmployeeByID(ctx, uuid.New())
+	assert.Equal(t, errs.NotFound(), err)
+
+	positions, err := repos.FindPositionsByName(ctx, "lead")
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{lead}, positions)
+	employees, err := repos.FindEmployeesByName(ctx, "Nick", "Bobs")
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Employee{e}, employees)
+	employees, err = repos.FindEmployeesByPosition(ctx, lead.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, employees)
+
+	count, err := repos.CountPositions(ctx, internal.PositionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = repos.CountEmployees(ctx, internal.EmployeeFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	all, err := repos.ListPositions(ctx, internal.PositionFilter{}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.True(t, all[0].ID.String() < all[1].ID.String())
+	page, err := repos.ListPositions(ctx, internal.PositionFilter{}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, all[1:], page)
+	page, err = repos.ListPositions(ctx, internal.PositionFilter{}, 1, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+
+	orphan := internal.Employee{ID: createEmpID(), FirstName: "Blue", LasName: "Bluer", PositionID: uuid.New()}
+	assert.Equal(t, errs.PositionIsNotExists(), repos.AddEmployee(ctx, &orphan))
+}
+
+func TestCanceledContext(t *testing.T) {
+	updateData()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.Equal(t, context.Canceled, repos.AddPosition(ctx, &p))
+	_, err := repos.CountPositions(ctx, internal.PositionFilter{})
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, data.GetPosition())
+}
+
+func TestIndexFollowsWrites(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+
+	renamed := internal.Employee{ID: e.ID, FirstName: "Bread", LasName: "Brown", PositionID: lead.ID}
+	assert.NoError(t, repos.UpdateEmployee(ctx, &renamed))
+	employees, _ := repos.FindEmployeesByName(ctx, "Nick", "Bobs")
+	assert.Empty(t, employees)
+	employees, _ = repos.FindEmployeesByName(ctx, "Bread", "Brown")
+	assert.Equal(t, []internal.Employee{renamed}, employees)
+	employees, _ = repos.FindEmployeesByPosition(ctx, worker.ID)
+	assert.Empty(t, employees)
+	employees, _ = repos.FindEmployeesByPosition(ctx, lead.ID)
+	assert.Equal(t, []internal.Employee{renamed}, employees)
+
+	err := data.Update(func(tx *Tx) error {
+		tx.DeleteEmployee(e.ID.String())
+		tx.PutPosition(internal.Position{ID: worker.ID, Name: "principal", Salary: internal.NewMoney(decimal.New(4500, 0), "USD")})
+		return errs.BadRequest()
+	})
+	assert.Equal(t, errs.BadRequest(), err)
+	employees, _ = repos.FindEmployeesByName(ctx, "Bread", "Brown")
+	assert.Equal(t, []internal.Employee{renamed}, employees)
+	positions, _ := repos.FindPositionsByName(ctx, "principal")
+	assert.Empty(t, positions)
+	positions, _ = repos.FindPositionsByName(ctx, "worker")
+	assert.Equal(t, []internal.Position{worker}, positions)
+
+	assert.NoError(t, repos.DeletePosition(ctx, worker.ID, internal.PositionDeletion{}))
+	positions, _ = repos.FindPositionsByName(ctx, "worker")
+	assert.Empty(t, positions)
+	assert.Empty(t, data.index.positionsByName["worker"])
+	assert.Len(t, data.index.positionsByName, 1)
+}
+
+// benchmarkSizes shows that the indexed lookups do not grow with the number
+// of records.
+var benchmarkSizes = []int{1000, 1000000} //nolint:gochecknoglobals
+
+var fixtures = map[int]*Repository{} //nolint:gochecknoglobals
+
+// fixture returns a repository with n positions and n employees spread over
+// the first thousand positions. It is built once per size and shared.
+func fixture(b *testing.B, n int) *Repository {
+	if r, ok := fixtures[n]; ok {
+		return r
+	}
+	const batch = 10000
+	db := NewDataBase()
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	for lo := 0; lo < n; lo += batch {
+		err := db.Update(func(tx *Tx) error {
+			for i := lo; i < lo+batch && i < n; i++ {
+				tx.PutPosition(internal.Position{ID: ids[i], Name: "position-" + strconv.Itoa(i), Salary: internal.NewMoney(decimal.New(int64(i), 0), "USD")})
+			}
+			for i := lo; i < lo+batch && i < n; i++ {
+				tx.PutEmployee(internal.Employee{
+					ID:         uuid.New(),
+					FirstName:  "first-" + strconv.Itoa(i),
+					LasName:    "last-" + strconv.Itoa(i),
+					PositionID: ids[i%1000],
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	fixtures[n] = NewRepo(db)
+	return fixtures[n]
+}
+
+func BenchmarkGetPositionByID(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := fixture(b, n)
+			ids := make([]uuid.UUID, 0, 1000)
+			for id := range r.data.positions {
+				if len(ids) == cap(ids) {
+					break
+				}
+				ids = append(ids, uuid.MustParse(id))
+			}
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.GetPositionByID(ctx, ids[i%len(ids)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindPositionsByName(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := fixture(b, n)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				positions, err := r.FindPositionsByName(ctx, "position-"+strconv.Itoa(i%n))
+				if err != nil || len(positions) != 1 {
+					b.Fatal(err, len(positions))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindEmployeesByName(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := fixture(b, n)
+			ctx := context.Background()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				k := strconv.Itoa(i % n)
+				employees, err := r.FindEmployeesByName(ctx, "first-"+k, "last-"+k)
+				if err != nil || len(employees) != 1 {
+					b.Fatal(err, len(employees))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAddEmployee(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := fixture(b, n)
+			positionID := r.data.employees[firstKey(r.data.employees)].PositionID
+			ctx := context.Background()
+			ids := make([]uuid.UUID, b.N)
+			for i := range ids {
+				ids[i] = uuid.New()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				e := internal.Employee{ID: ids[i], FirstName: "bench", LasName: "bench", PositionID: positionID}
+				if err := r.AddEmployee(ctx, &e); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			for _, id := range ids {
+				_ = r.DeleteEmployee(ctx, id)
+			}
+		})
+	}
+}
+
+func firstKey(m map[string]internal.Employee) string {
+	for k := range m {
+		return k
+	}
+	return ""
+}
+
+func TestListAfter(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	for i := 0; i < 4; i++ {
+		e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: strconv.Itoa(i), PositionID: p.ID}
+		assert.NoError(t, repos.AddEmployee(ctx, &e))
+	}
+	sort.Strings(employeeIDs)
+	page, err := repos.ListEmployeesAfter(ctx, internal.EmployeeFilter{}, uuid.Nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{employeeIDs[0], employeeIDs[1]}, []string{page[0].ID.String(), page[1].ID.String()})
+	assert.NoError(t, repos.DeleteEmployee(ctx, uuid.MustParse(employeeIDs[2])))
+	page, err = repos.ListEmployeesAfter(ctx, internal.EmployeeFilter{}, page[1].ID, 2)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, employeeIDs[3], page[0].ID.String())
+	positions, err := repos.ListPositionsAfter(ctx, internal.PositionFilter{}, p.ID, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, positions)
+}
+
+func TestListFiltered(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "Junior worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	senior := internal.Position{ID: createPosID(), Name: "Senior Worker", Salary: internal.NewMoney(decimal.New(1000, 0), "USD")}
+	// 900 EUR is 1080 USD, more than senior earns though the amount is less.
+	middle := internal.Position{ID: createPosID(), Name: "Middle worker", Salary: internal.NewMoney(decimal.New(900, 0), "EUR")}
+	for _, p := range []*internal.Position{&worker, &lead, &senior, &middle} {
+		assert.NoError(t, repos.AddPosition(ctx, p))
+	}
+	toUSD := func(from string) (decimal.Decimal, error) {
+		if from != "EUR" {
+			return decimal.Decimal{}, fmt.Errorf("no rate from %s", from)
+		}
+		return decimal.RequireFromString("1.2"), nil
+	}
+	f := internal.PositionFilter{
+		NameContains:   "WORKER",
+		Sort:           []internal.SortField{{Field: internal.SortSalary, Desc: true}},
+		SalaryCurrency: "USD",
+		SalaryRate:     toUSD,
+	}
+	positions, err := repos.ListPositions(ctx, f, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{middle, senior, worker}, positions)
+	count, err := repos.CountPositions(ctx, f)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	f = internal.PositionFilter{
+		SalaryMin:      decimal.NullDecimal{Decimal: decimal.New(1050, 0), Valid: true},
+		Sort:           []internal.SortField{{Field: internal.SortSalary}},
+		SalaryCurrency: "USD",
+		SalaryRate:     toUSD,
+	}
+	positions, err = repos.ListPositions(ctx, f, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{middle, lead}, positions)
+	positions, err = repos.ListPositionsAfter(ctx, f, uuid.Nil, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []internal.Position{middle, lead}, positions)
+	f.SalaryMin = decimal.NullDecimal{}
+	f.SalaryMax = decimal.NullDecimal{Decimal: decimal.New(1080, 0), Valid: true}
+	f.SalaryCurrency = "EUR"
+	_, err = repos.ListPositions(ctx, f, 10, 0)
+	assert.EqualError(t, err, "no rate from USD")
+
+	bob := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "Smith", PositionID: worker.ID}
+	bobby := internal.Employee{ID: createEmpID(), FirstName: "bobby", LasName: "Brown", PositionID: worker.ID}
+	nick := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: lead.ID}
+	for _, e := range []*internal.Employee{&bob, &bobby, &nick} {
+		assert.NoError(t, repos.AddEmployee(ctx, e))
+	}
+	ef := internal.EmployeeFilter{
+		PositionID:      worker.ID,
+		FirstNamePrefix: "BOB",
+		Sort:            []internal.SortField{{Field: internal.SortLasName}},
+	}
+	employees, err := repos.ListEmployees(ctx, ef, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Employee{bobby, bob}, employees)
+	employees, err = repos.ListEmployeesAfter(ctx, internal.EmployeeFilter{LasNamePrefix: "b"}, uuid.Nil, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []internal.Employee{bobby, nick}, employees)
+}
+
+func TestSearch(t *testing.T) {
+	updateData()
+	ctx := context.Background()
+	worker := internal.Position{ID: createPosID(), Name: "Bob's helper", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	zoe := internal.Employee{ID: createEmpID(), FirstName: "Zoë", LasName: "Bobrova", PositionID: worker.ID}
+	bob := internal.Employee{ID: createEmpID(), FirstName: "Bob", LasName: "O'Brien", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &zoe))
+	assert.NoError(t, repos.AddEmployee(ctx, &bob))
+
+	results, err := repos.Search(ctx, "BOB", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.SearchResult{
+		{Type: internal.SearchTypeEmployee, Score: internal.ExactMatchScore, Employee: &bob},
+		{Type: internal.SearchTypePosition, Score: internal.ExactMatchScore, Position: &worker},
+		{Type: internal.SearchTypeEmployee, Score: internal.PrefixMatchScore, Employee: &zoe},
+	}, results)
+	results, err = repos.Search(ctx, "bob", 1)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	results, err = repos.Search(ctx, "zoe bob", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.SearchResult{
+		{Type: internal.SearchTypeEmployee, Score: internal.ExactMatchScore + internal.PrefixMatchScore, Employee: &zoe},
+	}, results)
+
+	renamed := internal.Employee{ID: zoe.ID, FirstName: "Anna", LasName: "Smith", PositionID: worker.ID}
+	assert.NoError(t, repos.UpdateEmployee(ctx, &renamed))
+	results, err = repos.Search(ctx, "zoe", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = repos.Search(ctx, "ann", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, repos.DeleteEmployee(ctx, bob.ID))
+	results, err = repos.Search(ctx, "brien", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = repos.Search(ctx, " !? ", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestSearchAfterReplay(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	r := NewRepo(db)
+	p := internal.Position{ID: uuid.New(), Name: "Café manager", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, r.AddPosition(context.Background(), &p))
+	assert.NoError(t, db.Close())
+
+	reopened, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	results, err := NewRepo(reopened).Search(context.Background(), "cafe", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, p.ID, results[0].Position.ID)
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	l, err := OpenAuditLog(dir)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	positionID, employeeID := uuid.New(), uuid.New()
+	entries := []internal.AuditEntry{
+		{Entity: internal.EntityPosition, EntityID: positionID, Action: internal.AuditCreate, Actor: "admin"},
+		{Entity: internal.EntityEmployee, EntityID: employeeID, Action: internal.AuditCreate, Actor: "hr"},
+		{Entity: internal.EntityPosition, EntityID: positionID, Action: internal.AuditUpdate, Actor: "admin"},
+	}
+	for i := range entries {
+		assert.NoError(t, l.AddAudit(ctx, &entries[i]))
+		assert.Equal(t, int64(i+1), entries[i].ID)
+		assert.False(t, entries[i].Time.IsZero())
+	}
+	ids := func(entries []internal.AuditEntry) []int64 {
+		ids := make([]int64, 0, len(entries))
+		for _, e := range entries {
+			ids = append(ids, e.ID)
 		}
+		return ids
+	}
+	testTable := []struct {
+		filter   internal.AuditFilter
+		before   int64
+		limit    int
+		expected []int64
+	}{
+		{limit: 10, expected: []int64{3, 2, 1}},
+		{limit: 2, expected: []int64{3, 2}},
+		{before: 3, limit: 10, expected: []int64{2, 1}},
+		{filter: internal.AuditFilter{Entity: internal.EntityPosition}, limit: 10, expected: []int64{3, 1}},
+		{filter: internal.AuditFilter{EntityID: employeeID}, limit: 10, expected: []int64{2}},
+		{filter: internal.AuditFilter{Actor: "admin"}, before: 3, limit: 10, expected: []int64{1}},
+		{filter: internal.AuditFilter{From: entries[2].Time.Add(time.Second)}, limit: 10, expected: []int64{}},
+		{filter: internal.AuditFilter{To: entries[0].Time}, limit: 10, expected: []int64{}},
 	}
+	for _, testCase := range testTable {
+		found, err := l.ListAudit(ctx, testCase.filter, testCase.before, testCase.limit)
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expected, ids(found), "%+v", testCase)
+	}
+	assert.NoError(t, l.Close())
+
+	f, err := os.OpenFile(filepath.Join(dir, auditFileName), os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"id":4,"ent`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	reopened, err := OpenAuditLog(dir)
+	assert.NoError(t, err)
+	found, err := reopened.ListAudit(ctx, internal.AuditFilter{}, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2, 1}, ids(found))
+	next := internal.AuditEntry{Entity: internal.EntityEmployee, EntityID: employeeID, Action: internal.AuditDelete}
+	assert.NoError(t, reopened.AddAudit(ctx, &next))
+	assert.Equal(t, int64(4), next.ID)
+	assert.NoError(t, reopened.Close())
+}
+
+func TestAuditChanges(t *testing.T) {
+	updateData()
+	var changes []internal.Change
+	ctx := internal.WithAuditor(context.Background(), func(_ context.Context, c ...internal.Change) error {
+		changes = append(changes, c...)
+		return nil
+	})
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: worker.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+	changes = nil
+	assert.NoError(t, repos.DeletePosition(ctx, worker.ID,
+		internal.PositionDeletion{Mode: internal.DeleteReassign, ReassignTo: lead.ID}))
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, internal.AuditDelete, changes[0].Action)
+		assert.Equal(t, worker, changes[0].Before)
+		assert.Nil(t, changes[0].After)
+		moved := changes[1].After.(internal.Employee)
+		assert.Equal(t, internal.AuditUpdate, changes[1].Action)
+		assert.Equal(t, e, changes[1].Before)
+		assert.Equal(t, lead.ID, moved.PositionID)
+		assert.Equal(t, e.Version+1, moved.Version)
+	}
+
+	failing := internal.WithAuditor(context.Background(), func(context.Context, ...internal.Change) error {
+		return errs.StatusInternalServerError()
+	})
+	raise := internal.Position{ID: lead.ID, Name: "lead", Salary: internal.NewMoney(decimal.New(1200, 0), "USD")}
+	assert.Equal(t, errs.StatusInternalServerError(), repos.UpdatePosition(failing, &raise))
+	stored, err := repos.GetPositionByID(ctx, lead.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, lead, stored, "a failed audit rolls the update back")
+	n, err := repos.Purge(failing, time.Now().Add(time.Hour))
+	assert.Equal(t, errs.StatusInternalServerError(), err)
+	assert.Zero(t, n)
+	_, err = repos.RestorePosition(ctx, worker.ID)
+	assert.NoError(t, err, "a failed audit rolls the purge back")
+	changes = nil
+	n, err = repos.Purge(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, changes)
+}
+
+func TestSalaryHistory(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	r := NewRepo(db)
+	ctx := context.Background()
+	p := internal.Position{ID: uuid.New(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, r.AddPosition(ctx, &p))
+	p.Salary = internal.NewMoney(decimal.New(600, 0), "USD")
+	assert.NoError(t, r.UpdatePosition(ctx, &p))
+
+	future := internal.SalaryRecord{
+		PositionID:    p.ID,
+		Amount:        decimal.New(700, 0),
+		Currency:      internal.DefaultCurrency,
+		EffectiveFrom: time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, r.ScheduleSalary(ctx, &future))
+	assert.NotEqual(t, uuid.Nil, future.ID)
+	assert.Nil(t, future.EffectiveTo)
+	records, err := r.SalaryHistory(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	amounts := make([]string, 0, len(records))
+	for _, record := range records {
+		amounts = append(amounts, record.Amount.String())
+	}
+	assert.Equal(t, []string{"500", "600", "700"}, amounts)
+	assert.Equal(t, records[1].EffectiveFrom, *records[0].EffectiveTo)
+	assert.Equal(t, future.EffectiveFrom, *records[1].EffectiveTo)
+	stored, err := r.GetPositionByID(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "600 USD", stored.Salary.String())
+
+	soon := internal.SalaryRecord{
+		PositionID:    p.ID,
+		Amount:        decimal.New(650, 0),
+		Currency:      "EUR",
+		EffectiveFrom: now().Add(50 * time.Millisecond),
+	}
+	assert.NoError(t, r.ScheduleSalary(ctx, &soon))
+	stored, err = r.GetPositionByID(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "600 USD", stored.Salary.String())
+	assert.Equal(t, p.Version, stored.Version)
+	changed, err := r.PositionsChanged(ctx)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Until(soon.EffectiveFrom) + 10*time.Millisecond)
+	stored, err = r.GetPositionByID(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "650 EUR", stored.Salary.String(), "the record in effect is read at once")
+	assert.Equal(t, p.Version+1, stored.Version)
+	assert.Equal(t, soon.EffectiveFrom, stored.UpdatedAt)
+	listed, err := r.ListPositions(ctx, internal.PositionFilter{}, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.Position{stored}, listed)
+	assert.True(t, soon.EffectiveFrom.After(changed))
+	changed, err = r.PositionsChanged(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, soon.EffectiveFrom, changed, "a record taking effect changes the positions")
+
+	stored.Name = "senior worker"
+	assert.NoError(t, r.UpdatePosition(ctx, &stored), "writes start from the record in effect")
+	assert.Equal(t, p.Version+2, stored.Version)
+	assert.Equal(t, "650 EUR", db.GetPosition()[p.ID.String()].Salary.String())
+
+	replacement := internal.SalaryRecord{
+		PositionID:    p.ID,
+		Amount:        decimal.New(650, 0),
+		Currency:      internal.DefaultCurrency,
+		EffectiveFrom: future.EffectiveFrom,
+	}
+	assert.NoError(t, r.ScheduleSalary(ctx, &replacement))
+	assert.NoError(t, db.Close())
+
+	reopened, err := OpenDataBase(dir, 0)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	r = NewRepo(reopened)
+	records, err = r.SalaryHistory(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+	assert.Equal(t, replacement.ID, records[3].ID)
+	assert.Equal(t, "650", records[3].Amount.String())
+
+	missing := internal.SalaryRecord{PositionID: uuid.New(), Amount: decimal.New(1, 0), EffectiveFrom: time.Now()}
+	assert.Equal(t, errs.NotFound(), r.ScheduleSalary(ctx, &missing))
+	assert.NoError(t, r.DeletePosition(ctx, p.ID, internal.PositionDeletion{}))
+	_, err = r.SalaryHistory(ctx, p.ID)
+	assert.Equal(t, errs.NotFound(), err)
 }
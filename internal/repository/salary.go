@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+)
+
+// SalaryHistory returns the salary records of the position, oldest first. A
+// position in the trash is NotFound.
+func (t Repository) SalaryHistory(ctx context.Context, positionID uuid.UUID) ([]internal.SalaryRecord, error) {
+	var records []internal.SalaryRecord
+	err := t.view(ctx, func(tx *Tx) error {
+		p, ok := livePosition(tx, positionID.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		records = salaries(tx, p)
+		return nil
+	})
+	return records, err
+}
+
+// ScheduleSalary adds r to the salary records of its position, replacing a
+// record that takes effect at the same time, and sets its ID and
+// EffectiveTo. A record that is already in effect is applied at once.
+func (t Repository) ScheduleSalary(ctx context.Context, r *internal.SalaryRecord) error {
+	return t.update(ctx, func(tx *Tx) error {
+		p, ok := livePosition(tx, r.PositionID.String())
+		if !ok {
+			return errors.NotFound()
+		}
+		r.ID = uuid.New()
+		records := putSalary(tx, p, *r)
+		for _, record := range records {
+			if record.ID == r.ID {
+				*r = record
+			}
+		}
+		applySalary(tx, p, records, now())
+		return internal.Audit(ctx, internal.Change{
+			Entity: internal.EntityPosition, Action: internal.AuditScheduleSalary, ID: p.ID, After: *r,
+		})
+	})
+}
+
+// salaries returns the salary records of p. A position stored before salary
+// records were kept has a single record from its creation, which shares its
+// ID.
+func salaries(tx *Tx, p internal.Position) []internal.SalaryRecord {
+	records := tx.Salaries(p.ID.String())
+	if len(records) > 0 {
+		return records
+	}
+	return []internal.SalaryRecord{{
+		ID:            p.ID,
+		PositionID:    p.ID,
+		Amount:        p.Salary.Amount,
+		Currency:      p.Salary.Currency,
+		EffectiveFrom: p.CreatedAt,
+	}}
+}
+
+// recordSalary adds salary, taking effect at at, to the records of p, the
+// position as stored before.
+func recordSalary(tx *Tx, p internal.Position, salary internal.Money, at time.Time) {
+	putSalary(tx, p, internal.SalaryRecord{
+		ID:            uuid.New(),
+		PositionID:    p.ID,
+		Amount:        salary.Amount,
+		Currency:      salary.Currency,
+		EffectiveFrom: at,
+	})
+}
+
+// putSalary adds r to the records of p, replacing the one that takes effect
+// at the same time, and returns the new timeline.
+func putSalary(tx *Tx, p internal.Position, r internal.SalaryRecord) []internal.SalaryRecord {
+	records := salaries(tx, p)
+	replaced := false
+	for i := range records {
+		if records[i].EffectiveFrom.Equal(r.EffectiveFrom) {
+			records[i], replaced = r, true
+		}
+	}
+	if !replaced {
+		records = append(records, r)
+	}
+	records = internal.SalaryTimeline(records)
+	tx.PutSalaries(p.ID.String(), records)
+	return records
+}
+
+// applySalary sets the salary of p to the record of records in effect at at
+// and reports whether that changed it.
+func applySalary(tx *Tx, p internal.Position, records []internal.SalaryRecord, at time.Time) bool {
+	r, ok := internal.SalaryAt(records, at)
+	if !ok || r.Money().Equal(p.Salary) {
+		return false
+	}
+	p.Salary = r.Money()
+	p.Version++
+	p.UpdatedAt = now()
+	tx.PutPosition(p)
+	return true
+}
+
+// effective returns p, as stored, with the salary in effect now. A salary
+// record that took effect since p was last written counts as a write of it:
+// each one adds to the version, and the last one is when p was updated.
+// Writes start from the effective position, so they store what it derives.
+func effective(tx *Tx, p internal.Position) internal.Position {
+	since, at := p.UpdatedAt, now()
+	for _, r := range tx.db.salaries[p.ID.String()] {
+		if !r.EffectiveFrom.After(since) || r.EffectiveFrom.After(at) {
+			continue
+		}
+		p.Version++
+		if r.EffectiveFrom.After(p.UpdatedAt) {
+			p.Salary = r.Money()
+			p.UpdatedAt = r.EffectiveFrom
+		}
+	}
+	return p
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/NVTer/rest-api-example/internal"
+)
+
+// textIndex is the inverted index behind full-text search. It maps every
+// token of internal.EmployeeTokens and internal.PositionTokens to the
+// records that contain it.
+type textIndex struct {
+	employees map[string]idSet
+	positions map[string]idSet
+	terms     terms
+}
+
+// terms caches the distinct tokens of both maps in ascending order so that
+// prefix matches are a binary search away. Like order it is dropped when a
+// token appears or disappears and rebuilt by the next reader.
+type terms struct {
+	mu     sync.Mutex
+	sorted []string
+}
+
+func newTextIndex() textIndex {
+	return textIndex{employees: map[string]idSet{}, positions: map[string]idSet{}}
+}
+
+func (t *textIndex) add(m map[string]idSet, tokens []string, id string) {
+	for _, token := range tokens {
+		if _, ok := t.employees[token]; !ok {
+			if _, ok := t.positions[token]; !ok {
+				t.terms.sorted = nil
+			}
+		}
+		add(m, token, id)
+	}
+}
+
+func (t *textIndex) remove(m map[string]idSet, tokens []string, id string) {
+	for _, token := range tokens {
+		remove(m, token, id)
+		if len(t.employees[token]) == 0 && len(t.positions[token]) == 0 {
+			t.terms.sorted = nil
+		}
+	}
+}
+
+// vocabulary returns all indexed tokens in ascending order. The slice is
+// shared and must not be modified.
+func (t *textIndex) vocabulary() []string {
+	t.terms.mu.Lock()
+	defer t.terms.mu.Unlock()
+	if t.terms.sorted == nil {
+		seen := make(map[string]struct{}, len(t.employees)+len(t.positions))
+		for token := range t.employees {
+			seen[token] = struct{}{}
+		}
+		for token := range t.positions {
+			seen[token] = struct{}{}
+		}
+		sorted := make([]string, 0, len(seen))
+		for token := range seen {
+			sorted = append(sorted, token)
+		}
+		sort.Strings(sorted)
+		t.terms.sorted = sorted
+	}
+	return t.terms.sorted
+}
+
+// matches returns the indexed tokens that start with token, together with
+// the score each of them earns.
+func (t *textIndex) matches(token string) map[string]float64 {
+	vocabulary := t.vocabulary()
+	found := map[string]float64{}
+	for i := sort.SearchStrings(vocabulary, token); i < len(vocabulary); i++ {
+		if !strings.HasPrefix(vocabulary[i], token) {
+			break
+		}
+		found[vocabulary[i]] = internal.PrefixMatchScore
+	}
+	if _, ok := found[token]; ok {
+		found[token] = internal.ExactMatchScore
+	}
+	return found
+}
+
+// score returns the records of m that match every query token. A record
+// scores the best weight it reaches for each token, summed over the tokens.
+func score(m map[string]idSet, query []string, matches []map[string]float64) map[string]float64 {
+	var scores map[string]float64
+	for i := range query {
+		best := map[string]float64{}
+		for token, weight := range matches[i] {
+			for id := range m[token] {
+				if weight > best[id] {
+					best[id] = weight
+				}
+			}
+		}
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for id, total := range scores {
+			if weight, ok := best[id]; ok {
+				scores[id] = total + weight
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+	return scores
+}
+
+// Search returns at most limit records matching every token of query, best
+// first. A token matches a record token it equals or begins.
+func (tx *Tx) Search(query []string, limit int) []internal.SearchResult {
+	if len(query) == 0 {
+		return make([]internal.SearchResult, 0)
+	}
+	text := &tx.db.index.text
+	matches := make([]map[string]float64, len(query))
+	for i, token := range query {
+		matches[i] = text.matches(token)
+	}
+	results := make([]internal.SearchResult, 0)
+	for id, s := range score(text.employees, query, matches) {
+		e := tx.db.employees[id]
+		results = append(results, internal.SearchResult{Type: internal.SearchTypeEmployee, Score: s, Employee: &e})
+	}
+	for id, s := range score(text.positions, query, matches) {
+		p := effective(tx, tx.db.positions[id])
+		results = append(results, internal.SearchResult{Type: internal.SearchTypePosition, Score: s, Position: &p})
+	}
+	internal.SortSearchResults(results)
+	if limit >= 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
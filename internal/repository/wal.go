@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	opPutPosition    = "put_position"
+	opPutEmployee    = "put_employee"
+	opDeletePosition = "delete_position"
+	opDeleteEmployee = "delete_employee"
+	opPutSalaries    = "put_salaries"
+)
+
+// walOp is a single change made inside a transaction. Every committed Update
+// is written to the log as one line holding all of its ops, so a transaction
+// is replayed either completely or not at all.
+type walOp struct {
+	Op       string             `json:"op"`
+	ID       string             `json:"id,omitempty"`
+	Position *internal.Position `json:"position,omitempty"`
+	Employee *internal.Employee `json:"employee,omitempty"`
+	// Salaries are the records of the position ID for put_salaries.
+	Salaries []internal.SalaryRecord `json:"salaries,omitempty"`
+}
+
+type walRecord struct {
+	Ops []walOp `json:"ops"`
+}
+
+type snapshot struct {
+	Positions map[string]internal.Position       `json:"positions"`
+	Employees map[string]internal.Employee       `json:"employees"`
+	Salaries  map[string][]internal.SalaryRecord `json:"salaries,omitempty"`
+}
+
+type journal struct {
+	dir  string
+	file *os.File
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenDataBase returns a Database persisted in dir. The state is restored from
+// the last snapshot plus the write-ahead log, and every committed Update is
+// appended to the log before it becomes visible. If compactInterval is positive
+// the log is folded into a new snapshot that often. Close must be called to
+// stop compaction and release the log file.
+func OpenDataBase(dir string, compactInterval time.Duration) (*Database, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	d := NewDataBase()
+	if err := d.loadSnapshot(filepath.Join(dir, snapshotFileName)); err != nil {
+		return nil, err
+	}
+	walPath := filepath.Join(dir, walFileName)
+	if err := d.replay(walPath); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	d.journal = &journal{dir: dir, file: file}
+	if compactInterval > 0 {
+		d.journal.stop = make(chan struct{})
+		d.journal.done = make(chan struct{})
+		go d.compactLoop(compactInterval)
+	}
+	return d, nil
+}
+
+// Close compacts the log one last time and closes it. It is a no-op for an
+// in-memory Database.
+func (d *Database) Close() error {
+	if d.journal == nil {
+		return nil
+	}
+	if d.journal.stop != nil {
+		close(d.journal.stop)
+		<-d.journal.done
+	}
+	err := d.Compact()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cerr := d.journal.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Compact writes the current state to a new snapshot and truncates the log.
+// A crash between the two steps is harmless because replaying puts and
+// deletes on top of a snapshot that already contains them is idempotent.
+func (d *Database) Compact() error {
+	if d.journal == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	body, err := json.Marshal(snapshot{Positions: d.positions, Employees: d.employees, Salaries: d.salaries})
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(filepath.Join(d.journal.dir, snapshotFileName), body); err != nil {
+		return err
+	}
+	if err := d.journal.file.Truncate(0); err != nil {
+		return err
+	}
+	return d.journal.file.Sync()
+}
+
+func (d *Database) compactLoop(interval time.Duration) {
+	defer close(d.journal.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Compact(); err != nil {
+				logrus.WithError(err).Error("compact write-ahead log")
+			}
+		case <-d.journal.stop:
+			return
+		}
+	}
+}
+
+// append writes ops to the log as one record. A record that cannot be
+// written and synced whole is cut off again: replay only forgives a torn
+// record at the very end, and the next record would land behind it.
+func (j *journal) append(ops []walOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(walRecord{Ops: ops})
+	if err != nil {
+		return err
+	}
+	offset, err := j.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return j.truncate(offset, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return j.truncate(offset, err)
+	}
+	return nil
+}
+
+// truncate cuts the log off at offset after the write that failed with err,
+// which it returns.
+func (j *journal) truncate(offset int64, err error) error {
+	if terr := j.file.Truncate(offset); terr != nil {
+		logrus.WithError(terr).WithField("offset", offset).Error("truncate failed write-ahead log record")
+	}
+	return err
+}
+
+func (d *Database) loadSnapshot(path string) error {
+	body, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var s snapshot
+	if err := json.Unmarshal(body, &s); err != nil {
+		return fmt.Errorf("read snapshot %s: %w", path, err)
+	}
+	for _, p := range s.Positions {
+		d.setPosition(p)
+	}
+	for _, e := range s.Employees {
+		d.setEmployee(e)
+	}
+	for id, records := range s.Salaries {
+		d.salaries[id] = records
+	}
+	return nil
+}
+
+// replay applies every complete record of the log. A torn record at the very
+// end, left by a crash in the middle of a write, is cut off; a broken record
+// anywhere else means the log is corrupted and is reported as an error.
+func (d *Database) replay(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(bytes.TrimSpace(line)) == 0 {
+				return nil
+			}
+			logrus.WithField("offset", offset).Warn("truncate torn write-ahead log record")
+			return file.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("read write-ahead log %s at offset %d: %w", path, offset, err)
+		}
+		if err := d.Update(func(tx *Tx) error {
+			return tx.apply(record.Ops)
+		}); err != nil {
+			return err
+		}
+		offset += int64(len(line))
+	}
+}
+
+func (tx *Tx) apply(ops []walOp) error {
+	for _, op := range ops {
+		switch {
+		case op.Op == opPutPosition && op.Position != nil:
+			tx.PutPosition(*op.Position)
+		case op.Op == opPutEmployee && op.Employee != nil:
+			tx.PutEmployee(*op.Employee)
+		case op.Op == opDeletePosition:
+			tx.DeletePosition(op.ID)
+		case op.Op == opDeleteEmployee:
+			tx.DeleteEmployee(op.ID)
+		case op.Op == opPutSalaries:
+			tx.PutSalaries(op.ID, op.Salaries)
+		default:
+			return fmt.Errorf("unknown write-ahead log op %q", op.Op)
+		}
+	}
+	return nil
+}
+
+func writeFileSync(path string, body []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(body); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultCurrency is the currency of positions stored before they had one.
+const DefaultCurrency = "USD"
+
+// SalaryRecord is the salary of a position from EffectiveFrom until the next
+// record of the position takes effect. The records of a position never
+// overlap, and the one in effect sets Position.Salary.
+type SalaryRecord struct {
+	ID            uuid.UUID       `json:"id" doc:"set by the server and ignored in requests"`
+	PositionID    uuid.UUID       `json:"position_id" doc:"set by the server from the path and ignored in requests"`
+	Amount        decimal.Decimal `json:"amount" validate:"required,gt=0" doc:"may have as many decimal places as the currency has minor units"`
+	Currency      string          `json:"currency" validate:"currency" doc:"defaults to the currency of the salary in effect at effective_from"`
+	EffectiveFrom time.Time       `json:"effective_from" validate:"required"`
+	// EffectiveTo is when the next record takes effect. It is not stored
+	// but derived from the records around it.
+	EffectiveTo *time.Time `json:"effective_to,omitempty" doc:"set by the server from the next record and ignored in requests"`
+}
+
+// Money returns the salary of r.
+func (r SalaryRecord) Money() Money {
+	return Money{Amount: r.Amount, Currency: r.Currency}
+}
+
+// InEffect reports whether r is the salary at t.
+func (r SalaryRecord) InEffect(t time.Time) bool {
+	return !t.Before(r.EffectiveFrom) && (r.EffectiveTo == nil || t.Before(*r.EffectiveTo))
+}
+
+// SalaryTimeline orders records by EffectiveFrom and sets every EffectiveTo
+// from the record that follows. records is changed in place and returned.
+func SalaryTimeline(records []SalaryRecord) []SalaryRecord {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].EffectiveFrom.Before(records[j].EffectiveFrom)
+	})
+	for i := range records {
+		records[i].EffectiveTo = nil
+		if i+1 < len(records) {
+			to := records[i+1].EffectiveFrom
+			records[i].EffectiveTo = &to
+		}
+	}
+	return records
+}
+
+// SalaryAt returns the record of records, a timeline, in effect at t.
+func SalaryAt(records []SalaryRecord, t time.Time) (SalaryRecord, bool) {
+	for _, r := range records {
+		if r.InEffect(t) {
+			return r, true
+		}
+	}
+	return SalaryRecord{}, false
+}
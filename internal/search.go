@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Kinds of records a search can return.
+const (
+	SearchTypeEmployee = "employee"
+	SearchTypePosition = "position"
+)
+
+// Weights of a query token that matches a whole record token and one that
+// only matches its beginning.
+const (
+	ExactMatchScore  = 1.0
+	PrefixMatchScore = 0.5
+)
+
+// SearchResult is one hit of a full-text search. Type tells which of
+// Employee and Position is set.
+type SearchResult struct {
+	Type     string    `json:"type"`
+	Score    float64   `json:"score"`
+	Employee *Employee `json:"employee,omitempty"`
+	Position *Position `json:"position,omitempty"`
+}
+
+// ID returns the ID of the record the result points to.
+func (r SearchResult) ID() string {
+	if r.Employee != nil {
+		return r.Employee.ID.String()
+	}
+	if r.Position != nil {
+		return r.Position.ID.String()
+	}
+	return ""
+}
+
+// SortSearchResults orders results by descending score, then by type and ID
+// so that equal scores come back in the same order on every call.
+func SortSearchResults(results []SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.ID() < b.ID()
+	})
+}
+
+// Tokenize splits s into the words a search indexes and looks up: runs of
+// letters and digits, lower-cased and with diacritics removed, so that
+// "Zoë O'Brien" gives zoe, o and brien.
+func Tokenize(s string) []string {
+	var tokens []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks left over from the decomposition of accented
+			// letters.
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// EmployeeTokens returns the tokens an employee is found by.
+func EmployeeTokens(e Employee) []string {
+	return append(Tokenize(e.FirstName), Tokenize(e.LasName)...)
+}
+
+// PositionTokens returns the tokens a position is found by.
+func PositionTokens(p Position) []string {
+	return Tokenize(p.Name)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/NVTer/rest-api-example/internal/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// GetAudit returns up to limit audit entries matching f that are older than
+// cursor, newest first, and the cursor of the next page, which is empty on
+// the last page.
+func (t Serv) GetAudit(
+	ctx context.Context, f internal.AuditFilter, cursor string, limit int,
+) ([]internal.AuditEntry, string, error) {
+	if limit > 100 || limit < 1 {
+		return nil, "", errors.BadRequest()
+	}
+	if err := logCorrelationID(ctx); err != nil {
+		return nil, "", errors.LogError()
+	}
+	switch f.Entity {
+	case "", internal.EntityPosition, internal.EntityEmployee:
+	default:
+		return nil, "", errors.BadRequest()
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return nil, "", errors.BadRequest()
+	}
+	before, err := decodeAuditCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, err := t.audit.ListAudit(ctx, f, before, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) <= limit {
+		return entries, "", nil
+	}
+	entries = entries[:limit]
+	return entries, encodeAuditCursor(entries[limit-1].ID), nil
+}
+
+// audited returns ctx with an Auditor that adds an entry for each change
+// the repository reports, made by the user of ctx.
+func (t Serv) audited(ctx context.Context) context.Context {
+	return internal.WithAuditor(ctx, t.record)
+}
+
+// record adds an audit entry for each of changes. It runs inside the
+// transaction of the mutation, which fails with it, so the trail does not
+// miss a change that was made.
+func (t Serv) record(ctx context.Context, changes ...internal.Change) error {
+	actor, _ := ctx.Value(middleware.UserLogin).(string)
+	correlationID, _ := ctx.Value(middleware.CorrelationID).(string)
+	for _, c := range changes {
+		log := logrus.WithFields(logrus.Fields{
+			"correlation_id": correlationID,
+			"entity":         c.Entity,
+			"entity_id":      c.ID,
+			"action":         c.Action,
+		})
+		diff, err := internal.Diff(c.Before, c.After)
+		if err != nil {
+			log.WithError(err).Error("diff audited record")
+			return err
+		}
+		e := internal.AuditEntry{
+			Entity:        c.Entity,
+			EntityID:      c.ID,
+			Action:        c.Action,
+			Actor:         actor,
+			CorrelationID: correlationID,
+			Changes:       diff,
+		}
+		if err := t.audit.AddAudit(ctx, &e); err != nil {
+			log.WithError(err).Error("add audit entry")
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+)
+
+// A cursor is the ID of the last record of a page. Pages are ordered by ID, so
+// the next page is everything after it no matter what was inserted or deleted
+// in between. Clients must treat it as opaque.
+
+func encodeCursor(id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+// decodeCursor returns uuid.Nil for an empty cursor, which means the first
+// page.
+func decodeCursor(cursor string) (uuid.UUID, error) {
+	if cursor == "" {
+		return uuid.Nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return uuid.Nil, errors.BadRequest()
+	}
+	id, err := uuid.FromBytes(b)
+	if err != nil {
+		return uuid.Nil, errors.BadRequest()
+	}
+	return id, nil
+}
+
+// encodeAuditCursor works like encodeCursor for the ID of an audit entry.
+func encodeAuditCursor(id int64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(id))
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// decodeAuditCursor returns 0 for an empty cursor, which means the newest
+// entries.
+func decodeAuditCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8 {
+		return 0, errors.BadRequest()
+	}
+	id := int64(binary.BigEndian.Uint64(b))
+	if id < 1 {
+		return 0, errors.BadRequest()
+	}
+	return id, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+)
+
+var (
+	positionSortFields = map[string]bool{ // nolint: gochecknoglobals
+		internal.SortID:     true,
+		internal.SortName:   true,
+		internal.SortSalary: true,
+	}
+	employeeSortFields = map[string]bool{ // nolint: gochecknoglobals
+		internal.SortID:         true,
+		internal.SortFirstName:  true,
+		internal.SortLasName:    true,
+		internal.SortPositionID: true,
+	}
+)
+
+// validatePositionFilter rejects bounds that match nothing and comparisons
+// of salaries that do not say which currency to compare them in.
+func validatePositionFilter(f internal.PositionFilter) error {
+	if f.SalaryMin.Valid && f.SalaryMax.Valid && f.SalaryMin.Decimal.GreaterThan(f.SalaryMax.Decimal) {
+		return errors.BadRequest()
+	}
+	if f.ComparesSalaries() && (f.SalaryCurrency == "" || f.SalaryRate == nil) {
+		return errors.BadRequest()
+	}
+	return validateSort(f.Sort, positionSortFields)
+}
+
+func validateEmployeeFilter(f internal.EmployeeFilter) error {
+	return validateSort(f.Sort, employeeSortFields)
+}
+
+func validateSort(sort []internal.SortField, allowed map[string]bool) error {
+	seen := map[string]bool{}
+	for _, s := range sort {
+		if !allowed[s.Field] || seen[s.Field] {
+			return errors.BadRequest()
+		}
+		seen[s.Field] = true
+	}
+	return nil
+}
+
+// validateCursorSort rejects any order but ascending ID, the only one a
+// cursor can follow.
+func validateCursorSort(sort []internal.SortField) error {
+	for _, s := range sort {
+		if s.Field != internal.SortID || s.Desc {
+			return errors.BadRequest()
+		}
+	}
+	return nil
+}
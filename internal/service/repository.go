@@ -1,14 +1,42 @@
 package service
 
-import "github.com/NVTer/rest-api-example/internal"
+import (
+	"context"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/google/uuid"
+)
 
 type Repository interface {
-	GetPositions() map[string]internal.Position
-	GetEmployees() map[string]internal.Employee
-	AddPosition(p *internal.Position)
-	AddEmployee(e *internal.Employee)
-	DeletePosition(id string) error
-	DeleteEmployee(id string) error
-	UpdatePosition(p *internal.Position) error
-	UpdateEmployee(e *internal.Employee) error
+	GetPositionByID(ctx context.Context, id uuid.UUID) (internal.Position, error)
+	GetEmployeeByID(ctx context.Context, id uuid.UUID) (internal.Employee, error)
+	ListPositions(ctx context.Context, f internal.PositionFilter, limit, offset int) ([]internal.Position, error)
+	ListEmployees(ctx context.Context, f internal.EmployeeFilter, limit, offset int) ([]internal.Employee, error)
+	ListPositionsAfter(ctx context.Context, f internal.PositionFilter, after uuid.UUID, limit int) ([]internal.Position, error)
+	ListEmployeesAfter(ctx context.Context, f internal.EmployeeFilter, after uuid.UUID, limit int) ([]internal.Employee, error)
+	Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error)
+	CountPositions(ctx context.Context, f internal.PositionFilter) (int, error)
+	CountEmployees(ctx context.Context, f internal.EmployeeFilter) (int, error)
+	PositionsChanged(ctx context.Context) (time.Time, error)
+	EmployeesChanged(ctx context.Context) (time.Time, error)
+	AddPosition(ctx context.Context, p *internal.Position) error
+	AddEmployee(ctx context.Context, e *internal.Employee) error
+	DeletePosition(ctx context.Context, id uuid.UUID, d internal.PositionDeletion) error
+	DeleteEmployee(ctx context.Context, id uuid.UUID) error
+	UpdatePosition(ctx context.Context, p *internal.Position) error
+	UpdateEmployee(ctx context.Context, e *internal.Employee) error
+	RestorePosition(ctx context.Context, id uuid.UUID) (internal.Position, error)
+	RestoreEmployee(ctx context.Context, id uuid.UUID) (internal.Employee, error)
+	Trash(ctx context.Context) (internal.Trash, error)
+	Purge(ctx context.Context, before time.Time) (int, error)
+	SalaryHistory(ctx context.Context, positionID uuid.UUID) ([]internal.SalaryRecord, error)
+	ScheduleSalary(ctx context.Context, r *internal.SalaryRecord) error
+}
+
+// AuditRepository keeps the audit trail apart from the records. Entries are
+// only ever added.
+type AuditRepository interface {
+	AddAudit(ctx context.Context, e *internal.AuditEntry) error
+	ListAudit(ctx context.Context, f internal.AuditFilter, before int64, limit int) ([]internal.AuditEntry, error)
 }
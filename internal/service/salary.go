@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+)
+
+// GetSalaryHistory returns the salary records of the position, oldest first.
+func (t Serv) GetSalaryHistory(ctx context.Context, id string) ([]internal.SalaryRecord, error) {
+	if err := logCorrelationID(ctx); err != nil {
+		return nil, errors.LogError()
+	}
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.NotFound()
+	}
+	return t.repo.SalaryHistory(ctx, uID)
+}
+
+// ScheduleSalary adds r to the salary records of the position from its
+// EffectiveFrom on, which has to be in the future, replacing a record that
+// takes effect at the same time. The currency defaults to that of the record
+// r follows.
+func (t Serv) ScheduleSalary(ctx context.Context, id string, r *internal.SalaryRecord) error {
+	if err := logCorrelationID(ctx); err != nil {
+		return errors.LogError()
+	}
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return errors.NotFound()
+	}
+	r.PositionID = uID
+	if !r.EffectiveFrom.After(time.Now()) {
+		return &errors.ValidationError{Fields: []errors.FieldError{
+			{Field: "effective_from", Code: "future", Message: "must be in the future"},
+		}}
+	}
+	records, err := t.repo.SalaryHistory(ctx, uID)
+	if err != nil {
+		return err
+	}
+	if r.Currency == "" {
+		previous, _ := internal.SalaryAt(records, r.EffectiveFrom)
+		r.Currency = previous.Currency
+	}
+	if !r.Money().Exact() {
+		return &errors.ValidationError{Fields: []errors.FieldError{
+			{Field: "amount", Code: "scale", Message: "must have no more decimal places than the currency has minor units"},
+		}}
+	}
+	return t.repo.ScheduleSalary(t.audited(ctx), r)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/NVTer/rest-api-example/internal"
 	"github.com/NVTer/rest-api-example/internal/errors"
@@ -10,12 +11,14 @@ import (
 )
 
 type Serv struct {
-	repo Repository
+	repo  Repository
+	audit AuditRepository
 }
 
-func NewServ(repository Repository) *Serv {
+func NewServ(repository Repository, audit AuditRepository) *Serv {
 	return &Serv{
-		repo: repository,
+		repo:  repository,
+		audit: audit,
 	}
 }
 
@@ -35,14 +38,10 @@ func (t Serv) CreatePosition(ctx context.Context, p *internal.Position) (string,
 	if err != nil {
 		return "", errors.LogError()
 	}
-	m := t.repo.GetPositions()
-	for _, value := range m {
-		if value.Salary.String() == p.Salary.String() && value.Name == p.Name {
-			return "", errors.PositionIsExists()
-		}
-	}
 	p.ID = uuid.New()
-	t.repo.AddPosition(p)
+	if err := t.repo.AddPosition(t.audited(ctx), p); err != nil {
+		return "", err
+	}
 	return p.ID.String(), nil
 }
 
@@ -51,81 +50,168 @@ func (t Serv) CreateEmployee(ctx context.Context, e *internal.Employee) (string,
 	if err != nil {
 		return "", errors.LogError()
 	}
-	m := t.repo.GetEmployees()
-	p := t.repo.GetPositions()
-	ok := false
-	for _, value := range p {
-		if value.ID == e.PositionID {
-			ok = true
-			break
-		}
-	}
-	if !ok {
-		return "", errors.PositionIsNotExists()
-	}
-	for _, value := range m {
-		if value.LasName == e.LasName &&
-			value.FirstName == e.FirstName {
-			return "", errors.EmployeeIsExists()
-		}
-	}
 	e.ID = uuid.New()
-	t.repo.AddEmployee(e)
+	if err := t.repo.AddEmployee(t.audited(ctx), e); err != nil {
+		return "", err
+	}
 	return e.ID.String(), nil
 }
 
-func (t Serv) GetPositions(ctx context.Context, limit, offset int) ([]internal.Position, error) {
+// GetPositions returns the offset-th page (counting from one) of limit positions
+// matching f together with the total number of matching positions.
+func (t Serv) GetPositions(ctx context.Context, f internal.PositionFilter, limit, offset int) ([]internal.Position, int, error) {
 	if limit > 100 {
-		return nil, errors.BadRequest()
+		return nil, 0, errors.BadRequest()
 	}
 	err := logCorrelationID(ctx)
 	if err != nil {
-		return nil, errors.LogError()
+		return nil, 0, errors.LogError()
 	}
-	m := t.repo.GetPositions()
-	answer := make([]internal.Position, 0)
-	if len(m) == 0 && offset == 1 && limit == 1 {
-		return answer, nil
+	if err := validatePositionFilter(f); err != nil {
+		return nil, 0, err
 	}
-	positions := make([]internal.Position, 0)
-	for _, value := range m {
-		positions = append(positions, value)
+	count, err := t.repo.CountPositions(ctx, f)
+	if err != nil {
+		return nil, 0, err
+	}
+	if count == 0 && offset == 1 && limit > 0 {
+		return make([]internal.Position, 0), 0, nil
 	}
 	offset--
-	if float64(len(positions))/float64(limit) <= float64(offset) || limit < 1 || offset < 0 {
-		return nil, errors.NotFound()
+	if float64(count)/float64(limit) <= float64(offset) || limit < 1 || offset < 0 {
+		return nil, 0, errors.NotFound()
 	}
-	for i := limit * offset; i < limit*offset+limit && i < len(positions); i++ {
-		answer = append(answer, positions[i])
+	positions, err := t.repo.ListPositions(ctx, f, limit, limit*offset)
+	if err != nil {
+		return nil, 0, err
 	}
-	return answer, nil
+	return positions, count, nil
 }
 
-func (t Serv) GetEmployees(ctx context.Context, limit, offset int) ([]internal.Employee, error) {
+// GetEmployees returns the offset-th page (counting from one) of limit employees
+// matching f together with the total number of matching employees.
+func (t Serv) GetEmployees(ctx context.Context, f internal.EmployeeFilter, limit, offset int) ([]internal.Employee, int, error) {
 	if limit > 100 {
-		return nil, errors.BadRequest()
+		return nil, 0, errors.BadRequest()
 	}
 	err := logCorrelationID(ctx)
 	if err != nil {
-		return nil, errors.LogError()
+		return nil, 0, errors.LogError()
 	}
-	m := t.repo.GetEmployees()
-	answer := make([]internal.Employee, 0)
-	if len(m) == 0 && offset == 1 && limit == 1 {
-		return answer, nil
+	if err := validateEmployeeFilter(f); err != nil {
+		return nil, 0, err
+	}
+	count, err := t.repo.CountEmployees(ctx, f)
+	if err != nil {
+		return nil, 0, err
 	}
-	employees := make([]internal.Employee, 0)
-	for _, value := range m {
-		employees = append(employees, value)
+	if count == 0 && offset == 1 && limit > 0 {
+		return make([]internal.Employee, 0), 0, nil
 	}
 	offset--
-	if float64(len(employees))/float64(limit) <= float64(offset) || limit < 1 || offset < 0 {
-		return nil, errors.NotFound()
+	if float64(count)/float64(limit) <= float64(offset) || limit < 1 || offset < 0 {
+		return nil, 0, errors.NotFound()
 	}
-	for i := limit * offset; i < limit*offset+limit && i < len(employees); i++ {
-		answer = append(answer, employees[i])
+	employees, err := t.repo.ListEmployees(ctx, f, limit, limit*offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return employees, count, nil
+}
+
+// GetPositionsPage returns up to limit positions matching f that follow cursor
+// and the cursor of the next page, which is empty on the last page. Cursor
+// pages are always ordered by ID.
+func (t Serv) GetPositionsPage(
+	ctx context.Context, f internal.PositionFilter, cursor string, limit int,
+) ([]internal.Position, string, error) {
+	if limit > 100 || limit < 1 {
+		return nil, "", errors.BadRequest()
+	}
+	err := logCorrelationID(ctx)
+	if err != nil {
+		return nil, "", errors.LogError()
+	}
+	if err := validatePositionFilter(f); err != nil {
+		return nil, "", err
+	}
+	if err := validateCursorSort(f.Sort); err != nil {
+		return nil, "", err
 	}
-	return answer, nil
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	positions, err := t.repo.ListPositionsAfter(ctx, f, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(positions) <= limit {
+		return positions, "", nil
+	}
+	positions = positions[:limit]
+	return positions, encodeCursor(positions[limit-1].ID), nil
+}
+
+// GetEmployeesPage returns up to limit employees matching f that follow cursor
+// and the cursor of the next page, which is empty on the last page. Cursor
+// pages are always ordered by ID.
+func (t Serv) GetEmployeesPage(
+	ctx context.Context, f internal.EmployeeFilter, cursor string, limit int,
+) ([]internal.Employee, string, error) {
+	if limit > 100 || limit < 1 {
+		return nil, "", errors.BadRequest()
+	}
+	err := logCorrelationID(ctx)
+	if err != nil {
+		return nil, "", errors.LogError()
+	}
+	if err := validateEmployeeFilter(f); err != nil {
+		return nil, "", err
+	}
+	if err := validateCursorSort(f.Sort); err != nil {
+		return nil, "", err
+	}
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	employees, err := t.repo.ListEmployeesAfter(ctx, f, after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(employees) <= limit {
+		return employees, "", nil
+	}
+	employees = employees[:limit]
+	return employees, encodeCursor(employees[limit-1].ID), nil
+}
+
+// Search returns at most limit employees and positions matching every word
+// of query, best first.
+func (t Serv) Search(ctx context.Context, query string, limit int) ([]internal.SearchResult, error) {
+	if limit > 100 || limit < 1 {
+		return nil, errors.BadRequest()
+	}
+	err := logCorrelationID(ctx)
+	if err != nil {
+		return nil, errors.LogError()
+	}
+	if len(internal.Tokenize(query)) == 0 {
+		return nil, errors.BadRequest()
+	}
+	return t.repo.Search(ctx, query, limit)
+}
+
+// PositionsChanged returns when a position was last added, changed or
+// removed; a list of positions is unchanged since any later time.
+func (t Serv) PositionsChanged(ctx context.Context) (time.Time, error) {
+	return t.repo.PositionsChanged(ctx)
+}
+
+// EmployeesChanged works like PositionsChanged.
+func (t Serv) EmployeesChanged(ctx context.Context) (time.Time, error) {
+	return t.repo.EmployeesChanged(ctx)
 }
 
 func (t Serv) GetPosition(ctx context.Context, id string) (internal.Position, error) {
@@ -133,17 +219,11 @@ func (t Serv) GetPosition(ctx context.Context, id string) (internal.Position, er
 	if err != nil {
 		return internal.Position{}, errors.LogError()
 	}
-	m := t.repo.GetPositions()
 	uID, err := uuid.Parse(id)
 	if err != nil {
 		return internal.Position{}, errors.BadRequest()
 	}
-	for _, value := range m {
-		if value.ID == uID {
-			return value, nil
-		}
-	}
-	return internal.Position{}, errors.NotFound()
+	return t.repo.GetPositionByID(ctx, uID)
 }
 
 func (t Serv) GetEmployee(ctx context.Context, id string) (internal.Employee, error) {
@@ -151,25 +231,36 @@ func (t Serv) GetEmployee(ctx context.Context, id string) (internal.Employee, er
 	if err != nil {
 		return internal.Employee{}, errors.LogError()
 	}
-	m := t.repo.GetEmployees()
 	uID, err := uuid.Parse(id)
 	if err != nil {
 		return internal.Employee{}, errors.ParseError()
 	}
-	for _, value := range m {
-		if value.ID == uID {
-			return value, nil
-		}
-	}
-	return internal.Employee{}, errors.NotFound()
+	return t.repo.GetEmployeeByID(ctx, uID)
 }
 
-func (t Serv) DeletePosition(ctx context.Context, id string) error {
+// DeletePosition deletes the position, dealing with its employees as d says.
+// An unknown mode, or reassigning without a target, is BadRequest. The
+// employees a cascade deletes or a reassignment moves get audit entries of
+// their own.
+func (t Serv) DeletePosition(ctx context.Context, id string, d internal.PositionDeletion) error {
 	err := logCorrelationID(ctx)
 	if err != nil {
 		return errors.LogError()
 	}
-	return t.repo.DeletePosition(id)
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return errors.NotFound()
+	}
+	switch d.Mode {
+	case "", internal.DeleteRestrict, internal.DeleteCascade:
+	case internal.DeleteReassign:
+		if d.ReassignTo == uuid.Nil {
+			return errors.BadRequest()
+		}
+	default:
+		return errors.BadRequest()
+	}
+	return t.repo.DeletePosition(t.audited(ctx), uID, d)
 }
 
 func (t Serv) DeleteEmployee(ctx context.Context, id string) error {
@@ -177,7 +268,11 @@ func (t Serv) DeleteEmployee(ctx context.Context, id string) error {
 	if err != nil {
 		return errors.LogError()
 	}
-	return t.repo.DeleteEmployee(id)
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return errors.NotFound()
+	}
+	return t.repo.DeleteEmployee(t.audited(ctx), uID)
 }
 
 func (t Serv) UpdatePosition(ctx context.Context, p *internal.Position) error {
@@ -188,7 +283,7 @@ func (t Serv) UpdatePosition(ctx context.Context, p *internal.Position) error {
 	if p.ID.String() == uuid.Nil.String() {
 		return errors.BadRequest()
 	}
-	return t.repo.UpdatePosition(p)
+	return t.repo.UpdatePosition(t.audited(ctx), p)
 }
 
 func (t Serv) UpdateEmployee(ctx context.Context, e *internal.Employee) error {
@@ -199,5 +294,5 @@ func (t Serv) UpdateEmployee(ctx context.Context, e *internal.Employee) error {
 	if e.ID == uuid.Nil {
 		return errors.BadRequest()
 	}
-	return t.repo.UpdateEmployee(e)
+	return t.repo.UpdateEmployee(t.audited(ctx), e)
 }
@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"github.com/stretchr/testify/assert"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/NVTer/rest-api-example/internal"
 	errs "github.com/NVTer/rest-api-example/internal/errors"
@@ -15,6 +18,7 @@ import (
 var (
 	data        *repository.Database   //nolint: gochecknoglobals
 	repos       *repository.Repository //nolint: gochecknoglobals
+	audit       *repository.AuditLog   //nolint: gochecknoglobals
 	serv        *Serv                  //nolint: gochecknoglobals
 	positionIDs []string               //nolint: gochecknoglobals
 	employeeIDs []string               //nolint: gochecknoglobals
@@ -23,7 +27,8 @@ var (
 func initData() {
 	data = repository.NewDataBase()
 	repos = repository.NewRepo(data)
-	serv = NewServ(repos)
+	audit = repository.NewAuditLog()
+	serv = NewServ(repos, audit)
 	positionIDs = make([]string, 0)
 	employeeIDs = make([]string, 0)
 }
@@ -40,6 +45,26 @@ func createEmpID() uuid.UUID {
 	return id
 }
 
+// untrashedPositions leaves out the positions in the trash.
+func untrashedPositions(m map[string]internal.Position) map[string]internal.Position {
+	for id, p := range m {
+		if p.DeletedAt != nil {
+			delete(m, id)
+		}
+	}
+	return m
+}
+
+// untrashedEmployees leaves out the employees in the trash.
+func untrashedEmployees(m map[string]internal.Employee) map[string]internal.Employee {
+	for id, e := range m {
+		if e.DeletedAt != nil {
+			delete(m, id)
+		}
+	}
+	return m
+}
+
 func createRightContext() context.Context {
 	//revive:disable
 	return context.WithValue(context.Background(), "correlation_id", uuid.New().String()) //nolint:staticcheck
@@ -52,15 +77,31 @@ func createBadContext() context.Context {
 	//revive:enable
 }
 
+// positionsByID and employeesByID order the expected slices the way the repository
+// lists them.
+func positionsByID(positions []internal.Position) []internal.Position {
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].ID.String() < positions[j].ID.String()
+	})
+	return positions
+}
+
+func employeesByID(employees []internal.Employee) []internal.Employee {
+	sort.Slice(employees, func(i, j int) bool {
+		return employees[i].ID.String() < employees[j].ID.String()
+	})
+	return employees
+}
+
 func TestCreatePosition(t *testing.T) {
 	initData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
-	newPos := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(2000, 0)}
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
+	newPos := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
 	testTable := []struct {
 		addID          string
 		expectedName   string
-		expectedSalary decimal.Decimal
+		expectedSalary internal.Money
 		add            internal.Position
 		ctx            context.Context
 		err            error
@@ -85,7 +126,7 @@ func TestCreatePosition(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		id, result := serv.CreatePosition(testCase.ctx, &testCase.add)
-		position := repos.GetPositions()[id]
+		position := data.GetPosition()[id]
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
@@ -97,15 +138,15 @@ func TestCreatePosition(t *testing.T) {
 
 func TestCreateEmployee(t *testing.T) { //nolint:funlen
 	initData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
 	firstEmp := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Vik",
 		LasName:    "Sick",
 		PositionID: p.ID,
 	}
-	repos.AddEmployee(&firstEmp)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmp))
 	newEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Bread",
@@ -161,7 +202,7 @@ func TestCreateEmployee(t *testing.T) { //nolint:funlen
 	}
 	for _, testCase := range testTable {
 		id, result := serv.CreateEmployee(testCase.ctx, &testCase.add)
-		employee := repos.GetEmployees()[id]
+		employee := data.GetEmployees()[id]
 		if result != nil {
 			assert.Equal(t, result, testCase.err)
 		} else {
@@ -190,7 +231,7 @@ func TestGetPositionZero(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		positions, err := serv.GetPositions(testCase.ctx, testCase.limit, testCase.offset)
+		positions, _, err := serv.GetPositions(testCase.ctx, internal.PositionFilter{}, testCase.limit, testCase.offset)
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -201,10 +242,10 @@ func TestGetPositionZero(t *testing.T) {
 
 func TestGetPositions(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
-	secondPosition := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(2000, 0)}
-	repos.AddPosition(&secondPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
+	secondPosition := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &secondPosition))
 	testTable := []struct {
 		expected []internal.Position
 		limit    int
@@ -217,10 +258,10 @@ func TestGetPositions(t *testing.T) {
 			err: errs.LogError(),
 		},
 		{
-			expected: []internal.Position{
+			expected: positionsByID([]internal.Position{
 				firstPosition,
 				secondPosition,
-			},
+			}),
 			limit:  2,
 			offset: 1,
 			ctx:    createRightContext(),
@@ -240,7 +281,7 @@ func TestGetPositions(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		positions, err := serv.GetPositions(testCase.ctx, testCase.limit, testCase.offset)
+		positions, _, err := serv.GetPositions(testCase.ctx, internal.PositionFilter{}, testCase.limit, testCase.offset)
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -267,7 +308,7 @@ func TestGetEmployeeZero(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		employees, err := serv.GetEmployees(testCase.ctx, testCase.limit, testCase.offset)
+		employees, _, err := serv.GetEmployees(testCase.ctx, internal.EmployeeFilter{}, testCase.limit, testCase.offset)
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -278,22 +319,22 @@ func TestGetEmployeeZero(t *testing.T) {
 
 func TestGetEmployees(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	firstEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: firstPosition.ID,
 	}
-	repos.AddEmployee(&firstEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmployee))
 	secondEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Bob",
 		LasName:    "Daddy",
 		PositionID: firstPosition.ID,
 	}
-	repos.AddEmployee(&secondEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &secondEmployee))
 	testTable := []struct {
 		expected []internal.Employee
 		limit    int
@@ -306,10 +347,10 @@ func TestGetEmployees(t *testing.T) {
 			err: errs.LogError(),
 		},
 		{
-			expected: []internal.Employee{
+			expected: employeesByID([]internal.Employee{
 				firstEmployee,
 				secondEmployee,
-			},
+			}),
 			limit:  2,
 			offset: 1,
 			ctx:    createRightContext(),
@@ -329,7 +370,7 @@ func TestGetEmployees(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		employees, err := serv.GetEmployees(testCase.ctx, testCase.limit, testCase.offset)
+		employees, _, err := serv.GetEmployees(testCase.ctx, internal.EmployeeFilter{}, testCase.limit, testCase.offset)
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -340,10 +381,10 @@ func TestGetEmployees(t *testing.T) {
 
 func TestGetPosition(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
-	secondPosition := internal.Position{ID: createPosID(), Name: "lead", Salary: decimal.New(1500, 0)}
-	repos.AddPosition(&secondPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
+	secondPosition := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(1500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &secondPosition))
 
 	testTable := []struct {
 		expected internal.Position
@@ -384,15 +425,15 @@ func TestGetPosition(t *testing.T) {
 
 func TestGetEmployee(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	firstEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: firstPosition.ID,
 	}
-	repos.AddEmployee(&firstEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmployee))
 	testTable := []struct {
 		expected internal.Employee
 		id       string
@@ -432,12 +473,13 @@ func TestGetEmployee(t *testing.T) {
 
 func TestDeletePosition(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 
 	testTable := []struct {
 		expected map[string]internal.Position
 		delete   string
+		deletion internal.PositionDeletion
 		ctx      context.Context
 		err      error
 	}{
@@ -445,6 +487,18 @@ func TestDeletePosition(t *testing.T) {
 			ctx: createBadContext(),
 			err: errs.LogError(),
 		},
+		{
+			delete:   positionIDs[0],
+			deletion: internal.PositionDeletion{Mode: "orphan"},
+			ctx:      createRightContext(),
+			err:      errs.BadRequest(),
+		},
+		{
+			delete:   positionIDs[0],
+			deletion: internal.PositionDeletion{Mode: internal.DeleteReassign},
+			ctx:      createRightContext(),
+			err:      errs.BadRequest(),
+		},
 		{
 			expected: map[string]internal.Position{},
 			delete:   positionIDs[0],
@@ -453,8 +507,8 @@ func TestDeletePosition(t *testing.T) {
 		},
 	}
 	for _, testCase := range testTable {
-		err := serv.DeletePosition(testCase.ctx, testCase.delete)
-		positions := repos.GetPositions()
+		err := serv.DeletePosition(testCase.ctx, testCase.delete, testCase.deletion)
+		positions := untrashedPositions(data.GetPosition())
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -465,15 +519,15 @@ func TestDeletePosition(t *testing.T) {
 
 func TestDeleteEmployee(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	firstEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: firstPosition.ID,
 	}
-	repos.AddEmployee(&firstEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmployee))
 	testTable := []struct {
 		expected map[string]internal.Employee
 		delete   string
@@ -493,7 +547,7 @@ func TestDeleteEmployee(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		err := serv.DeleteEmployee(testCase.ctx, testCase.delete)
-		employees := repos.GetEmployees()
+		employees := untrashedEmployees(data.GetEmployees())
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else {
@@ -504,10 +558,10 @@ func TestDeleteEmployee(t *testing.T) {
 
 func TestUpdatePosition(t *testing.T) {
 	initData()
-	p := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&p)
-	updatePos := internal.Position{ID: p.ID, Name: "lead", Salary: decimal.New(2000, 0)}
-	posNilID := internal.Position{ID: uuid.Nil, Name: "lead", Salary: decimal.New(2000, 0)}
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &p))
+	updatePos := internal.Position{ID: p.ID, Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	posNilID := internal.Position{ID: uuid.Nil, Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
 	testTable := []struct {
 		update internal.Position
 		ctx    context.Context
@@ -530,7 +584,7 @@ func TestUpdatePosition(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		err := serv.UpdatePosition(testCase.ctx, &testCase.update)
-		_, ok := repos.GetPositions()[testCase.update.ID.String()]
+		_, ok := data.GetPosition()[testCase.update.ID.String()]
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else if !ok {
@@ -541,15 +595,15 @@ func TestUpdatePosition(t *testing.T) {
 
 func TestUpdateEmployee(t *testing.T) {
 	initData()
-	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: decimal.New(500, 0)}
-	repos.AddPosition(&firstPosition)
+	firstPosition := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(context.Background(), &firstPosition))
 	firstEmployee := internal.Employee{
 		ID:         createEmpID(),
 		FirstName:  "Nick",
 		LasName:    "Bobs",
 		PositionID: firstPosition.ID,
 	}
-	repos.AddEmployee(&firstEmployee)
+	assert.NoError(t, repos.AddEmployee(context.Background(), &firstEmployee))
 	updateEmp := internal.Employee{
 		ID:         firstEmployee.ID,
 		FirstName:  "Bob",
@@ -584,7 +638,7 @@ func TestUpdateEmployee(t *testing.T) {
 	}
 	for _, testCase := range testTable {
 		err := serv.UpdateEmployee(testCase.ctx, &testCase.update)
-		_, ok := repos.GetEmployees()[testCase.update.ID.String()]
+		_, ok := data.GetEmployees()[testCase.update.ID.String()]
 		if err != nil {
 			assert.Equal(t, err, testCase.err)
 		} else if !ok {
@@ -592,3 +646,367 @@ func TestUpdateEmployee(t *testing.T) {
 		}
 	}
 }
+
+func TestGetPositionsPage(t *testing.T) { //nolint:funlen
+	initData()
+	ctx := createRightContext()
+	for i := 0; i < 5; i++ {
+		p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(int64(i), 0), "USD")}
+		assert.NoError(t, repos.AddPosition(ctx, &p))
+	}
+	seen := map[uuid.UUID]int{}
+	cursor := ""
+	pages := 0
+	for {
+		positions, next, err := serv.GetPositionsPage(ctx, internal.PositionFilter{}, cursor, 2)
+		assert.NoError(t, err)
+		pages++
+		for i, p := range positions {
+			seen[p.ID]++
+			if i > 0 {
+				assert.True(t, positions[i-1].ID.String() < p.ID.String())
+			}
+		}
+		if pages == 1 {
+			// Deleting a record that was already returned and inserting new
+			// ones must not shift the following pages.
+			assert.NoError(t, repos.DeletePosition(ctx, positions[0].ID, internal.PositionDeletion{}))
+			added := internal.Position{ID: uuid.New(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+			assert.NoError(t, repos.AddPosition(ctx, &added))
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	for _, id := range positionIDs {
+		assert.Equal(t, 1, seen[uuid.MustParse(id)])
+	}
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+
+	testTable := []struct {
+		cursor string
+		limit  int
+		ctx    context.Context
+		err    error
+	}{
+		{cursor: "", limit: 1, ctx: createBadContext(), err: errs.LogError()},
+		{cursor: "", limit: 0, ctx: createRightContext(), err: errs.BadRequest()},
+		{cursor: "", limit: 101, ctx: createRightContext(), err: errs.BadRequest()},
+		{cursor: "%%%", limit: 1, ctx: createRightContext(), err: errs.BadRequest()},
+		{cursor: "AAAA", limit: 1, ctx: createRightContext(), err: errs.BadRequest()},
+	}
+	for _, testCase := range testTable {
+		_, _, err := serv.GetPositionsPage(testCase.ctx, internal.PositionFilter{}, testCase.cursor, testCase.limit)
+		assert.Equal(t, testCase.err, err)
+	}
+}
+
+func TestGetEmployeesPage(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	for i := 0; i < 3; i++ {
+		e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: strconv.Itoa(i), PositionID: p.ID}
+		assert.NoError(t, repos.AddEmployee(ctx, &e))
+	}
+	sort.Strings(employeeIDs)
+	employees, next, err := serv.GetEmployeesPage(ctx, internal.EmployeeFilter{}, "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, employees, 2)
+	assert.NotEmpty(t, next)
+	employees, next, err = serv.GetEmployeesPage(ctx, internal.EmployeeFilter{}, next, 2)
+	assert.NoError(t, err)
+	assert.Len(t, employees, 1)
+	assert.Equal(t, employeeIDs[2], employees[0].ID.String())
+	assert.Empty(t, next)
+}
+
+func TestGetFiltered(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	worker := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	lead := internal.Position{ID: createPosID(), Name: "lead", Salary: internal.NewMoney(decimal.New(2000, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &worker))
+	assert.NoError(t, repos.AddPosition(ctx, &lead))
+
+	f := internal.PositionFilter{
+		Sort:           []internal.SortField{{Field: internal.SortSalary, Desc: true}},
+		SalaryCurrency: "USD",
+		SalaryRate:     func(string) (decimal.Decimal, error) { return decimal.New(1, 0), nil },
+	}
+	positions, total, err := serv.GetPositions(ctx, f, 10, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, []internal.Position{lead, worker}, positions)
+
+	testTable := []struct {
+		filter internal.PositionFilter
+		err    error
+	}{
+		{filter: internal.PositionFilter{Sort: []internal.SortField{{Field: "first_name"}}}, err: errs.BadRequest()},
+		{
+			filter: internal.PositionFilter{Sort: []internal.SortField{{Field: "name"}, {Field: "name", Desc: true}}},
+			err:    errs.BadRequest(),
+		},
+		{
+			filter: internal.PositionFilter{
+				SalaryMin: decimal.NullDecimal{Decimal: decimal.New(10, 0), Valid: true},
+				SalaryMax: decimal.NullDecimal{Decimal: decimal.New(1, 0), Valid: true},
+			},
+			err: errs.BadRequest(),
+		},
+		{filter: internal.PositionFilter{Sort: []internal.SortField{{Field: internal.SortSalary}}}, err: errs.BadRequest()},
+		{
+			filter: internal.PositionFilter{SalaryMin: decimal.NullDecimal{Decimal: decimal.New(1, 0), Valid: true}},
+			err:    errs.BadRequest(),
+		},
+	}
+	for _, testCase := range testTable {
+		_, _, err := serv.GetPositions(ctx, testCase.filter, 10, 1)
+		assert.Equal(t, testCase.err, err)
+	}
+	_, _, err = serv.GetPositionsPage(ctx, f, "", 10)
+	assert.Equal(t, errs.BadRequest(), err)
+	_, _, err = serv.GetEmployees(ctx, internal.EmployeeFilter{Sort: []internal.SortField{{Field: "salary"}}}, 10, 1)
+	assert.Equal(t, errs.BadRequest(), err)
+}
+
+func TestSearch(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Worken", PositionID: p.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+	results, err := serv.Search(ctx, "work", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	testTable := []struct {
+		query string
+		limit int
+		ctx   context.Context
+		err   error
+	}{
+		{query: "work", limit: 10, ctx: createBadContext(), err: errs.LogError()},
+		{query: "work", limit: 0, ctx: createRightContext(), err: errs.BadRequest()},
+		{query: "work", limit: 101, ctx: createRightContext(), err: errs.BadRequest()},
+		{query: "", limit: 10, ctx: createRightContext(), err: errs.BadRequest()},
+		{query: "--", limit: 10, ctx: createRightContext(), err: errs.BadRequest()},
+	}
+	for _, testCase := range testTable {
+		_, err := serv.Search(testCase.ctx, testCase.query, testCase.limit)
+		assert.Equal(t, testCase.err, err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	p := internal.Position{ID: createPosID(), Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	assert.NoError(t, repos.AddPosition(ctx, &p))
+	e := internal.Employee{ID: createEmpID(), FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	assert.NoError(t, repos.AddEmployee(ctx, &e))
+	assert.NoError(t, serv.DeleteEmployee(ctx, employeeIDs[0]))
+
+	_, err := serv.GetTrash(createBadContext())
+	assert.Equal(t, errs.LogError(), err)
+	trash, err := serv.GetTrash(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, trash.Employees, 1)
+	_, err = serv.RestoreEmployee(ctx, "1")
+	assert.Equal(t, errs.NotFound(), err)
+	_, err = serv.RestorePosition(ctx, positionIDs[0])
+	assert.Equal(t, errs.NotFound(), err)
+
+	purged, err := serv.Purge(ctx, time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+	purged, err = serv.Purge(ctx, -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = serv.RestoreEmployee(ctx, employeeIDs[0])
+	assert.Equal(t, errs.NotFound(), err)
+	entries, _, err := serv.GetAudit(ctx, internal.AuditFilter{EntityID: e.ID}, "", 1)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, internal.AuditPurge, entries[0].Action)
+		assert.Contains(t, entries[0].Changes, internal.FieldChange{Field: "first_name", Before: "Nick"})
+	}
+}
+
+// failingAudit is an audit trail that cannot be written to.
+type failingAudit struct {
+	*repository.AuditLog
+}
+
+func (failingAudit) AddAudit(context.Context, *internal.AuditEntry) error {
+	return errs.StatusInternalServerError()
+}
+
+func TestAuditFailure(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	p := internal.Position{Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	_, err := serv.CreatePosition(ctx, &p)
+	assert.NoError(t, err)
+	e := internal.Employee{FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	_, err = serv.CreateEmployee(ctx, &e)
+	assert.NoError(t, err)
+	stored, err := repos.GetPositionByID(ctx, p.ID)
+	assert.NoError(t, err)
+
+	broken := NewServ(repos, failingAudit{audit})
+	lead := internal.Position{Name: "lead", Salary: internal.NewMoney(decimal.New(900, 0), "USD")}
+	_, err = broken.CreatePosition(ctx, &lead)
+	assert.Equal(t, errs.StatusInternalServerError(), err)
+	raise := internal.Position{ID: p.ID, Name: "worker", Salary: internal.NewMoney(decimal.New(700, 0), "USD")}
+	assert.Equal(t, errs.StatusInternalServerError(), broken.UpdatePosition(ctx, &raise))
+	deletion := internal.PositionDeletion{Mode: internal.DeleteCascade}
+	assert.Equal(t, errs.StatusInternalServerError(), broken.DeletePosition(ctx, p.ID.String(), deletion))
+	assert.Equal(t, errs.StatusInternalServerError(), broken.DeleteEmployee(ctx, e.ID.String()))
+
+	count, err := repos.CountPositions(ctx, internal.PositionFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "no position is added without an audit entry")
+	current, err := repos.GetPositionByID(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, stored, current, "the position is not changed without an audit entry")
+	employees, err := repos.FindEmployeesByPosition(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Len(t, employees, 1, "the employee is not deleted without an audit entry")
+	entries, _, err := serv.GetAudit(ctx, internal.AuditFilter{}, "", 10)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestAudit(t *testing.T) { //nolint:funlen
+	initData()
+	//revive:disable
+	ctx := context.WithValue(createRightContext(), "user_login", "admin") //nolint:staticcheck
+	//revive:enable
+	p := internal.Position{Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	_, err := serv.CreatePosition(ctx, &p)
+	assert.NoError(t, err)
+	e := internal.Employee{FirstName: "Nick", LasName: "Bobs", PositionID: p.ID}
+	_, err = serv.CreateEmployee(ctx, &e)
+	assert.NoError(t, err)
+	raise := internal.Position{ID: p.ID, Name: "worker", Salary: internal.NewMoney(decimal.New(700, 0), "USD")}
+	assert.NoError(t, serv.UpdatePosition(ctx, &raise))
+	assert.Equal(t, errs.NotFound(), serv.DeleteEmployee(ctx, uuid.New().String()))
+	assert.NoError(t, serv.DeletePosition(ctx, p.ID.String(), internal.PositionDeletion{Mode: internal.DeleteCascade}))
+	_, err = serv.RestorePosition(ctx, p.ID.String())
+	assert.NoError(t, err)
+
+	entries, next, err := serv.GetAudit(ctx, internal.AuditFilter{}, "", 10)
+	assert.NoError(t, err)
+	assert.Empty(t, next)
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Entity+" "+entry.Action)
+		assert.Equal(t, "admin", entry.Actor)
+		assert.Equal(t, ctx.Value("correlation_id"), entry.CorrelationID)
+	}
+	assert.Equal(t, []string{
+		"position restore", "employee delete", "position delete", "position update", "employee create", "position create",
+	}, actions)
+	assert.Equal(t, []internal.FieldChange{{
+		Field:  "salary",
+		Before: map[string]interface{}{"amount": "500", "currency": "USD"},
+		After:  map[string]interface{}{"amount": "700", "currency": "USD"},
+	}}, entries[3].Changes)
+	assert.Equal(t, []internal.FieldChange{
+		{Field: "first_name", Before: "Nick"},
+		{Field: "las_name", Before: "Bobs"},
+		{Field: "position_id", Before: p.ID.String()},
+	}, entries[1].Changes)
+
+	entries, next, err = serv.GetAudit(ctx, internal.AuditFilter{EntityID: p.ID}, "", 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, next, err = serv.GetAudit(ctx, internal.AuditFilter{EntityID: p.ID}, next, 2)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Empty(t, next)
+	assert.Equal(t, internal.AuditCreate, entries[1].Action)
+
+	now := time.Now()
+	testTable := []struct {
+		filter internal.AuditFilter
+		cursor string
+		limit  int
+		ctx    context.Context
+		err    error
+	}{
+		{limit: 10, ctx: createBadContext(), err: errs.LogError()},
+		{limit: 0, ctx: ctx, err: errs.BadRequest()},
+		{limit: 101, ctx: ctx, err: errs.BadRequest()},
+		{filter: internal.AuditFilter{Entity: "salary"}, limit: 10, ctx: ctx, err: errs.BadRequest()},
+		{filter: internal.AuditFilter{From: now, To: now}, limit: 10, ctx: ctx, err: errs.BadRequest()},
+		{cursor: "!", limit: 10, ctx: ctx, err: errs.BadRequest()},
+	}
+	for _, testCase := range testTable {
+		_, _, err := serv.GetAudit(testCase.ctx, testCase.filter, testCase.cursor, testCase.limit)
+		assert.Equal(t, testCase.err, err)
+	}
+}
+
+func TestSalaryHistory(t *testing.T) {
+	initData()
+	ctx := createRightContext()
+	p := internal.Position{Name: "worker", Salary: internal.NewMoney(decimal.New(500, 0), "USD")}
+	_, err := serv.CreatePosition(ctx, &p)
+	assert.NoError(t, err)
+	next := time.Now().Add(time.Hour)
+
+	testTable := []struct {
+		id     string
+		record internal.SalaryRecord
+		ctx    context.Context
+		field  string
+		err    error
+	}{
+		{id: p.ID.String(), record: internal.SalaryRecord{EffectiveFrom: next}, ctx: createBadContext(), err: errs.LogError()},
+		{id: "1", record: internal.SalaryRecord{EffectiveFrom: next}, ctx: ctx, err: errs.NotFound()},
+		{id: uuid.New().String(), record: internal.SalaryRecord{EffectiveFrom: next}, ctx: ctx, err: errs.NotFound()},
+		{id: p.ID.String(), record: internal.SalaryRecord{EffectiveFrom: time.Now()}, ctx: ctx, field: "effective_from"},
+		{id: p.ID.String(), record: internal.SalaryRecord{Amount: decimal.New(7005, -1), Currency: "JPY", EffectiveFrom: next}, ctx: ctx, field: "amount"},
+	}
+	for _, testCase := range testTable {
+		if testCase.record.Amount.IsZero() {
+			testCase.record.Amount = decimal.New(700, 0)
+		}
+		err := serv.ScheduleSalary(testCase.ctx, testCase.id, &testCase.record)
+		if testCase.field == "" {
+			assert.Equal(t, testCase.err, err)
+			continue
+		}
+		var invalid *errs.ValidationError
+		if assert.ErrorAs(t, err, &invalid) {
+			assert.Equal(t, testCase.field, invalid.Fields[0].Field)
+		}
+	}
+
+	record := internal.SalaryRecord{Amount: decimal.New(700, 0), EffectiveFrom: next}
+	assert.NoError(t, serv.ScheduleSalary(ctx, p.ID.String(), &record))
+	assert.Equal(t, internal.DefaultCurrency, record.Currency)
+	later := internal.SalaryRecord{Amount: decimal.New(650, 0), Currency: "EUR", EffectiveFrom: next.Add(time.Hour)}
+	assert.NoError(t, serv.ScheduleSalary(ctx, p.ID.String(), &later))
+	records, err := serv.GetSalaryHistory(ctx, p.ID.String())
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, "EUR", records[2].Currency)
+	}
+	entries, _, err := serv.GetAudit(ctx, internal.AuditFilter{EntityID: p.ID}, "", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.AuditScheduleSalary, entries[0].Action)
+
+	_, err = serv.GetSalaryHistory(ctx, "1")
+	assert.Equal(t, errs.NotFound(), err)
+	_, err = serv.GetSalaryHistory(createBadContext(), p.ID.String())
+	assert.Equal(t, errs.LogError(), err)
+}
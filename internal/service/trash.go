@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// GetTrash returns the deleted records that have not been purged yet.
+func (t Serv) GetTrash(ctx context.Context) (internal.Trash, error) {
+	if err := logCorrelationID(ctx); err != nil {
+		return internal.Trash{}, errors.LogError()
+	}
+	return t.repo.Trash(ctx)
+}
+
+// RestorePosition takes a deleted position out of the trash.
+func (t Serv) RestorePosition(ctx context.Context, id string) (internal.Position, error) {
+	if err := logCorrelationID(ctx); err != nil {
+		return internal.Position{}, errors.LogError()
+	}
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return internal.Position{}, errors.NotFound()
+	}
+	return t.repo.RestorePosition(t.audited(ctx), uID)
+}
+
+// RestoreEmployee takes a deleted employee out of the trash. Its position has
+// to be restored first if it was deleted too.
+func (t Serv) RestoreEmployee(ctx context.Context, id string) (internal.Employee, error) {
+	if err := logCorrelationID(ctx); err != nil {
+		return internal.Employee{}, errors.LogError()
+	}
+	uID, err := uuid.Parse(id)
+	if err != nil {
+		return internal.Employee{}, errors.NotFound()
+	}
+	return t.repo.RestoreEmployee(t.audited(ctx), uID)
+}
+
+// Purge deletes for good the records that have been in the trash for longer
+// than retention and returns how many there were. Each gets an audit entry.
+func (t Serv) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	return t.repo.Purge(t.audited(ctx), time.Now().Add(-retention))
+}
+
+// PurgeLoop runs Purge every interval until ctx is done.
+func (t Serv) PurgeLoop(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := t.Purge(ctx, retention)
+			if err != nil {
+				logrus.WithError(err).Error("purge trash")
+				continue
+			}
+			if n > 0 {
+				logrus.WithField("purged", n).Info("purge trash")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
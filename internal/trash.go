@@ -0,0 +1,8 @@
+package internal
+
+// Trash holds the deleted records that have not been purged yet, the most
+// recently deleted first.
+type Trash struct {
+	Positions []Position `json:"positions"`
+	Employees []Employee `json:"employees"`
+}
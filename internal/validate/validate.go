@@ -0,0 +1,299 @@
+// Package validate decodes request bodies into the entities of the service
+// and checks them against the rules declared in their validate struct tags.
+//
+// A tag is a comma separated list of rules, e.g. `validate:"required,max=100"`.
+// A rule prefixed with an operation, e.g. "update:required", only applies to
+// that operation. Every broken rule of every field is reported at once in an
+// errors.ValidationError.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Op is what the body is decoded for.
+type Op string
+
+const (
+	Create Op = "create"
+	Update Op = "update"
+)
+
+// rule checks a present field. ok is false if the value breaks the rule, in
+// which case code and message describe why.
+type rule func(v reflect.Value, param string) (code, message string, ok bool)
+
+// rules are the rules a tag may name besides required.
+var rules = map[string]rule{ // nolint: gochecknoglobals
+	"max":      maxLength,
+	"gt":       greaterThan,
+	"scale":    maxScale,
+	"currency": currencyCode,
+	"exact":    exact,
+}
+
+// Decode reads a JSON object from r into v, a pointer to a struct, and
+// validates it for op. Malformed JSON is a ParseError. Unknown fields, values
+// of the wrong type and broken rules are reported together as an
+// errors.ValidationError. A field holding a struct other than a time or a
+// decimal is an object checked the same way, and its fields are reported
+// with a path such as "salary.amount".
+func Decode(r io.Reader, v interface{}, op Op) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return parseError(err)
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return parseError(err)
+	}
+	if object == nil {
+		return parseError(fmt.Errorf("body must be a JSON object"))
+	}
+	if fieldErrors := check(object, reflect.ValueOf(v).Elem(), op, ""); len(fieldErrors) > 0 {
+		return &errors.ValidationError{Fields: fieldErrors}
+	}
+	return nil
+}
+
+// check decodes every field of object into the matching field of val and
+// applies its rules. The names of the fields are prefixed with prefix.
+func check(object map[string]json.RawMessage, val reflect.Value, op Op, prefix string) []errors.FieldError {
+	var fieldErrors []errors.FieldError
+	known := map[string]bool{}
+	t := val.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := FieldName(field)
+		if name == "" {
+			continue
+		}
+		known[name] = true
+		path := prefix + name
+		raw, present := object[name]
+		if present && !bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			typeError := errors.FieldError{Field: path, Code: "type", Message: "must be " + describe(field.Type)}
+			if nested(field.Type) {
+				var inner map[string]json.RawMessage
+				if err := json.Unmarshal(raw, &inner); err != nil {
+					fieldErrors = append(fieldErrors, typeError)
+					continue
+				}
+				if innerErrors := check(inner, val.Field(i), op, path+"."); len(innerErrors) > 0 {
+					fieldErrors = append(fieldErrors, innerErrors...)
+					continue
+				}
+			} else if err := json.Unmarshal(raw, val.Field(i).Addr().Interface()); err != nil {
+				fieldErrors = append(fieldErrors, typeError)
+				continue
+			}
+		} else {
+			present = false
+		}
+		fieldErrors = append(fieldErrors, applyRules(path, field.Tag.Get("validate"), val.Field(i), present, op)...)
+	}
+	var unknown []string
+	for name := range object {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		fieldErrors = append(fieldErrors, errors.FieldError{
+			Field: prefix + name, Code: "unknown", Message: "is not a known field",
+		})
+	}
+	return fieldErrors
+}
+
+// nested reports whether a field of type t is an object to check field by
+// field.
+func nested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(decimal.Decimal{}) && t != reflect.TypeOf(time.Time{})
+}
+
+// Rule is one rule of a validate tag, e.g. Name "max" and Param "100".
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// Rules returns the rules tag declares for op, in order.
+func Rules(tag string, op Op) []Rule {
+	var out []Rule
+	for _, spec := range strings.Split(tag, ",") {
+		if spec == "" {
+			continue
+		}
+		if i := strings.Index(spec, ":"); i >= 0 {
+			if Op(spec[:i]) != op {
+				continue
+			}
+			spec = spec[i+1:]
+		}
+		r := Rule{Name: spec}
+		if i := strings.Index(spec, "="); i >= 0 {
+			r.Name, r.Param = spec[:i], spec[i+1:]
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// applyRules checks the value of a field against its tag. A missing or
+// empty required field is only reported as such; the other rules are
+// skipped for a field that was not sent.
+func applyRules(name, tag string, v reflect.Value, present bool, op Op) []errors.FieldError {
+	var fieldErrors []errors.FieldError
+	for _, r := range Rules(tag, op) {
+		if r.Name == "required" {
+			if !present || isZero(v) {
+				return []errors.FieldError{{Field: name, Code: "required", Message: "is required"}}
+			}
+			continue
+		}
+		if !present {
+			continue
+		}
+		check, ok := rules[r.Name]
+		if !ok {
+			panic("validate: unknown rule " + r.Name)
+		}
+		if code, message, ok := check(v, r.Param); !ok {
+			fieldErrors = append(fieldErrors, errors.FieldError{Field: name, Code: code, Message: message})
+		}
+	}
+	return fieldErrors
+}
+
+func maxLength(v reflect.Value, param string) (string, string, bool) {
+	n, err := strconv.Atoi(param)
+	if err != nil || v.Kind() != reflect.String {
+		panic("validate: max needs a string field and a number")
+	}
+	if utf8.RuneCountInString(v.String()) > n {
+		return "max_length", fmt.Sprintf("must be at most %d characters long", n), false
+	}
+	return "", "", true
+}
+
+func greaterThan(v reflect.Value, param string) (string, string, bool) {
+	d, ok := v.Interface().(decimal.Decimal)
+	limit, err := decimal.NewFromString(param)
+	if !ok || err != nil {
+		panic("validate: gt needs a decimal field and a number")
+	}
+	if !d.GreaterThan(limit) {
+		return "min", "must be greater than " + param, false
+	}
+	return "", "", true
+}
+
+func maxScale(v reflect.Value, param string) (string, string, bool) {
+	d, ok := v.Interface().(decimal.Decimal)
+	places, err := strconv.Atoi(param)
+	if !ok || err != nil {
+		panic("validate: scale needs a decimal field and a number")
+	}
+	if !d.Equal(d.Round(int32(places))) {
+		return "scale", fmt.Sprintf("must have at most %d decimal places", places), false
+	}
+	return "", "", true
+}
+
+// currencyCode checks for an ISO 4217 code, three capital letters. Whether
+// the code is one in use is left to the service.
+func currencyCode(v reflect.Value, _ string) (string, string, bool) {
+	if v.Kind() != reflect.String {
+		panic("validate: currency needs a string field")
+	}
+	if !internal.IsCurrencyCode(v.String()) {
+		return "currency", "must be an ISO 4217 currency code", false
+	}
+	return "", "", true
+}
+
+// exact checks a value that knows whether it is exact, such as an amount of
+// money with no more decimal places than its currency has minor units.
+func exact(v reflect.Value, _ string) (string, string, bool) {
+	e, ok := v.Interface().(interface{ Exact() bool })
+	if !ok {
+		panic("validate: exact needs a field with an Exact method")
+	}
+	if !e.Exact() {
+		return "scale", "must have no more decimal places than the currency has minor units", false
+	}
+	return "", "", true
+}
+
+// isZero reports whether v holds the zero value of its type. Strings of only
+// white space count as empty.
+func isZero(v reflect.Value) bool {
+	switch x := v.Interface().(type) {
+	case string:
+		return strings.TrimSpace(x) == ""
+	case decimal.Decimal:
+		return x.IsZero()
+	}
+	return v.IsZero()
+}
+
+// describe names the JSON value a field of type t accepts.
+func describe(t reflect.Type) string {
+	switch t {
+	case reflect.TypeOf(uuid.UUID{}):
+		return "a UUID"
+	case reflect.TypeOf(decimal.Decimal{}):
+		return "a number"
+	case reflect.TypeOf(time.Time{}):
+		return "an RFC 3339 date-time"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// FieldName is the name of field in JSON, or "" if it is not encoded.
+func FieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func parseError(err error) error {
+	return errors.WithDetails(errors.ParseError(), map[string]interface{}{"reason": err.Error()})
+}
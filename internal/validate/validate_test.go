@@ -0,0 +1,174 @@
+package validate
+
+import (
+	errs "errors"
+	"strings"
+	"testing"
+
+	"github.com/NVTer/rest-api-example/internal"
+	"github.com/NVTer/rest-api-example/internal/errors"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func fields(err error) []string {
+	var v *errors.ValidationError
+	if !errs.As(err, &v) {
+		return nil
+	}
+	var out []string
+	for _, f := range v.Fields {
+		out = append(out, f.Field+":"+f.Code)
+	}
+	return out
+}
+
+func TestDecode_Position(t *testing.T) {
+	id := uuid.New()
+	testTable := []struct {
+		name   string
+		body   string
+		op     Op
+		fields []string
+	}{
+		{name: "valid", body: `{"name":"worker","salary":{"amount":1000.50,"currency":"USD"}}`, op: Create},
+		{name: "amount as string", body: `{"name":"worker","salary":{"amount":"12.5","currency":"USD"}}`, op: Create},
+		{
+			name: "id allowed on create",
+			body: `{"id":"` + id.String() + `","name":"worker","salary":{"amount":1,"currency":"USD"}}`,
+			op:   Create,
+		},
+		{
+			name: "valid update",
+			body: `{"id":"` + id.String() + `","name":"worker","salary":{"amount":1,"currency":"USD"}}`,
+			op:   Update,
+		},
+		{name: "empty", body: `{}`, op: Create, fields: []string{"name:required", "salary:required"}},
+		{name: "null", body: `{"name":null,"salary":null}`, op: Create, fields: []string{"name:required", "salary:required"}},
+		{
+			name:   "update needs id",
+			body:   `{"name":"worker","salary":{"amount":1,"currency":"USD"}}`,
+			op:     Update,
+			fields: []string{"id:required"},
+		},
+		{
+			name:   "empty salary",
+			body:   `{"name":"worker","salary":{}}`,
+			op:     Create,
+			fields: []string{"salary.amount:required", "salary.currency:required"},
+		},
+		{
+			name:   "zero salary",
+			body:   `{"name":"worker","salary":{"amount":0,"currency":"USD"}}`,
+			op:     Create,
+			fields: []string{"salary.amount:required"},
+		},
+		{
+			name:   "negative salary",
+			body:   `{"name":"worker","salary":{"amount":-5,"currency":"USD"}}`,
+			op:     Create,
+			fields: []string{"salary.amount:min"},
+		},
+		{
+			name:   "bad currency",
+			body:   `{"name":"worker","salary":{"amount":5,"currency":"usd"}}`,
+			op:     Create,
+			fields: []string{"salary.currency:currency"},
+		},
+		{
+			name:   "three decimals",
+			body:   `{"name":"worker","salary":{"amount":1.001,"currency":"USD"}}`,
+			op:     Create,
+			fields: []string{"salary:scale"},
+		},
+		{name: "three decimals in KWD", body: `{"name":"worker","salary":{"amount":1.001,"currency":"KWD"}}`, op: Create},
+		{
+			name:   "decimals in JPY",
+			body:   `{"name":"worker","salary":{"amount":1000.5,"currency":"JPY"}}`,
+			op:     Create,
+			fields: []string{"salary:scale"},
+		},
+		{name: "trailing zeros", body: `{"name":"worker","salary":{"amount":1.100,"currency":"USD"}}`, op: Create},
+		{
+			name:   "long name",
+			body:   `{"name":"` + strings.Repeat("ж", 101) + `","salary":{"amount":1,"currency":"USD"}}`,
+			op:     Create,
+			fields: []string{"name:max_length"},
+		},
+		{name: "max name", body: `{"name":"` + strings.Repeat("ж", 100) + `","salary":{"amount":1,"currency":"USD"}}`, op: Create},
+		{name: "wrong types", body: `{"name":5,"salary":true}`, op: Create, fields: []string{"name:type", "salary:type"}},
+		{
+			name:   "bare amount",
+			body:   `{"name":"worker","salary":1000}`,
+			op:     Create,
+			fields: []string{"salary:type"},
+		},
+		{
+			name:   "unknown fields",
+			body:   `{"name":"worker","salary":{"amount":1,"currency":"USD","cents":5},"z":1,"Name":"x"}`,
+			op:     Create,
+			fields: []string{"salary.cents:unknown", "Name:unknown", "z:unknown"},
+		},
+	}
+	for _, testCase := range testTable {
+		var p internal.Position
+		err := Decode(strings.NewReader(testCase.body), &p, testCase.op)
+		if testCase.fields == nil {
+			assert.NoError(t, err, testCase.name)
+			continue
+		}
+		assert.True(t, errs.Is(err, errors.Invalid()), testCase.name)
+		assert.Equal(t, testCase.fields, fields(err), testCase.name)
+	}
+}
+
+func TestDecode_Employee(t *testing.T) {
+	var e internal.Employee
+	err := Decode(strings.NewReader(`{"first_name":"Bob","las_name":"Vik","position_id":"nope"}`), &e, Create)
+	assert.Equal(t, []string{"position_id:type"}, fields(err))
+
+	positionID := uuid.New()
+	body := `{"first_name":"Bob","las_name":"Vik","position_id":"` + positionID.String() + `"}`
+	assert.NoError(t, Decode(strings.NewReader(body), &e, Create))
+	assert.Equal(t, internal.Employee{FirstName: "Bob", LasName: "Vik", PositionID: positionID}, e)
+}
+
+func TestDecode_Malformed(t *testing.T) {
+	for _, body := range []string{"", "s", "[]", "null", `{"name":`} {
+		var p internal.Position
+		err := Decode(strings.NewReader(body), &p, Create)
+		assert.True(t, errs.Is(err, errors.ParseError()), body)
+	}
+}
+
+func TestDecode_Values(t *testing.T) {
+	var p internal.Position
+	body := `{"name":"worker","salary":{"amount":"12.50","currency":"EUR"}}`
+	assert.NoError(t, Decode(strings.NewReader(body), &p, Create))
+	assert.Equal(t, "worker", p.Name)
+	assert.True(t, internal.NewMoney(decimal.RequireFromString("12.5"), "EUR").Equal(p.Salary))
+}
+
+func TestDecode_SalaryRecord(t *testing.T) {
+	testTable := []struct {
+		body   string
+		fields []string
+	}{
+		{body: `{"amount":1200,"currency":"EUR","effective_from":"2030-01-01T00:00:00Z"}`},
+		{body: `{"amount":1200,"effective_from":"2030-01-01T00:00:00Z"}`},
+		{body: `{}`, fields: []string{"amount:required", "effective_from:required"}},
+		{body: `{"amount":1200,"currency":"eur","effective_from":"2030-01-01T00:00:00Z"}`, fields: []string{"currency:currency"}},
+		{body: `{"amount":1200,"currency":"EURO","effective_from":"2030-01-01T00:00:00Z"}`, fields: []string{"currency:currency"}},
+		{body: `{"amount":1200,"effective_from":"2030-01-01"}`, fields: []string{"effective_from:type"}},
+	}
+	for _, testCase := range testTable {
+		var r internal.SalaryRecord
+		err := Decode(strings.NewReader(testCase.body), &r, Create)
+		if testCase.fields == nil {
+			assert.NoError(t, err, testCase.body)
+			continue
+		}
+		assert.Equal(t, testCase.fields, fields(err), testCase.body)
+	}
+}